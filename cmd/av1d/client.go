@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// errNotRunning is returned when the daemon's control socket can't be reached.
+var errNotRunning = errors.New("daemon is not running")
+
+// client talks to a running daemon over its control socket.
+type client struct {
+	socket string
+	http   *http.Client
+}
+
+func newClient(cfg config.TranscodeConfig) (*client, error) {
+	if cfg.ControlSocket == "" {
+		return nil, fmt.Errorf("%w: control_socket is not configured", errNotRunning)
+	}
+	socket := cfg.ControlSocket
+	return &client{
+		socket: socket,
+		http: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}, nil
+}
+
+// do sends a request to the control API and decodes the JSON response into
+// out, if out is not nil. API errors are returned with the daemon's message.
+func (c *client) do(method, path string, body, out any) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, "http://av1d"+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w: cannot reach %s: %v", errNotRunning, c.socket, opErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jobs returns every job the daemon knows about.
+func (c *client) jobs() ([]jobs.Job, error) {
+	var all []jobs.Job
+	err := c.do(http.MethodGet, "/jobs", nil, &all)
+	return all, err
+}
+
+// loadJobs returns every job, from the running daemon if it is reachable and
+// from the job state directory otherwise.
+func loadJobs(cfg config.TranscodeConfig) ([]jobs.Job, error) {
+	if c, err := newClient(cfg); err == nil {
+		all, err := c.jobs()
+		if !errors.Is(err, errNotRunning) {
+			return all, err
+		}
+	}
+
+	stored, err := jobs.LoadAllJobs(cfg.JobStateDir)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]jobs.Job, 0, len(stored))
+	for _, job := range stored {
+		all = append(all, *job)
+	}
+	return all, nil
+}
+
+// findJob looks up a job by ID or by an unambiguous ID prefix.
+func findJob(all []jobs.Job, id string) (jobs.Job, error) {
+	var matches []jobs.Job
+	for _, job := range all {
+		if job.ID == id {
+			return job, nil
+		}
+		if strings.HasPrefix(job.ID, id) {
+			matches = append(matches, job)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return jobs.Job{}, fmt.Errorf("job %s not found", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return jobs.Job{}, fmt.Errorf("job ID %s is ambiguous, it matches %d jobs", id, len(matches))
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/daemon"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+const jobsUsage = `Usage:
+  av1d jobs list [-status s] [-path substr] [-json]
+  av1d jobs show <id>
+  av1d jobs retry|skip|delete [-status s] [-path substr] [<id>...]
+
+Job IDs may be shortened to any unambiguous prefix. retry, skip and delete
+act on the given jobs, or on every job matching the filters.
+`
+
+// jobsCmd implements "av1d jobs".
+func jobsCmd(cfg config.TranscodeConfig, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, jobsUsage)
+		return errors.New("missing jobs subcommand")
+	}
+
+	sub, args := args[0], args[1:]
+	fs := flag.NewFlagSet("jobs "+sub, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, jobsUsage) }
+	status := fs.String("status", "", "only jobs with this status: pending, running, success, failed or skipped")
+	path := fs.String("path", "", "only jobs whose source path contains this")
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	switch sub {
+	case "list":
+		all, err := loadJobs(cfg)
+		if err != nil {
+			return err
+		}
+		listed := daemon.FilterJobs(all, *status, *path)
+		if *asJSON {
+			return printJSON(listed)
+		}
+		printJobs(listed)
+		return nil
+
+	case "show":
+		if fs.NArg() != 1 {
+			return errors.New("usage: av1d jobs show <id>")
+		}
+		all, err := loadJobs(cfg)
+		if err != nil {
+			return err
+		}
+		job, err := findJob(all, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(job)
+
+	case "retry", "skip", "delete":
+		return jobsAction(cfg, sub, fs.Args(), *status, *path)
+
+	default:
+		fmt.Fprint(os.Stderr, jobsUsage)
+		return fmt.Errorf("unknown jobs subcommand %q", sub)
+	}
+}
+
+// jobsAction asks the running daemon to retry, skip or delete the jobs given
+// by ID, or all jobs matching the filters.
+func jobsAction(cfg config.TranscodeConfig, action string, ids []string, status, path string) error {
+	if len(ids) == 0 && status == "" && path == "" {
+		return fmt.Errorf("usage: av1d jobs %s [-status s] [-path substr] [<id>...]", action)
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	all, err := c.jobs()
+	if err != nil {
+		return err
+	}
+
+	var selected []jobs.Job
+	if len(ids) > 0 {
+		for _, id := range ids {
+			job, err := findJob(all, id)
+			if err != nil {
+				return err
+			}
+			selected = append(selected, job)
+		}
+		selected = daemon.FilterJobs(selected, status, path)
+	} else {
+		selected = daemon.FilterJobs(all, status, path)
+	}
+	if len(selected) == 0 {
+		return errors.New("no matching jobs")
+	}
+
+	failed := 0
+	for _, job := range selected {
+		var result jobs.Job
+		if action == "delete" {
+			err = c.do(http.MethodDelete, "/jobs/"+job.ID, nil, &result)
+		} else {
+			err = c.do(http.MethodPost, "/jobs/"+job.ID+"/"+action, nil, &result)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", shortID(job.ID), err)
+			failed++
+			continue
+		}
+		if action == "delete" {
+			fmt.Printf("%s deleted: %s\n", shortID(job.ID), job.SourcePath)
+		} else {
+			fmt.Printf("%s %s: %s\n", shortID(job.ID), result.Status, job.SourcePath)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d job(s) failed", failed, len(selected))
+	}
+	return nil
+}
+
+// enqueueCmd implements "av1d enqueue".
+func enqueueCmd(cfg config.TranscodeConfig, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: av1d enqueue <path>...")
+	}
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, arg := range args {
+		// The daemon resolves relative paths against its own directory
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		var job jobs.Job
+		if err := c.do(http.MethodPost, "/jobs", map[string]string{"path": path}, &job); err != nil {
+			if errors.Is(err, errNotRunning) {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s queued: %s\n", shortID(job.ID), job.SourcePath)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) not queued", failed, len(args))
+	}
+	return nil
+}
+
+// printJobs prints jobs as a table, oldest first.
+func printJobs(list []jobs.Job) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSIZE\tRESULT\tPATH")
+	for _, job := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", shortID(job.ID), job.Status, formatGB(job.OriginalSize), jobResult(job), job.SourcePath)
+	}
+	w.Flush()
+}
+
+// jobResult summarizes how a job ended up: its new size or why it didn't.
+func jobResult(job jobs.Job) string {
+	if job.Status == jobs.JobStatusSuccess && job.OriginalSize > 0 && job.NewSize > 0 {
+		return fmt.Sprintf("%s (%.0f%%)", formatGB(job.NewSize), float64(job.NewSize)/float64(job.OriginalSize)*100)
+	}
+	if len(job.Reason) > 60 {
+		return job.Reason[:57] + "..."
+	}
+	return job.Reason
+}
+
+// shortID abbreviates a job ID for display; any unique prefix is accepted back.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func formatGB(bytes int64) string {
+	return fmt.Sprintf("%.2f GB", float64(bytes)/(1024*1024*1024))
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/daemon"
+)
+
+// scanCmd implements "av1d scan". By default it asks the running daemon to
+// rescan; with -dry-run it walks the library itself and only reports.
+func scanCmd(cfg config.TranscodeConfig, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "list the files a scan would queue, with estimated savings, without writing anything")
+	full := fs.Bool("full", false, "re-judge every file, not just changed ones (running daemon only)")
+	asJSON := fs.Bool("json", false, "print dry-run candidates as JSON")
+	verbose := fs.Bool("v", false, "show the scanner's log during a dry run")
+	fs.Parse(args)
+
+	if !*dryRun {
+		c, err := newClient(cfg)
+		if err != nil {
+			return err
+		}
+		path := "/scan"
+		if *full {
+			path += "?full=true"
+		}
+		if err := c.do(http.MethodPost, path, nil, nil); err != nil {
+			return err
+		}
+		fmt.Println("Scan requested")
+		return nil
+	}
+
+	if len(cfg.Roots()) == 0 {
+		return errors.New("no library_roots or libraries configured")
+	}
+	ffmpegPath := filepath.Join(cfg.FFmpegInstallDir, "ffmpeg")
+	if _, err := os.Stat(ffmpegPath); err != nil {
+		return fmt.Errorf("ffmpeg not found at %s, start the daemon once to install it: %w", ffmpegPath, err)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	var candidates []daemon.Candidate
+	result, err := daemon.PreviewScan(cfg, ffmpegPath, func(c daemon.Candidate) {
+		candidates = append(candidates, c)
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		if candidates == nil {
+			candidates = []daemon.Candidate{}
+		}
+		return printJSON(candidates)
+	}
+
+	// Biggest estimated savings first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return savings(candidates[i]) > savings(candidates[j])
+	})
+	var size, saved int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SIZE\tESTIMATE\tSAVED\tCODEC\tRESOLUTION\tPROFILE\tPATH")
+	for _, c := range candidates {
+		estimate, save := "?", "?"
+		if c.EstimatedSize > 0 {
+			estimate = formatGB(c.EstimatedSize)
+			save = formatGB(savings(c))
+			saved += savings(c)
+		}
+		size += c.Size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", formatGB(c.Size), estimate, save, c.Codec, c.Resolution, c.Profile, c.Path)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d candidate(s), %s in total, about %s saved; %d skipped, %d excluded, %d still settling\n",
+		len(candidates), formatGB(size), formatGB(saved), len(result.Skipped), result.Excluded, result.Settling)
+	return nil
+}
+
+// savings returns a candidate's estimated savings in bytes, 0 if unknown.
+func savings(c daemon.Candidate) int64 {
+	if c.EstimatedSize <= 0 {
+		return 0
+	}
+	return c.Size - c.EstimatedSize
+}
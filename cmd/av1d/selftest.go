@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+)
+
+// selfTest runs every encoder the profiles use through
+// ffmpeg.ProbeCapabilities, plus SVT-AV1 if a GPU encoder failed or drops
+// HDR10 metadata and would fall back to it. The reports are keyed by
+// encoder name.
+func selfTest(cfg config.TranscodeConfig, ffmpegPath string) (map[string]*ffmpeg.Capabilities, error) {
+	devices := cfg.RenderNodes
+	if len(devices) == 0 {
+		devices = ffmpeg.FindRenderNodes()
+	}
+	reports := make(map[string]*ffmpeg.Capabilities)
+	probe := func(name string) error {
+		caps, err := ffmpeg.ProbeCapabilities(ffmpegPath, name, devices)
+		if err != nil {
+			return fmt.Errorf("self-test of %s: %w", name, err)
+		}
+		reports[name] = caps
+		return nil
+	}
+	for _, name := range cfg.Encoders() {
+		if err := probe(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range cfg.Encoders() {
+		if enc, _ := ffmpeg.LookupEncoder(name); !reports[name].HDR10 && enc.Hardware() && reports[ffmpeg.EncoderSVT] == nil {
+			if err := probe(ffmpeg.EncoderSVT); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return reports, nil
+}
+
+// selftestCmd implements "av1d selftest".
+func selftestCmd(cfg config.TranscodeConfig, args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	ffmpegPath, err := ffmpeg.EnsureFFmpeg(cfg.FFmpegInstallDir, cfg.FFmpegURL)
+	if err != nil {
+		return err
+	}
+	reports, err := selfTest(cfg, ffmpegPath)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(reports)
+	}
+	for _, name := range ffmpeg.EncoderNames() {
+		if caps := reports[name]; caps != nil {
+			fmt.Println(caps)
+		}
+	}
+	for _, name := range cfg.Encoders() {
+		if !reports[name].OK {
+			return fmt.Errorf("self-test failed")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/daemon"
+)
+
+// statusCmd implements "av1d status".
+func statusCmd(cfg config.TranscodeConfig, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON")
+	fs.Parse(args)
+
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	var status daemon.SystemStatus
+	if err := c.do(http.MethodGet, "/status", nil, &status); err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(status)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Uptime:\t%s (since %s)\n", time.Duration(status.UptimeSec)*time.Second, status.StartedAt.Format(time.DateTime))
+	fmt.Fprintf(w, "FFmpeg:\t%s\n", status.FFmpegPath)
+	devices := make([]string, len(status.Devices))
+	for i, device := range status.Devices {
+		if device == "" {
+			device = "default VAAPI device"
+		}
+		devices[i] = device
+	}
+	fmt.Fprintf(w, "Devices:\t%s\n", strings.Join(devices, ", "))
+
+	q := status.Queue
+	queue := fmt.Sprintf("%d pending (%d waiting), %d running on %d slot(s), %d jobs in total", q.Pending, q.Waiting, q.Running, q.Capacity, q.Total)
+	if q.Paused {
+		queue += ", paused"
+	}
+	fmt.Fprintf(w, "Queue:\t%s\n", queue)
+
+	switch {
+	case status.Schedule.Window != "":
+		fmt.Fprintf(w, "Schedule:\topen, window %s\n", status.Schedule.Window)
+	case status.Schedule.Open:
+		fmt.Fprintf(w, "Schedule:\topen\n")
+	default:
+		fmt.Fprintf(w, "Schedule:\tclosed\n")
+	}
+	if status.Throttle.Throttled {
+		fmt.Fprintf(w, "Throttle:\tover limits: %s\n", strings.Join(status.Throttle.Over, ", "))
+	}
+	if len(status.PausedFor) > 0 {
+		fmt.Fprintf(w, "Paused:\t%s\n", strings.Join(status.PausedFor, "; "))
+	}
+	fmt.Fprintf(w, "Host:\tCPU %.0f%%, memory %.0f%%, load %.2f %.2f %.2f\n",
+		status.CPUPercent, status.MemoryPercent, status.Load1, status.Load5, status.Load15)
+	if s := status.LastScan; s != nil {
+		fmt.Fprintf(w, "Last scan:\t%s, took %s: %d candidates, %d skipped, %d unchanged, %d settling, %d excluded\n",
+			s.FinishedAt.Format(time.DateTime), s.Duration.Round(time.Millisecond), len(s.Candidates), len(s.Skipped), s.Unchanged, s.Settling, s.Excluded)
+	}
+	w.Flush()
+
+	if len(status.Running) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPROGRESS\tSPEED\tETA\tPATH")
+	for _, job := range status.Running {
+		progress, speed, eta := "-", "-", "-"
+		if p := job.Progress; p != nil {
+			progress = fmt.Sprintf("%.1f%%", p.Percent)
+			speed = fmt.Sprintf("%.2fx", p.Speed)
+			if p.ETA > 0 {
+				eta = p.ETA.Round(time.Second).String()
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", shortID(job.ID), progress, speed, eta, job.SourcePath)
+	}
+	return w.Flush()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -10,13 +11,13 @@ import (
 )
 
 func main() {
-	// Load config to get jobs directory
-	// Try to load from /etc/av1qsvd/config.json, fallback to default
-	configPath := "/etc/av1qsvd/config.json"
-	cfg, err := config.LoadConfig(configPath)
+	// Load config to get jobs directory, the same way av1d does
+	configPath := flag.String("config", "", "configuration file (default $AV1D_CONFIG or "+config.DefaultPath+")")
+	flag.Parse()
+	cfg, _, err := config.Load(config.Sources{Path: *configPath, Env: os.Environ()})
 	if err != nil {
-		// Fallback to default config
-		cfg = config.DefaultConfig()
+		fmt.Fprintf(os.Stderr, "av1top: invalid configuration:\n%v\n", err)
+		os.Exit(1)
 	}
 
 	// Create TUI model
@@ -143,8 +143,13 @@ User=${APP_USER}
 Group=${APP_GROUP}
 WorkingDirectory=${DATA_DIR}
 ExecStart=${BIN_DIR}/av1d
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
 RestartSec=10
+# Let av1d stop ffmpeg itself and roll back interrupted jobs;
+# keep TimeoutStopSec above shutdown_grace_sec
+KillMode=mixed
+TimeoutStopSec=120
 StandardOutput=journal
 StandardError=journal
 
@@ -176,7 +181,17 @@ cat > "${CONFIG_DIR}/config.json" <<EOF
   "min_bytes": 2147483648,
   "max_size_ratio": 0.90,
   "job_state_dir": "${DATA_DIR}/jobs",
-  "scan_interval_sec": 60
+  "scan_interval_sec": 60,
+  "stable_quiet_sec": 30,
+  "max_attempts": 5,
+  "free_space_margin": 5368709120,
+  "control_socket": "${DATA_DIR}/av1d.sock",
+  "control_socket_mode": "0660",
+  "control_socket_group": "${APP_GROUP}",
+  "http_listen": "",
+  "schedule": {"windows": [], "on_close": "finish"},
+  "throttle": {"max_load": 0, "max_temp_c": 0, "pause_running": false, "interval_sec": 10},
+  "notifications": []
 }
 EOF
 
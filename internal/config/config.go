@@ -1,20 +1,172 @@
 package config
 
 import (
-	"encoding/json"
+	"net/url"
 	"os"
 	"path/filepath"
 )
 
 // TranscodeConfig holds configuration for the AV1 transcoding daemon.
 type TranscodeConfig struct {
-	FFmpegURL        string   `json:"ffmpeg_url"`
-	FFmpegInstallDir string   `json:"ffmpeg_install_dir"`
-	LibraryRoots     []string `json:"library_roots"`
-	MinBytes         int64    `json:"min_bytes"`          // e.g. 2 GiB
-	MaxSizeRatio     float64  `json:"max_size_ratio"`     // e.g. 0.90
-	JobStateDir      string   `json:"job_state_dir"`
-	ScanIntervalSec  int      `json:"scan_interval_sec"`  // e.g. 60
+	FFmpegURL           string   `json:"ffmpeg_url"`
+	FFmpegInstallDir    string   `json:"ffmpeg_install_dir"`
+	LibraryRoots        []string `json:"library_roots"`  // roots using the default profile
+	MinBytes            int64    `json:"min_bytes"`      // e.g. 2 GiB
+	MaxSizeRatio        float64  `json:"max_size_ratio"` // e.g. 0.90
+	JobStateDir         string   `json:"job_state_dir"`
+	ScanIntervalSec     int      `json:"scan_interval_sec"`      // e.g. 60
+	DisableWatch        bool     `json:"disable_watch"`          // turn off inotify watching, rely on rescans only
+	WatchDebounceSec    int      `json:"watch_debounce_sec"`     // quiet period before a watched file is judged, e.g. 10
+	StableQuietSec      int      `json:"stable_quiet_sec"`       // how long a file must stay unchanged before it is encoded, e.g. 30
+	RenderNodes         []string `json:"render_nodes"`           // GPUs to encode on, empty = auto-detect
+	MaxEncodesPerDevice int      `json:"max_encodes_per_device"` // concurrent transcodes per render node, e.g. 2 on Arc
+	MaxConcurrentProbes int      `json:"max_concurrent_probes"`  // concurrent ffprobe runs, e.g. 2
+	ShutdownGraceSec    int      `json:"shutdown_grace_sec"`     // how long running encodes may finish on shutdown, e.g. 60
+	MaxAttempts         int      `json:"max_attempts"`           // failed attempts before a job is parked, e.g. 5
+	FreeSpaceMargin     int64    `json:"free_space_margin"`      // kept free on top of a job's estimated output, e.g. 5 GiB
+	QuarantineDir       string   `json:"quarantine_dir"`         // where orphaned temp outputs are moved at startup, empty = delete
+	ControlSocket       string   `json:"control_socket"`         // Unix socket for the control API, empty = disabled
+	ControlSocketMode   string   `json:"control_socket_mode"`    // octal file mode, e.g. "0660"
+	ControlSocketGroup  string   `json:"control_socket_group"`   // group owning the socket, e.g. "media"
+	HTTPListen          string   `json:"http_listen"`            // address for the HTTP API, e.g. "127.0.0.1:8787", empty = disabled
+	Extensions          []string `json:"extensions"`             // media files to judge, e.g. [".mkv", ".mp4"]
+	Include             []string `json:"include"`                // globs; if set, only matching files are judged, e.g. ["Movies/**"]
+	Exclude             []string `json:"exclude"`                // globs never judged, e.g. ["Extras", "Sample", "TV/Some Show"]
+	IncludeRegex        []string `json:"include_regex"`          // like include, as regular expressions
+	ExcludeRegex        []string `json:"exclude_regex"`          // like exclude, e.g. ["(?i)\\bsample\\b"]
+
+	Libraries     []LibraryConfig          `json:"libraries"`     // roots with a named profile, in addition to library_roots
+	Profiles      map[string]ProfileConfig `json:"profiles"`      // rules and encode settings by name, see ProfileFor
+	Rules         []RuleConfig             `json:"rules"`         // candidate selection rules, the first that matches decides
+	Schedule      ScheduleConfig           `json:"schedule"`      // when encodes may run, empty = any time
+	Throttle      ThrottleConfig           `json:"throttle"`      // host limits that hold back or pause encodes
+	Notifications []NotifierConfig         `json:"notifications"` // webhooks to notify about job outcomes
+}
+
+// LibraryConfig is a library root whose files are judged and encoded with a
+// named profile.
+type LibraryConfig struct {
+	Root         string   `json:"root"`          // e.g. "/media/anime"
+	Profile      string   `json:"profile"`       // key in profiles, e.g. "anime"; empty = default
+	Extensions   []string `json:"extensions"`    // replaces the global list for this root
+	Include      []string `json:"include"`       // added to the global include rules for this root
+	Exclude      []string `json:"exclude"`       // added to the global exclude rules for this root
+	IncludeRegex []string `json:"include_regex"` // added to the global include_regex for this root
+	ExcludeRegex []string `json:"exclude_regex"` // added to the global exclude_regex for this root
+}
+
+// ProfileConfig overrides the global rules and encode settings for the
+// libraries using it. Missing keys, and zero values other than min_bytes,
+// inherit.
+type ProfileConfig struct {
+	MinBytes              *int64             `json:"min_bytes"`               // files this size or smaller are skipped, e.g. 1 GiB; 0 judges every size
+	MaxSizeRatio          float64            `json:"max_size_ratio"`          // e.g. 0.85
+	Quality               []QualityStep      `json:"quality"`                 // global_quality by source height; empty = built-in 23/24/25
+	CompressionLevel      int                `json:"compression_level"`       // encoder speed/quality trade-off, 1 (best) to 7 (fastest), e.g. 2
+	ExtraArgs             []string           `json:"extra_args"`              // extra ffmpeg output options, e.g. ["-g", "240"]
+	AudioLanguages        []string           `json:"audio_languages"`         // keep only these audio languages when present, e.g. ["jpn", "eng"]
+	DropAudioLanguages    []string           `json:"drop_audio_languages"`    // e.g. ["rus", "ru"] (the default)
+	SubtitleLanguages     []string           `json:"subtitle_languages"`      // keep only these subtitle languages when present
+	DropSubtitleLanguages []string           `json:"drop_subtitle_languages"` // e.g. ["rus", "ru"] (the default)
+	UntaggedTracks        string             `json:"untagged_tracks"`         // audio and subtitle tracks without a language: "keep" (default) or "drop"
+	CommentaryTracks      string             `json:"commentary_tracks"`       // audio and subtitle commentary tracks: "keep" (default) or "drop"
+	WebSafe               string             `json:"web_safe"`                // WebRip timestamp fixes: "auto" (default, when detected), "always" or "never"
+	MinBitsPerPixel       map[string]float64 `json:"min_bits_per_pixel"`      // skip sources already this efficient, by codec, e.g. {"hevc": 0.06}; 0 turns a codec's check off
+	Encoder               string             `json:"encoder"`                 // "av1_vaapi" (default), "av1_qsv" or "libsvtav1"
+	DynamicHDR            string             `json:"dynamic_hdr"`             // Dolby Vision and HDR10+ sources: "skip" (default), "base_layer" or "allow"
+}
+
+// RuleConfig is a candidate selection rule, tried on every probed file that
+// passed min_bytes and is not AV1 yet.
+type RuleConfig struct {
+	Name    string `json:"name"`    // shown in reasons, e.g. "efficient hevc"
+	When    string `json:"when"`    // expression, e.g. "codec in [h264, mpeg2video] && bitrate_kbps > 8000"
+	Action  string `json:"action"`  // "accept", "skip" or "profile"
+	Profile string `json:"profile"` // profile to encode with, for action "profile"
+	Reason  string `json:"reason"`  // written to the why file, empty = the rule's name and expression
+}
+
+// Rule actions for RuleConfig.Action.
+const (
+	RuleAccept  = "accept"
+	RuleSkip    = "skip"
+	RuleProfile = "profile"
+)
+
+// QualityStep sets the encoder quality for sources at least MinHeight tall.
+type QualityStep struct {
+	MinHeight int `json:"min_height"` // e.g. 1440
+	Quality   int `json:"quality"`    // global_quality, lower is better, e.g. 23
+}
+
+// ScheduleConfig restricts encoding to time windows.
+type ScheduleConfig struct {
+	Windows []ScheduleWindow `json:"windows"`  // empty = encode any time
+	OnClose string           `json:"on_close"` // what running jobs do when a window closes: "finish" (default) or "pause"
+}
+
+// ScheduleWindow is a daily time range in which new jobs may start.
+type ScheduleWindow struct {
+	Days          []string `json:"days"`           // e.g. ["mon", "tue"], "weekdays" or "weekends"; empty = every day
+	Start         string   `json:"start"`          // local time, e.g. "22:00"
+	End           string   `json:"end"`            // e.g. "07:00"; before start means the next morning
+	MaxConcurrent int      `json:"max_concurrent"` // running jobs allowed in this window, 0 = all encode slots
+	Nice          int      `json:"nice"`           // ffmpeg nice level in this window, e.g. 10; 0 = unchanged
+}
+
+// ThrottleConfig holds back new jobs, and optionally pauses running ones,
+// while the host is busy or hot. A zero limit is not checked.
+type ThrottleConfig struct {
+	MaxLoad          float64  `json:"max_load"`           // 1-minute load average per CPU core, e.g. 0.9
+	MaxMemoryPercent float64  `json:"max_memory_percent"` // e.g. 90
+	MaxGPUPercent    float64  `json:"max_gpu_percent"`    // GPU busy from other processes such as Plex, e.g. 20
+	MaxTempC         float64  `json:"max_temp_c"`         // hottest watched hwmon sensor, e.g. 85
+	TempSensors      []string `json:"temp_sensors"`       // hwmon chips to watch, e.g. ["coretemp", "i915"]; empty = all
+	PauseRunning     bool     `json:"pause_running"`      // also stop running encodes with SIGSTOP while over a limit
+	IntervalSec      int      `json:"interval_sec"`       // how often to sample, e.g. 10
+}
+
+// NotifierConfig configures one notification target.
+type NotifierConfig struct {
+	Name            string            `json:"name"`             // shown in logs, e.g. "phone"
+	URL             string            `json:"url"`              // e.g. "https://ntfy.sh/my-av1d" or "https://gotify.lan/message"
+	Format          string            `json:"format"`           // "json" (default), "ntfy", "gotify" or "discord"
+	Token           string            `json:"token"`            // ntfy access token or Gotify app token
+	Headers         map[string]string `json:"headers"`          // extra HTTP headers
+	Events          []string          `json:"events"`           // job_success, job_failed, size_gate, selftest_failed; empty = all
+	MessageTemplate string            `json:"message_template"` // Go text/template for the message body, empty = built-in
+	DigestSec       int               `json:"digest_sec"`       // batch job events into one summary per period, e.g. 3600; 0 = send each
+}
+
+// redacted replaces secrets in Redacted.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of the configuration without the notifier secrets:
+// tokens, header values and webhook URL paths and queries, which carry the
+// token for Discord and the topic for ntfy. It is what the control socket
+// shows, since its users may not be able to read the config file.
+func (cfg TranscodeConfig) Redacted() TranscodeConfig {
+	notifiers := make([]NotifierConfig, len(cfg.Notifications))
+	for i, n := range cfg.Notifications {
+		if n.Token != "" {
+			n.Token = redacted
+		}
+		if len(n.Headers) > 0 {
+			headers := make(map[string]string, len(n.Headers))
+			for k := range n.Headers {
+				headers[k] = redacted
+			}
+			n.Headers = headers
+		}
+		if u, err := url.Parse(n.URL); err != nil {
+			n.URL = redacted
+		} else if u.User != nil || u.Path != "" || u.RawQuery != "" {
+			n.URL = (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + redacted}).String()
+		}
+		notifiers[i] = n
+	}
+	cfg.Notifications = notifiers
+	return cfg
 }
 
 // DefaultConfig returns a configuration with sensible defaults.
@@ -30,30 +182,24 @@ func DefaultConfig() TranscodeConfig {
 	jobsDir := filepath.Join(dataDir, "jobs")
 
 	return TranscodeConfig{
-		FFmpegURL:        "https://github.com/BtbN/FFmpeg-Builds/releases/download/latest/ffmpeg-n8.0-latest-linux64-gpl-8.0.tar.xz",
-		FFmpegInstallDir: ffmpegDir,
-		LibraryRoots:     []string{}, // Empty by default, to be configured
-		MinBytes:         2 * 1024 * 1024 * 1024, // 2 GiB
-		MaxSizeRatio:     0.90,
-		JobStateDir:      jobsDir,
-		ScanIntervalSec:  60,
+		FFmpegURL:           "https://github.com/BtbN/FFmpeg-Builds/releases/download/latest/ffmpeg-n8.0-latest-linux64-gpl-8.0.tar.xz",
+		FFmpegInstallDir:    ffmpegDir,
+		LibraryRoots:        []string{},             // Empty by default, to be configured
+		MinBytes:            2 * 1024 * 1024 * 1024, // 2 GiB
+		MaxSizeRatio:        0.90,
+		JobStateDir:         jobsDir,
+		ScanIntervalSec:     60,
+		WatchDebounceSec:    10,
+		StableQuietSec:      30,
+		RenderNodes:         []string{}, // Auto-detect
+		MaxEncodesPerDevice: 1,
+		MaxConcurrentProbes: 2,
+		ShutdownGraceSec:    60,
+		MaxAttempts:         5,
+		FreeSpaceMargin:     5 * 1024 * 1024 * 1024, // 5 GiB
+		ControlSocket:       filepath.Join(dataDir, "av1d.sock"),
+		ControlSocketMode:   "0660",
+		Extensions:          []string{".mkv", ".mp4", ".m4v", ".ts", ".m2ts", ".avi", ".wmv", ".mov"},
+		Throttle:            ThrottleConfig{IntervalSec: 10},
 	}
 }
-
-// LoadConfig loads configuration from a JSON file path.
-// If the file doesn't exist or can't be read, returns an error.
-// Callers should fall back to DefaultConfig() if needed.
-func LoadConfig(path string) (TranscodeConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return TranscodeConfig{}, err
-	}
-
-	var cfg TranscodeConfig
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return TranscodeConfig{}, err
-	}
-
-	return cfg, nil
-}
-
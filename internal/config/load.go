@@ -0,0 +1,250 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DefaultPath is where the binaries look for the configuration file when
+// none is given.
+const DefaultPath = "/etc/av1qsvd/config.json"
+
+// EnvPrefix starts the environment variables that override config keys.
+// AV1D_MIN_BYTES sets min_bytes; a double underscore reaches into a nested
+// section, e.g. AV1D_THROTTLE__MAX_LOAD sets throttle.max_load.
+const EnvPrefix = "AV1D_"
+
+// ErrUnknownKey is returned by Set for a key that is not in the config.
+var ErrUnknownKey = errors.New("unknown config key")
+
+// EnvConfigPath names the configuration file when no path is given on the
+// command line.
+const EnvConfigPath = EnvPrefix + "CONFIG"
+
+// ownEnv lists the AV1D_* variables the binaries read themselves; every
+// other AV1D_* variable must name a config key.
+var ownEnv = map[string]bool{EnvConfigPath: true}
+
+// Sources says where Load takes the configuration from.
+type Sources struct {
+	Path      string   // config file; empty = $AV1D_CONFIG, else DefaultPath if it exists
+	Env       []string // environment as from os.Environ
+	Overrides []string // key=value pairs from the command line, e.g. "throttle.max_load=0.8"
+}
+
+// Load builds the effective configuration by layering the defaults, the
+// config file, AV1D_* environment variables and command-line overrides, in
+// that order, and validates the result.
+//
+// A config file that was named explicitly must exist. Unknown keys in the
+// file, the AV1D_* variables and the overrides are an error rather than
+// being ignored, so a misspelt key can't silently leave a default in place.
+func Load(src Sources) (TranscodeConfig, string, error) {
+	cfg := DefaultConfig()
+
+	path, explicit := src.Path, src.Path != ""
+	if !explicit {
+		if env := lookupEnv(src.Env, EnvConfigPath); env != "" {
+			path, explicit = env, true
+		} else {
+			path = DefaultPath
+		}
+	}
+	if err := loadFile(&cfg, path); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			return TranscodeConfig{}, path, err
+		}
+		// No config file: run on defaults
+		path = ""
+	}
+
+	for _, kv := range src.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || ownEnv[name] {
+			continue
+		}
+		key := strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(name, EnvPrefix), "__", "."))
+		if err := Set(&cfg, key, value); err != nil {
+			return TranscodeConfig{}, path, fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+
+	for _, kv := range src.Overrides {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return TranscodeConfig{}, path, fmt.Errorf("override %q: expected key=value", kv)
+		}
+		if err := Set(&cfg, key, value); err != nil {
+			return TranscodeConfig{}, path, fmt.Errorf("override %q: %w", kv, err)
+		}
+	}
+
+	if err := Validate(cfg); err != nil {
+		return TranscodeConfig{}, path, err
+	}
+	return cfg, path, nil
+}
+
+// LoadConfig loads configuration from a JSON file path on top of the
+// defaults, so keys missing from the file keep their default values.
+// Unknown keys are an error. The result is not validated; see Load.
+func LoadConfig(path string) (TranscodeConfig, error) {
+	cfg := DefaultConfig()
+	if err := loadFile(&cfg, path); err != nil {
+		return TranscodeConfig{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a JSON config file over cfg.
+func loadFile(cfg *TranscodeConfig, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, col := position(data, syntaxErr.Offset)
+			return fmt.Errorf("%s:%d:%d: %v", path, line, col, err)
+		case errors.As(err, &typeErr):
+			line, col := position(data, typeErr.Offset)
+			return fmt.Errorf("%s:%d:%d: %s must be %s, not %s", path, line, col, typeErr.Field, describeType(typeErr.Type), typeErr.Value)
+		}
+		// Unknown keys: the decoder reads on to the end of the object, so
+		// point at the first occurrence of the key instead
+		if key, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			offset := int64(bytes.Index(data, []byte(key)))
+			if offset < 0 {
+				offset = dec.InputOffset()
+			}
+			line, col := position(data, offset)
+			return fmt.Errorf("%s:%d:%d: unknown config key %s", path, line, col, key)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// position converts a byte offset into a 1-based line and column.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// describeType names a config value type for error messages.
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int64:
+		return "a whole number"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return t.String()
+}
+
+func lookupEnv(env []string, name string) string {
+	for _, kv := range env {
+		if k, v, _ := strings.Cut(kv, "="); k == name {
+			return v
+		}
+	}
+	return ""
+}
+
+// Set changes one config key, given by its JSON name, from a string. Nested
+// keys are dotted, e.g. "schedule.on_close". Lists take comma-separated
+// values. Lists of sections, such as notifications, can only be set in the
+// config file.
+func Set(cfg *TranscodeConfig, key, value string) error {
+	field, err := lookupKey(reflect.ValueOf(cfg).Elem(), key, key)
+	if err != nil {
+		return err
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", key, value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a whole number, got %q", key, value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be a number, got %q", key, value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s can only be set in the config file", key)
+		}
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("%s can only be set in the config file", key)
+	}
+	return nil
+}
+
+// lookupKey finds the struct field for a dotted JSON key. full is the whole
+// key, for error messages.
+func lookupKey(v reflect.Value, key, full string) (reflect.Value, error) {
+	name, rest, nested := strings.Cut(key, ".")
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag != name {
+			continue
+		}
+		field := v.Field(i)
+		if !nested {
+			if field.Kind() == reflect.Struct {
+				return reflect.Value{}, fmt.Errorf("%s is a section, set one of its keys, e.g. %s.<key>", full, full)
+			}
+			return field, nil
+		}
+		if field.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%w %q", ErrUnknownKey, full)
+		}
+		return lookupKey(field, rest, full)
+	}
+	return reflect.Value{}, fmt.Errorf("%w %q", ErrUnknownKey, full)
+}
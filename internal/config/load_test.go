@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"min_bytes": 1000, "throttle": {"max_load": 0.5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		env       []string
+		overrides []string
+		err       string // substring of the error, "" = success
+		check     func(TranscodeConfig) bool
+	}{
+		{
+			name:  "file",
+			check: func(cfg TranscodeConfig) bool { return cfg.MinBytes == 1000 && cfg.Throttle.MaxLoad == 0.5 },
+		},
+		{
+			name:  "env over file",
+			env:   []string{"AV1D_MIN_BYTES=2000", "AV1D_THROTTLE__MAX_LOAD=0.8", "HOME=/root"},
+			check: func(cfg TranscodeConfig) bool { return cfg.MinBytes == 2000 && cfg.Throttle.MaxLoad == 0.8 },
+		},
+		{
+			name:      "override over env",
+			env:       []string{"AV1D_MIN_BYTES=2000"},
+			overrides: []string{"min_bytes=3000"},
+			check:     func(cfg TranscodeConfig) bool { return cfg.MinBytes == 3000 },
+		},
+		{
+			name:  "config path env is not a key",
+			env:   []string{"AV1D_CONFIG=" + path, "AV1D_MIN_BYTES=2000"},
+			check: func(cfg TranscodeConfig) bool { return cfg.MinBytes == 2000 },
+		},
+		{
+			name: "unknown env",
+			env:  []string{"AV1D_MIN_BYTES=2000", "AV1D_MIN_BYTE=3000"},
+			err:  `environment variable AV1D_MIN_BYTE: unknown config key "min_byte"`,
+		},
+		{
+			name: "unknown env in a section",
+			env:  []string{"AV1D_THROTTLE__NOPE=1"},
+			err:  "AV1D_THROTTLE__NOPE",
+		},
+		{
+			name: "bad env value",
+			env:  []string{"AV1D_MIN_BYTES=lots"},
+			err:  "AV1D_MIN_BYTES",
+		},
+		{
+			name:      "unknown override",
+			overrides: []string{"legacy_qsv=1"},
+			err:       `unknown config key "legacy_qsv"`,
+		},
+		{
+			name:      "invalid result",
+			overrides: []string{"max_size_ratio=2"},
+			err:       "max_size_ratio",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := Load(Sources{Path: path, Env: tt.env, Overrides: tt.overrides})
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Load error = %v, want one mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("Load gave min_bytes %d, throttle.max_load %g", cfg.MinBytes, cfg.Throttle.MaxLoad)
+			}
+		})
+	}
+}
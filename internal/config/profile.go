@@ -0,0 +1,277 @@
+package config
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile names the profile of roots in library_roots and of
+// libraries without a profile. A "default" entry in profiles changes it, and
+// every other profile builds on it.
+const DefaultProfile = "default"
+
+// Policies for ProfileConfig.DynamicHDR, for Dolby Vision and HDR10+
+// sources.
+const (
+	DynamicHDRSkip      = "skip"       // leave the file alone
+	DynamicHDRBaseLayer = "base_layer" // encode the HDR10 base layer, dropping the dynamic metadata
+	DynamicHDRAllow     = "allow"      // encode as any other file
+)
+
+// Encoders for ProfileConfig.Encoder, as ffmpeg names them.
+const (
+	EncoderVAAPI = "av1_vaapi" // on the GPU through VAAPI, the default
+	EncoderQSV   = "av1_qsv"   // on the GPU through oneVPL
+	EncoderSVT   = "libsvtav1" // SVT-AV1 on the CPU
+)
+
+// Track modes for ProfileConfig.UntaggedTracks and CommentaryTracks.
+const (
+	TracksKeep = "keep"
+	TracksDrop = "drop"
+)
+
+// Web-safe modes for ProfileConfig.WebSafe.
+const (
+	WebSafeAuto   = "auto"
+	WebSafeAlways = "always"
+	WebSafeNever  = "never"
+)
+
+// builtinProfile is the profile before any profiles entry applies.
+func (cfg TranscodeConfig) builtinProfile() ProfileConfig {
+	return ProfileConfig{
+		MinBytes:              &cfg.MinBytes,
+		MaxSizeRatio:          cfg.MaxSizeRatio,
+		CompressionLevel:      2,
+		DropAudioLanguages:    []string{"rus", "ru"},
+		DropSubtitleLanguages: []string{"rus", "ru"},
+		UntaggedTracks:        TracksKeep,
+		CommentaryTracks:      TracksKeep,
+		WebSafe:               WebSafeAuto,
+		MinBitsPerPixel:       map[string]float64{"hevc": 0.06, "vp9": 0.06, "h264": 0.04},
+		Encoder:               EncoderVAAPI,
+		DynamicHDR:            DynamicHDRSkip,
+	}
+}
+
+// Roots returns every library root: library_roots followed by the roots in
+// libraries.
+func (cfg TranscodeConfig) Roots() []string {
+	roots := append([]string{}, cfg.LibraryRoots...)
+	for _, lib := range cfg.Libraries {
+		roots = append(roots, lib.Root)
+	}
+	return roots
+}
+
+// PathRules choose the files judged under one library root.
+type PathRules struct {
+	Extensions   []string
+	Include      []string
+	Exclude      []string
+	IncludeRegex []string
+	ExcludeRegex []string
+}
+
+// RootRules returns the path rules for every library root: the global ones,
+// plus those of the root's libraries entry.
+func (cfg TranscodeConfig) RootRules() map[string]PathRules {
+	global := PathRules{
+		Extensions:   cfg.Extensions,
+		Include:      cfg.Include,
+		Exclude:      cfg.Exclude,
+		IncludeRegex: cfg.IncludeRegex,
+		ExcludeRegex: cfg.ExcludeRegex,
+	}
+	rules := make(map[string]PathRules)
+	for _, root := range cfg.LibraryRoots {
+		rules[root] = global
+	}
+	for _, lib := range cfg.Libraries {
+		r := PathRules{
+			Extensions:   global.Extensions,
+			Include:      concat(global.Include, lib.Include),
+			Exclude:      concat(global.Exclude, lib.Exclude),
+			IncludeRegex: concat(global.IncludeRegex, lib.IncludeRegex),
+			ExcludeRegex: concat(global.ExcludeRegex, lib.ExcludeRegex),
+		}
+		if len(lib.Extensions) > 0 {
+			r.Extensions = lib.Extensions
+		}
+		rules[lib.Root] = r
+	}
+	return rules
+}
+
+func concat(a, b []string) []string {
+	return append(append([]string{}, a...), b...)
+}
+
+// ProfileFor returns the name and effective settings of the profile for a
+// file, taken from the library with the longest root containing it.
+func (cfg TranscodeConfig) ProfileFor(path string) (string, ProfileConfig) {
+	name := cfg.libraryProfile(path)
+	return name, cfg.Profile(name)
+}
+
+// libraryProfile returns the profile name of the library containing a file.
+func (cfg TranscodeConfig) libraryProfile(path string) string {
+	name, longest := DefaultProfile, -1
+	for _, lib := range cfg.Libraries {
+		root := filepath.Clean(lib.Root)
+		if len(root) > longest && Within(path, root) {
+			name, longest = lib.Profile, len(root)
+			if name == "" {
+				name = DefaultProfile
+			}
+		}
+	}
+	for _, root := range cfg.LibraryRoots {
+		root = filepath.Clean(root)
+		if len(root) > longest && Within(path, root) {
+			name, longest = DefaultProfile, len(root)
+		}
+	}
+	return name
+}
+
+// Profile returns the effective settings of a named profile. Unknown names
+// get the default profile.
+func (cfg TranscodeConfig) Profile(name string) ProfileConfig {
+	profile := cfg.builtinProfile()
+	if base, ok := cfg.Profiles[DefaultProfile]; ok {
+		profile = base.over(profile)
+	}
+	if name != DefaultProfile {
+		profile = cfg.Profiles[name].over(profile)
+	}
+	return profile
+}
+
+// ProfileNames returns the configured profile names, sorted.
+func (cfg TranscodeConfig) ProfileNames() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Encoders returns the encoders of the default and every configured
+// profile, sorted and without duplicates.
+func (cfg TranscodeConfig) Encoders() []string {
+	seen := map[string]bool{cfg.Profile(DefaultProfile).Encoder: true}
+	for name := range cfg.Profiles {
+		seen[cfg.Profile(name).Encoder] = true
+	}
+	encoders := make([]string, 0, len(seen))
+	for name := range seen {
+		encoders = append(encoders, name)
+	}
+	sort.Strings(encoders)
+	return encoders
+}
+
+// Within reports whether path is root or lies beneath it.
+func Within(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/")
+}
+
+// over returns p with its unset fields taken from base.
+func (p ProfileConfig) over(base ProfileConfig) ProfileConfig {
+	if p.MinBytes == nil {
+		p.MinBytes = base.MinBytes
+	}
+	if p.MaxSizeRatio == 0 {
+		p.MaxSizeRatio = base.MaxSizeRatio
+	}
+	if p.Quality == nil {
+		p.Quality = base.Quality
+	}
+	if p.CompressionLevel == 0 {
+		p.CompressionLevel = base.CompressionLevel
+	}
+	if p.ExtraArgs == nil {
+		p.ExtraArgs = base.ExtraArgs
+	}
+	if p.AudioLanguages == nil {
+		p.AudioLanguages = base.AudioLanguages
+	}
+	if p.DropAudioLanguages == nil {
+		p.DropAudioLanguages = base.DropAudioLanguages
+	}
+	if p.SubtitleLanguages == nil {
+		p.SubtitleLanguages = base.SubtitleLanguages
+	}
+	if p.DropSubtitleLanguages == nil {
+		p.DropSubtitleLanguages = base.DropSubtitleLanguages
+	}
+	if p.UntaggedTracks == "" {
+		p.UntaggedTracks = base.UntaggedTracks
+	}
+	if p.CommentaryTracks == "" {
+		p.CommentaryTracks = base.CommentaryTracks
+	}
+	if p.WebSafe == "" {
+		p.WebSafe = base.WebSafe
+	}
+	if p.Encoder == "" {
+		p.Encoder = base.Encoder
+	}
+	if p.DynamicHDR == "" {
+		p.DynamicHDR = base.DynamicHDR
+	}
+	// Thresholds are merged by codec, so a profile can change one codec's
+	// threshold without repeating the others
+	merged := make(map[string]float64, len(base.MinBitsPerPixel)+len(p.MinBitsPerPixel))
+	for codec, bpp := range base.MinBitsPerPixel {
+		merged[codec] = bpp
+	}
+	for codec, bpp := range p.MinBitsPerPixel {
+		merged[strings.ToLower(codec)] = bpp
+	}
+	p.MinBitsPerPixel = merged
+	return p
+}
+
+// MinSize returns the size at or below which files are skipped.
+func (p ProfileConfig) MinSize() int64 {
+	if p.MinBytes == nil {
+		return 0
+	}
+	return *p.MinBytes
+}
+
+// QualityFor returns the encoder quality for a source height from the
+// profile's quality table, or false if the table has no step for it.
+func (p ProfileConfig) QualityFor(height int) (int, bool) {
+	best := -1
+	quality := 0
+	for _, step := range p.Quality {
+		if height >= step.MinHeight && step.MinHeight > best {
+			best, quality = step.MinHeight, step.Quality
+		}
+	}
+	return quality, best >= 0
+}
+
+// MinBitsPerPixelFor returns the efficiency threshold for a source codec,
+// or 0 if sources of that codec are never skipped as already efficient.
+func (p ProfileConfig) MinBitsPerPixelFor(codec string) float64 {
+	return p.MinBitsPerPixel[strings.ToLower(codec)]
+}
+
+// UseWebSafe reports whether the WebRip timestamp fixes apply to a file the
+// classifier did or did not find web-like.
+func (p ProfileConfig) UseWebSafe(webRipLike bool) bool {
+	switch p.WebSafe {
+	case WebSafeAlways:
+		return true
+	case WebSafeNever:
+		return false
+	}
+	return webRipLike
+}
@@ -0,0 +1,56 @@
+package config
+
+import "testing"
+
+func TestProfileInheritance(t *testing.T) {
+	zero, small := int64(0), int64(1<<20)
+	cfg := DefaultConfig()
+	cfg.MinBytes = 2 << 30
+	cfg.Libraries = []LibraryConfig{
+		{Root: "/media/tv", Profile: "tv"},
+		{Root: "/media/tv/kids", Profile: "all"},
+		{Root: "/media/movies"},
+	}
+	cfg.Profiles = map[string]ProfileConfig{
+		"tv":  {MinBytes: &small, CompressionLevel: 4},
+		"all": {MinBytes: &zero},
+	}
+
+	tests := []struct {
+		path        string
+		profile     string
+		minSize     int64
+		compression int
+	}{
+		{"/media/tv/show/e01.mkv", "tv", small, 4},
+		{"/media/tv/kids/e01.mkv", "all", 0, 2},
+		{"/media/tvshows/e01.mkv", DefaultProfile, 2 << 30, 2},
+		{"/media/movies/film.mkv", DefaultProfile, 2 << 30, 2},
+	}
+	for _, tt := range tests {
+		name, p := cfg.ProfileFor(tt.path)
+		if name != tt.profile || p.MinSize() != tt.minSize || p.CompressionLevel != tt.compression {
+			t.Errorf("ProfileFor(%s) = %s, min %d, compression %d; want %s, min %d, compression %d",
+				tt.path, name, p.MinSize(), p.CompressionLevel, tt.profile, tt.minSize, tt.compression)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		path, root string
+		want       bool
+	}{
+		{"/media/tv", "/media/tv", true},
+		{"/media/tv/a.mkv", "/media/tv", true},
+		{"/media/tv/a.mkv", "/media/tv/", true},
+		{"/media/tvshows/a.mkv", "/media/tv", false},
+		{"/media", "/media/tv", false},
+		{"/etc/passwd", "/", true},
+	}
+	for _, tt := range tests {
+		if got := Within(tt.path, tt.root); got != tt.want {
+			t.Errorf("Within(%q, %q) = %t, want %t", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Validate checks that every setting is in range and reports all problems
+// at once, one per line, each naming its config key.
+//
+// Schedules, throttling, notifications, include/exclude rules and rule
+// expressions are checked by the daemon when it builds them.
+func Validate(cfg TranscodeConfig) error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(cfg.FFmpegURL != "", "ffmpeg_url", "must not be empty")
+	check(cfg.FFmpegInstallDir != "", "ffmpeg_install_dir", "must not be empty")
+	check(cfg.JobStateDir != "", "job_state_dir", "must not be empty")
+
+	seen := make(map[string]bool)
+	for _, root := range cfg.LibraryRoots {
+		check(filepath.IsAbs(root), "library_roots", "%q must be an absolute path", root)
+		check(!seen[filepath.Clean(root)], "library_roots", "%q is listed twice", root)
+		seen[filepath.Clean(root)] = true
+	}
+	for i, lib := range cfg.Libraries {
+		key := fmt.Sprintf("libraries[%d]", i)
+		check(filepath.IsAbs(lib.Root), key+".root", "%q must be an absolute path", lib.Root)
+		check(!seen[filepath.Clean(lib.Root)], key+".root", "%q is already a library root", lib.Root)
+		seen[filepath.Clean(lib.Root)] = true
+		if _, ok := cfg.Profiles[lib.Profile]; lib.Profile != "" && lib.Profile != DefaultProfile {
+			check(ok, key+".profile", "no profile named %q in profiles", lib.Profile)
+		}
+	}
+	check(len(cfg.Extensions) > 0, "extensions", "must list at least one extension such as \".mkv\"")
+	for _, ext := range cfg.Extensions {
+		check(strings.HasPrefix(ext, ".") && len(ext) > 1, "extensions", "%q must start with a dot, e.g. \".mkv\"", ext)
+	}
+	for i, lib := range cfg.Libraries {
+		for _, ext := range lib.Extensions {
+			check(strings.HasPrefix(ext, ".") && len(ext) > 1, fmt.Sprintf("libraries[%d].extensions", i), "%q must start with a dot, e.g. \".mkv\"", ext)
+		}
+	}
+	for i, rule := range cfg.Rules {
+		key := fmt.Sprintf("rules[%d]", i)
+		check(rule.When != "", key+".when", "must not be empty")
+		switch rule.Action {
+		case RuleAccept, RuleSkip:
+		case RuleProfile:
+			_, ok := cfg.Profiles[rule.Profile]
+			check(ok || rule.Profile == DefaultProfile, key+".profile", "no profile named %q in profiles", rule.Profile)
+		default:
+			check(false, key+".action", "must be %q, %q or %q, got %q", RuleAccept, RuleSkip, RuleProfile, rule.Action)
+		}
+	}
+	for _, name := range cfg.ProfileNames() {
+		errs = append(errs, validateProfile("profiles."+name, cfg.Profiles[name])...)
+	}
+	for _, node := range cfg.RenderNodes {
+		check(filepath.IsAbs(node), "render_nodes", "%q must be an absolute path such as /dev/dri/renderD128", node)
+	}
+
+	check(cfg.MinBytes >= 0, "min_bytes", "must not be negative, got %d", cfg.MinBytes)
+	check(cfg.MaxSizeRatio > 0 && cfg.MaxSizeRatio <= 1, "max_size_ratio", "must be above 0 and at most 1, got %g", cfg.MaxSizeRatio)
+	check(cfg.ScanIntervalSec >= 1, "scan_interval_sec", "must be at least 1, got %d", cfg.ScanIntervalSec)
+	check(cfg.WatchDebounceSec >= 0, "watch_debounce_sec", "must not be negative, got %d", cfg.WatchDebounceSec)
+	check(cfg.StableQuietSec >= 0, "stable_quiet_sec", "must not be negative, got %d", cfg.StableQuietSec)
+	check(cfg.MaxEncodesPerDevice >= 1 && cfg.MaxEncodesPerDevice <= 16, "max_encodes_per_device", "must be between 1 and 16, got %d", cfg.MaxEncodesPerDevice)
+	check(cfg.MaxConcurrentProbes >= 1, "max_concurrent_probes", "must be at least 1, got %d", cfg.MaxConcurrentProbes)
+	check(cfg.ShutdownGraceSec >= 0, "shutdown_grace_sec", "must not be negative, got %d", cfg.ShutdownGraceSec)
+	check(cfg.MaxAttempts >= 1, "max_attempts", "must be at least 1, got %d", cfg.MaxAttempts)
+	check(cfg.FreeSpaceMargin >= 0, "free_space_margin", "must not be negative, got %d", cfg.FreeSpaceMargin)
+
+	if cfg.ControlSocketMode != "" {
+		mode, err := strconv.ParseUint(cfg.ControlSocketMode, 8, 32)
+		check(err == nil && mode <= 0777, "control_socket_mode", "must be an octal file mode such as \"0660\", got %q", cfg.ControlSocketMode)
+	}
+	if cfg.HTTPListen != "" {
+		_, _, err := net.SplitHostPort(cfg.HTTPListen)
+		check(err == nil, "http_listen", "must be host:port such as \"127.0.0.1:8787\", got %q", cfg.HTTPListen)
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateProfile checks the settings a profile overrides.
+func validateProfile(key string, p ProfileConfig) []error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s.%s: %s", key, field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(p.MinSize() >= 0, "min_bytes", "must not be negative, got %d", p.MinSize())
+	check(p.MaxSizeRatio >= 0 && p.MaxSizeRatio <= 1, "max_size_ratio", "must be between 0 and 1 (0 = inherit), got %g", p.MaxSizeRatio)
+	heights := make(map[int]bool)
+	for _, step := range p.Quality {
+		check(step.MinHeight >= 0, "quality", "min_height must not be negative, got %d", step.MinHeight)
+		check(step.Quality >= 1 && step.Quality <= 255, "quality", "quality must be between 1 and 255, got %d", step.Quality)
+		check(!heights[step.MinHeight], "quality", "min_height %d is listed twice", step.MinHeight)
+		heights[step.MinHeight] = true
+	}
+	if len(p.Quality) > 0 {
+		check(heights[0], "quality", "needs a step with min_height 0 so every source has a quality")
+	}
+	check(p.CompressionLevel >= 0 && p.CompressionLevel <= 7, "compression_level", "must be between 1 and 7 (0 = inherit), got %d", p.CompressionLevel)
+	for field, mode := range map[string]string{"untagged_tracks": p.UntaggedTracks, "commentary_tracks": p.CommentaryTracks} {
+		check(mode == "" || mode == TracksKeep || mode == TracksDrop, field, "must be %q or %q, got %q", TracksKeep, TracksDrop, mode)
+	}
+	switch p.WebSafe {
+	case "", WebSafeAuto, WebSafeAlways, WebSafeNever:
+	default:
+		check(false, "web_safe", "must be %q, %q or %q, got %q", WebSafeAuto, WebSafeAlways, WebSafeNever, p.WebSafe)
+	}
+	switch p.DynamicHDR {
+	case "", DynamicHDRSkip, DynamicHDRBaseLayer, DynamicHDRAllow:
+	default:
+		check(false, "dynamic_hdr", "must be %q, %q or %q, got %q", DynamicHDRSkip, DynamicHDRBaseLayer, DynamicHDRAllow, p.DynamicHDR)
+	}
+	switch p.Encoder {
+	case "", EncoderVAAPI, EncoderQSV, EncoderSVT:
+	default:
+		check(false, "encoder", "must be %q, %q or %q, got %q", EncoderVAAPI, EncoderQSV, EncoderSVT, p.Encoder)
+	}
+	for codec, bpp := range p.MinBitsPerPixel {
+		check(codec != "", "min_bits_per_pixel", "codec name must not be empty")
+		check(bpp >= 0 && bpp < 1, "min_bits_per_pixel", "%s must be at least 0 and below 1, got %g", codec, bpp)
+	}
+	return errs
+}
@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// Causes attached to a running job's context when a user stops it.
+var (
+	errCancelledByUser = errors.New("cancelled by user")
+	errSkippedByUser   = errors.New("skipped by user")
+)
+
+// QueueState summarizes the queue for the control API.
+type QueueState struct {
+	Paused   bool `json:"paused"`
+	Pending  int  `json:"pending"`
+	Waiting  int  `json:"waiting"` // pending jobs not yet eligible: backing off or still settling
+	Running  int  `json:"running"`
+	Total    int  `json:"total"`
+	Capacity int  `json:"capacity"` // encode slots across all devices
+}
+
+// Config returns the effective configuration the daemon is running with.
+func (d *Daemon) Config() config.TranscodeConfig {
+	return d.config()
+}
+
+// QueueState returns the current queue summary.
+func (d *Daemon) QueueState() QueueState {
+	pending := d.queue.Pending()
+	waiting := 0
+	now := time.Now()
+	for _, job := range pending {
+		if job.NextAttemptAt != nil && now.Before(*job.NextAttemptAt) {
+			waiting++
+		}
+	}
+	return QueueState{
+		Paused:   d.queue.Paused(),
+		Pending:  len(pending),
+		Waiting:  waiting,
+		Running:  d.queue.Running(),
+		Total:    d.queue.Len(),
+		Capacity: d.limiter.Capacity(),
+	}
+}
+
+// EnqueuePath forces a media file into the queue. See Scanner.Enqueue.
+func (d *Daemon) EnqueuePath(path string) (jobs.Job, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return d.scanner.Enqueue(abs)
+}
+
+// CancelJob stops a job. A running job has its ffmpeg stopped and output
+// deleted; a pending job is taken out of the queue. Either way the job ends
+// up skipped, and is re-judged the next time the file changes.
+func (d *Daemon) CancelJob(id string) (jobs.Job, error) {
+	if d.stopRunning(id, errCancelledByUser) {
+		return d.waitSettled(id), nil
+	}
+	if job, ok := d.queue.Get(id); ok && job.Status != jobs.JobStatusPending {
+		return jobs.Job{}, fmt.Errorf("job %s is %s, only pending or running jobs can be cancelled", id, job.Status)
+	}
+	return d.queue.UpdateByID(id, func(job *jobs.Job) {
+		now := time.Now()
+		job.Status = jobs.JobStatusSkipped
+		job.Reason = errCancelledByUser.Error()
+		job.FinishedAt = &now
+	})
+}
+
+// SkipJob permanently skips a job's file by writing its .av1qsvd-skip marker.
+// A running job is stopped first.
+func (d *Daemon) SkipJob(id string) (jobs.Job, error) {
+	if d.stopRunning(id, errSkippedByUser) {
+		return d.waitSettled(id), nil
+	}
+	return d.queue.UpdateByID(id, func(job *jobs.Job) {
+		markSkippedByUser(job)
+	})
+}
+
+// RetryJob puts a failed or skipped job back to pending, removing any
+// .av1qsvd-skip marker so the scanner won't drop it again. A pending job
+// waiting for a retry is made eligible right away. Either way the attempt
+// count starts over.
+func (d *Daemon) RetryJob(id string) (jobs.Job, error) {
+	job, ok := d.queue.Get(id)
+	if !ok {
+		return jobs.Job{}, fmt.Errorf("job %s not found", id)
+	}
+	waiting := job.Status == jobs.JobStatusPending && job.NextAttemptAt != nil
+	if job.Status != jobs.JobStatusFailed && job.Status != jobs.JobStatusSkipped && !waiting {
+		return jobs.Job{}, fmt.Errorf("job %s is %s, only failed, skipped or backing-off jobs can be retried", id, job.Status)
+	}
+
+	os.Remove(SkipMarkerPath(job.SourcePath))
+	d.scanner.Forget(job.SourcePath)
+	return d.queue.UpdateByID(id, func(job *jobs.Job) {
+		job.Status = jobs.JobStatusPending
+		job.Reason = ""
+		job.StartedAt = nil
+		job.FinishedAt = nil
+		resetRetries(job)
+	})
+}
+
+// DeleteJob forgets a job that is not running: its record is removed from
+// the queue and the job state directory. The file is judged afresh when it
+// next changes or on a full rescan.
+func (d *Daemon) DeleteJob(id string) (jobs.Job, error) {
+	job, err := d.queue.Delete(id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	log.Printf("Job %s deleted: %s", id, job.SourcePath)
+	return job, nil
+}
+
+// SetPriority changes the order a pending job runs in; higher runs first.
+func (d *Daemon) SetPriority(id string, priority int) (jobs.Job, error) {
+	if job, ok := d.queue.Get(id); ok && job.Status != jobs.JobStatusPending {
+		return jobs.Job{}, fmt.Errorf("job %s is %s, only pending jobs can be reprioritized", id, job.Status)
+	}
+	return d.queue.UpdateByID(id, func(job *jobs.Job) {
+		job.Priority = priority
+	})
+}
+
+// PauseQueue stops new jobs from starting. Running jobs finish normally.
+func (d *Daemon) PauseQueue() {
+	d.queue.Pause()
+	log.Printf("Queue paused")
+}
+
+// ResumeQueue lets new jobs start again.
+func (d *Daemon) ResumeQueue() {
+	d.queue.Resume()
+	log.Printf("Queue resumed")
+}
+
+// TriggerScan asks the daemon to rescan the library roots now.
+// A full rescan re-judges every file, not just the ones that changed.
+func (d *Daemon) TriggerScan(full bool) {
+	select {
+	case d.rescan <- full:
+	default:
+		// A rescan is already pending
+	}
+}
+
+// stopRunning cancels a running job with the given cause.
+// Returns false if the job is not running.
+func (d *Daemon) stopRunning(id string, cause error) bool {
+	d.mu.Lock()
+	cancel, ok := d.running[id]
+	d.mu.Unlock()
+	if !ok {
+		return false
+	}
+	log.Printf("Stopping job %s: %v", id, cause)
+	cancel(cause)
+	return true
+}
+
+// waitSettled waits briefly for a stopped job to be released by its worker
+// and returns its latest state.
+func (d *Daemon) waitSettled(id string) jobs.Job {
+	deadline := time.Now().Add(15 * time.Second)
+	for time.Now().Before(deadline) {
+		d.mu.Lock()
+		_, running := d.running[id]
+		d.mu.Unlock()
+		if !running {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	job, _ := d.queue.Get(id)
+	return job
+}
+
+// finishInterrupted records the final state of a job whose context was
+// cancelled. ProcessJob has already rolled it back to pending; a user cancel
+// or skip turns that into skipped.
+func (d *Daemon) finishInterrupted(ctx context.Context, job *jobs.Job) {
+	switch cause := context.Cause(ctx); cause {
+	case errCancelledByUser:
+		now := time.Now()
+		job.Status = jobs.JobStatusSkipped
+		job.Reason = cause.Error()
+		job.FinishedAt = &now
+		d.queue.Save(job)
+		log.Printf("Job %s cancelled by user", job.ID)
+	case errSkippedByUser:
+		markSkippedByUser(job)
+		d.queue.Save(job)
+		log.Printf("Job %s skipped by user", job.ID)
+	default:
+		log.Printf("Job %s returned to pending: %v", job.ID, cause)
+	}
+}
+
+// markSkippedByUser marks a job skipped and writes its .av1qsvd-skip marker.
+func markSkippedByUser(job *jobs.Job) {
+	now := time.Now()
+	job.Status = jobs.JobStatusSkipped
+	job.Reason = errSkippedByUser.Error()
+	job.FinishedAt = &now
+	if err := WriteSkipMarker(job.SourcePath); err != nil {
+		log.Printf("Warning: failed to write skip marker for %s: %v", job.SourcePath, err)
+	}
+}
@@ -0,0 +1,24 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+func TestSetPriority(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	pending := addJob(t, d.queue, "/lib/pending.mkv", jobs.JobStatusPending)
+	done := addJob(t, d.queue, "/lib/done.mkv", jobs.JobStatusSuccess)
+
+	job, err := d.SetPriority(pending.ID, 10)
+	if err != nil || job.Priority != 10 {
+		t.Errorf("SetPriority(pending) = priority %d, %v", job.Priority, err)
+	}
+	if _, err := d.SetPriority(done.ID, 10); err == nil {
+		t.Error("SetPriority changed a finished job")
+	}
+	if job, _ := d.queue.Get(done.ID); job.Priority != 0 {
+		t.Errorf("finished job priority %d", job.Priority)
+	}
+}
@@ -1,18 +1,61 @@
 package daemon
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/yourname/av1qsvd/internal/ffmpeg"
 	"github.com/yourname/av1qsvd/internal/jobs"
 	"github.com/yourname/av1qsvd/internal/metadata"
-	"github.com/yourname/av1qsvd/internal/scan"
 )
 
+// tempOutputSuffix is appended to a source file's name for its in-progress
+// AV1 output.
+const tempOutputSuffix = ".av1-tmp.mkv"
+
+// TempOutputPath returns where the AV1 output for a source file is written
+// before it replaces the original. The source's extension stays in the name,
+// so movie.mkv and movie.ts in one directory never share a temp output and
+// recovery can tell which source a temp output belongs to.
+func TempOutputPath(sourcePath string) string {
+	return sourcePath + tempOutputSuffix
+}
+
+// IsTempOutput reports whether a path is an in-progress AV1 output.
+func IsTempOutput(path string) bool {
+	return strings.HasSuffix(path, tempOutputSuffix)
+}
+
+// keptExtensions are the source containers whose path the AV1 output takes
+// over. Sources in other containers, such as .avi or .ts, are replaced by a
+// .mkv of the same name.
+var keptExtensions = map[string]bool{".mkv": true, ".mp4": true, ".m4v": true}
+
+// FinalOutputPath returns where the AV1 output of a source file ends up.
+func FinalOutputPath(sourcePath string) string {
+	ext := filepath.Ext(sourcePath)
+	if keptExtensions[strings.ToLower(ext)] {
+		return sourcePath
+	}
+	return strings.TrimSuffix(sourcePath, ext) + ".mkv"
+}
+
+// SkipMarkerPath returns the .av1qsvd-skip marker path for a media file.
+// A marker permanently excludes the file from scanning.
+func SkipMarkerPath(sourcePath string) string {
+	return strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath)) + ".av1qsvd-skip"
+}
+
+// WriteSkipMarker writes the .av1qsvd-skip marker for a media file.
+func WriteSkipMarker(sourcePath string) error {
+	return os.WriteFile(SkipMarkerPath(sourcePath), []byte("skip"), 0644)
+}
+
 // CheckSizeGate checks if the new file passes the size gate.
 // Returns true if newBytes <= origBytes * maxRatio, false otherwise.
 func CheckSizeGate(origBytes, newBytes int64, maxRatio float64) bool {
@@ -21,16 +64,12 @@ func CheckSizeGate(origBytes, newBytes int64, maxRatio float64) bool {
 }
 
 // AtomicReplaceFile atomically replaces the original file with the new file.
-// Writes to a temporary file first, then renames it to the original.
+// Writes to a temporary file first, then renames it to the original. When the
+// output gets a different name (see FinalOutputPath), it is renamed to that
+// first and the original is removed after.
 func AtomicReplaceFile(originalPath, newPath string) error {
-	// Get directory and base name
-	dir := filepath.Dir(originalPath)
-	baseName := filepath.Base(originalPath)
-	ext := filepath.Ext(baseName)
-	baseWithoutExt := strings.TrimSuffix(baseName, ext)
-
 	// Create temporary output path
-	tmpPath := filepath.Join(dir, baseWithoutExt+".av1-tmp.mkv")
+	tmpPath := TempOutputPath(originalPath)
 
 	// Move new file to temp location (if not already there)
 	if newPath != tmpPath {
@@ -44,6 +83,21 @@ func AtomicReplaceFile(originalPath, newPath string) error {
 		return fmt.Errorf("temp file does not exist: %w", err)
 	}
 
+	// Output in a different container: never clobber an unrelated file
+	finalPath := FinalOutputPath(originalPath)
+	if finalPath != originalPath {
+		if _, err := os.Stat(finalPath); err == nil {
+			return fmt.Errorf("%s already exists", finalPath)
+		}
+		if err := os.Rename(tmpPath, finalPath); err != nil {
+			return fmt.Errorf("failed to move new file into place: %w", err)
+		}
+		if err := os.Remove(originalPath); err != nil {
+			return fmt.Errorf("failed to remove original file: %w", err)
+		}
+		return nil
+	}
+
 	// Atomically replace original with temp file
 	if err := os.Rename(tmpPath, originalPath); err != nil {
 		return fmt.Errorf("failed to replace original file: %w", err)
@@ -53,58 +107,73 @@ func AtomicReplaceFile(originalPath, newPath string) error {
 }
 
 // ProcessJob processes a single transcoding job.
-// This function handles the full lifecycle: stability check, transcoding, size gate, and file replacement.
-func ProcessJob(job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeResult, cfg TranscodeConfig) error {
-	// Check file stability before starting
-	stable, err := scan.CheckFileStable(job.SourcePath, 10)
-	if err != nil {
-		return fmt.Errorf("failed to check file stability: %w", err)
-	}
-	if !stable {
-		reason := "file still copying"
-		job.Status = jobs.JobStatusSkipped
-		job.Reason = reason
-		now := time.Now()
-		job.FinishedAt = &now
-		metadata.WriteWhyFile(job.SourcePath, reason)
-		return nil // Not an error, just skip for now
-	}
-
+// This function handles the full lifecycle: transcoding, size gate, and file replacement.
+// The caller makes sure the source has finished being written (see scan.StabilityTracker).
+// If ctx is cancelled while ffmpeg is running, the partial output is deleted and the job
+// is put back to pending so it starts over on the next run.
+func ProcessJob(ctx context.Context, job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeResult, cfg TranscodeConfig) error {
 	// Mark job as running
 	now := time.Now()
 	job.Status = jobs.JobStatusRunning
 	job.StartedAt = &now
-	if err := jobs.SaveJob(job, cfg.JobStateDir); err != nil {
+	if err := cfg.saveJob(job); err != nil {
 		return fmt.Errorf("failed to save job status: %w", err)
 	}
 
 	// Build output path
-	dir := filepath.Dir(job.SourcePath)
-	baseName := filepath.Base(job.SourcePath)
-	ext := filepath.Ext(baseName)
-	baseWithoutExt := strings.TrimSuffix(baseName, ext)
-	outputPath := filepath.Join(dir, baseWithoutExt+".av1-tmp.mkv")
+	outputPath := TempOutputPath(job.SourcePath)
 	job.OutputPath = outputPath
+	finalPath := FinalOutputPath(job.SourcePath)
+	if finalPath != job.SourcePath {
+		if _, err := os.Stat(finalPath); err == nil {
+			job.Status = jobs.JobStatusFailed
+			job.Reason = fmt.Sprintf("output %s already exists", finalPath)
+			now := time.Now()
+			job.FinishedAt = &now
+			cfg.saveJob(job)
+			return fmt.Errorf("output %s already exists", finalPath)
+		}
+	}
 
 	// Build ffmpeg command
-	args, err := ffmpeg.TranscodeArgs(ffmpegPath, job.SourcePath, outputPath, probeResult, job.IsWebRipLike)
+	job.Device = cfg.Device
+	args, err := ffmpeg.TranscodeArgs(ffmpegPath, job.SourcePath, outputPath, probeResult, cfg.WebSafe, cfg.Device, cfg.Encode)
 	if err != nil {
 		job.Status = jobs.JobStatusFailed
 		job.Reason = fmt.Sprintf("failed to build ffmpeg args: %v", err)
 		now := time.Now()
 		job.FinishedAt = &now
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		return fmt.Errorf("failed to build transcode args: %w", err)
 	}
 
 	// Run transcode
-	exitCode, err := ffmpeg.RunTranscode(ffmpegPath, args)
+	opts := ffmpeg.RunOptions{
+		Duration: probeDuration(probeResult),
+		OnStart:  cfg.OnStart,
+		Nice:     cfg.Nice,
+	}
+	if cfg.OnProgress != nil {
+		opts.OnProgress = func(p ffmpeg.Progress) { cfg.OnProgress(job, p) }
+	}
+	exitCode, err := ffmpeg.RunTranscodeWithOptions(ctx, ffmpegPath, args, opts)
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by shutdown - roll back so the job is retried from scratch
+		os.Remove(outputPath)
+		job.Status = jobs.JobStatusPending
+		job.Reason = "interrupted by daemon shutdown, will restart"
+		job.StartedAt = nil
+		job.FinishedAt = nil
+		job.OutputPath = ""
+		cfg.saveJob(job)
+		return fmt.Errorf("transcode interrupted: %w", err)
+	}
 	if err != nil {
 		job.Status = jobs.JobStatusFailed
 		job.Reason = fmt.Sprintf("ffmpeg exit code %d: %v", exitCode, err)
 		now := time.Now()
 		job.FinishedAt = &now
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		metadata.WriteWhyFile(job.SourcePath, job.Reason)
 		// Clean up output file if it exists
 		os.Remove(outputPath)
@@ -118,13 +187,25 @@ func ProcessJob(job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeRes
 		job.Reason = fmt.Sprintf("failed to stat output file: %v", err)
 		now := time.Now()
 		job.FinishedAt = &now
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		os.Remove(outputPath)
 		return fmt.Errorf("output file not found: %w", err)
 	}
 
 	job.NewSize = outputInfo.Size()
 
+	// Make sure the output kept the source's bit depth, colors and HDR metadata
+	if err := verifyOutput(ffmpegPath, outputPath, probeResult, cfg.Encode.StripDynamicHDR); err != nil {
+		job.Status = jobs.JobStatusFailed
+		job.Reason = fmt.Sprintf("output verification failed: %v", err)
+		now := time.Now()
+		job.FinishedAt = &now
+		cfg.saveJob(job)
+		metadata.WriteWhyFile(job.SourcePath, job.Reason)
+		os.Remove(outputPath)
+		return fmt.Errorf("output verification failed: %w", err)
+	}
+
 	// Check size gate
 	if !CheckSizeGate(job.OriginalSize, job.NewSize, cfg.MaxSizeRatio) {
 		// Size gate failed - reject
@@ -139,12 +220,11 @@ func ProcessJob(job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeRes
 
 		// Write .av1qsvd-why.txt and .av1qsvd-skip
 		metadata.WriteWhyFile(job.SourcePath, reason)
-		skipMarker := strings.TrimSuffix(job.SourcePath, ext) + ".av1qsvd-skip"
-		os.WriteFile(skipMarker, []byte("skip"), 0644)
+		WriteSkipMarker(job.SourcePath)
 
 		// Delete output file
 		os.Remove(outputPath)
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		return nil // Not an error, just rejected
 	}
 
@@ -156,18 +236,19 @@ func ProcessJob(job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeRes
 		job.Reason = fmt.Sprintf("failed to replace file: %v", err)
 		now := time.Now()
 		job.FinishedAt = &now
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		os.Remove(outputPath)
 		return fmt.Errorf("failed to replace file: %w", err)
 	}
 
 	// Verify the replacement succeeded by checking the file exists
-	if _, err := os.Stat(job.SourcePath); err != nil {
+	job.OutputPath = finalPath
+	if _, err := os.Stat(finalPath); err != nil {
 		job.Status = jobs.JobStatusFailed
 		job.Reason = fmt.Sprintf("replaced file verification failed: %v", err)
 		now := time.Now()
 		job.FinishedAt = &now
-		jobs.SaveJob(job, cfg.JobStateDir)
+		cfg.saveJob(job)
 		return fmt.Errorf("replaced file verification failed: %w", err)
 	}
 
@@ -176,13 +257,54 @@ func ProcessJob(job *jobs.Job, ffmpegPath string, probeResult *metadata.ProbeRes
 	job.Status = jobs.JobStatusSuccess
 	now = time.Now()
 	job.FinishedAt = &now
-	jobs.SaveJob(job, cfg.JobStateDir)
+	cfg.saveJob(job)
 
 	return nil
 }
 
+// verifyOutput probes an encode's output and checks it against the source
+// with ffmpeg.VerifyOutput. stripped outputs must not claim Dolby Vision or
+// HDR10+, since players would then look for metadata that isn't there.
+func verifyOutput(ffmpegPath, outputPath string, source *metadata.ProbeResult, stripped bool) error {
+	output, err := probeFile(ffmpegPath, outputPath)
+	if err != nil {
+		return err
+	}
+	if err := ffmpeg.VerifyOutput(source.VideoStream, output.VideoStream); err != nil {
+		return err
+	}
+	if stripped && dynamicHDR(output) != "" {
+		return &ffmpeg.VerifyError{Problems: []string{dynamicHDR(output) + " metadata left in the HDR10 base layer encode"}}
+	}
+	return nil
+}
+
 // TranscodeConfig is a subset of config needed for job processing.
 type TranscodeConfig struct {
 	JobStateDir  string
 	MaxSizeRatio float64
+	Encode       ffmpeg.EncodeSettings            // quality, encoder and track settings from the job's profile
+	WebSafe      bool                             // apply the WebRip timestamp fixes
+	Device       string                           // render node to encode on, "" lets VAAPI pick
+	SaveJob      func(*jobs.Job) error            // persists state changes, defaults to jobs.SaveJob
+	OnProgress   func(*jobs.Job, ffmpeg.Progress) // optional, receives encode progress
+	OnStart      func(*os.Process)                // optional, receives the running ffmpeg process
+	Nice         int                              // ffmpeg's nice level, 0 = unchanged
+}
+
+// probeDuration returns the probed duration of a file, or 0 if unknown.
+func probeDuration(probeResult *metadata.ProbeResult) time.Duration {
+	secs, err := strconv.ParseFloat(probeResult.Format.Duration, 64)
+	if err != nil || secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// saveJob persists a job state change through SaveJob, or straight to JobStateDir.
+func (cfg TranscodeConfig) saveJob(job *jobs.Job) error {
+	if cfg.SaveJob != nil {
+		return cfg.SaveJob(job)
+	}
+	return jobs.SaveJob(job, cfg.JobStateDir)
 }
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+func TestOutputPaths(t *testing.T) {
+	tests := []struct {
+		source, temp, final string
+	}{
+		{"/lib/movie.mkv", "/lib/movie.mkv.av1-tmp.mkv", "/lib/movie.mkv"},
+		{"/lib/movie.MP4", "/lib/movie.MP4.av1-tmp.mkv", "/lib/movie.MP4"},
+		{"/lib/movie.ts", "/lib/movie.ts.av1-tmp.mkv", "/lib/movie.mkv"},
+		{"/lib/movie.avi", "/lib/movie.avi.av1-tmp.mkv", "/lib/movie.mkv"},
+		{"/lib/a.b.m2ts", "/lib/a.b.m2ts.av1-tmp.mkv", "/lib/a.b.mkv"},
+	}
+	temps := make(map[string]string)
+	for _, tt := range tests {
+		if got := TempOutputPath(tt.source); got != tt.temp {
+			t.Errorf("TempOutputPath(%s) = %s, want %s", tt.source, got, tt.temp)
+		}
+		if other, ok := temps[tt.temp]; ok {
+			t.Errorf("%s and %s share a temp output", tt.source, other)
+		}
+		temps[tt.temp] = tt.source
+		if !IsTempOutput(tt.temp) || IsTempOutput(tt.source) {
+			t.Errorf("IsTempOutput wrong for %s or %s", tt.temp, tt.source)
+		}
+		if got := FinalOutputPath(tt.source); got != tt.final {
+			t.Errorf("FinalOutputPath(%s) = %s, want %s", tt.source, got, tt.final)
+		}
+	}
+}
+
+func TestProcessJobInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	// Stands in for ffmpeg: starts writing the output, the last argument,
+	// and runs until stopped
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\nfor out; do :; done\necho partial > \"$out\"\nexec sleep 30\n"
+	if err := os.WriteFile(fakeFFmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("h264 source"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	video := metadata.StreamInfo{Index: 0, CodecType: "video", CodecName: "h264", PixFmt: "yuv420p"}
+	probeResult := &metadata.ProbeResult{
+		HasVideo:    true,
+		Streams:     []metadata.StreamInfo{video},
+		VideoStream: &video,
+		Format:      metadata.FormatInfo{Duration: "60"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	output := TempOutputPath(source)
+	go func() {
+		// Shut down once the encode is under way
+		for ctx.Err() == nil {
+			if _, err := os.Stat(output); err == nil {
+				cancel()
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	var saved []jobs.JobStatus
+	job := jobs.NewJob(source)
+	err := ProcessJob(ctx, job, fakeFFmpeg, probeResult, TranscodeConfig{
+		MaxSizeRatio: 0.9,
+		SaveJob: func(j *jobs.Job) error {
+			saved = append(saved, j.Status)
+			return nil
+		},
+	})
+	if err == nil {
+		t.Fatal("ProcessJob of an interrupted encode succeeded")
+	}
+	if job.Status != jobs.JobStatusPending || job.StartedAt != nil || job.FinishedAt != nil || job.OutputPath != "" {
+		t.Errorf("job after shutdown: %+v", job)
+	}
+	if want := []jobs.JobStatus{jobs.JobStatusRunning, jobs.JobStatusPending}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved %q, want %q", saved, want)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Error("partial output left behind")
+	}
+	if data, err := os.ReadFile(source); err != nil || string(data) != "h264 source" {
+		t.Errorf("source changed: %q, %v", data, err)
+	}
+}
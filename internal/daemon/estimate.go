@@ -0,0 +1,159 @@
+package daemon
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// estimateOutputSize calculates estimated output size based on actual bitrate analysis
+func estimateOutputSize(originalSize int64, probeResult *metadata.ProbeResult, quality int) int64 {
+	if probeResult.VideoStream == nil {
+		return 0
+	}
+
+	// Parse duration
+	duration, err := strconv.ParseFloat(probeResult.Format.Duration, 64)
+	if err != nil || duration <= 0 {
+		return 0
+	}
+
+	videoBitrate, totalBitrate, ok := videoBitrate(probeResult)
+	if !ok {
+		return 0
+	}
+
+	// Estimate AV1 video bitrate based on quality, resolution, and frame rate
+	videoStream := probeResult.VideoStream
+	pixels := float64(videoStream.Width * videoStream.Height)
+	fps := frameRate(videoStream)
+
+	// Estimate AV1 bitrate based on quality setting
+	bitsPerPixelPerFrame := av1BitsPerPixel(quality)
+
+	// Calculate estimated AV1 video bitrate
+	estimatedAV1VideoBitrate := pixels * bitsPerPixelPerFrame * fps
+
+	// Calculate compression ratio
+	compressionRatio := estimatedAV1VideoBitrate / videoBitrate
+
+	// Estimate video size reduction
+	// Video portion of original file
+	originalVideoSize := int64(float64(originalSize) * (videoBitrate / totalBitrate))
+
+	// Estimated AV1 video size
+	estimatedAV1VideoSize := int64(float64(originalVideoSize) * compressionRatio)
+
+	// Audio/subtitle sizes stay the same (they're copied)
+	audioSubtitleSize := originalSize - originalVideoSize
+
+	// Estimated total size
+	estimatedTotalSize := estimatedAV1VideoSize + audioSubtitleSize
+
+	// Add container overhead (~1-2% for Matroska)
+	estimatedTotalSize = int64(float64(estimatedTotalSize) * 1.02)
+
+	// Ensure estimate is reasonable (not negative, not larger than original)
+	if estimatedTotalSize <= 0 {
+		return 0
+	}
+	if estimatedTotalSize > originalSize {
+		// If estimate is larger, cap at 95% of original (conservative)
+		estimatedTotalSize = int64(float64(originalSize) * 0.95)
+	}
+
+	return estimatedTotalSize
+}
+
+// AV1 output spends about av1BPPAtQuality24 bits per pixel per frame at
+// quality 24, and each quality step up or down changes that by a factor of
+// av1BPPStep (roughly 0.15 at 23 and 0.10 at 25).
+const (
+	av1BPPAtQuality24 = 0.12
+	av1BPPStep        = 0.82
+)
+
+// av1BitsPerPixel estimates the bits per pixel per frame of an AV1 encode
+// at quality.
+func av1BitsPerPixel(quality int) float64 {
+	return av1BPPAtQuality24 * math.Pow(av1BPPStep, float64(quality-24))
+}
+
+// videoBitrate returns the bitrate of a source's video in bits per second,
+// worked out from the overall bitrate minus its audio and subtitle streams,
+// and the overall bitrate. It fails if the container has no bitrate.
+func videoBitrate(probeResult *metadata.ProbeResult) (video, total float64, ok bool) {
+	// Parse total bitrate (bits per second)
+	totalBitrate, err := strconv.ParseFloat(probeResult.Format.BitRate, 64)
+	if err != nil || totalBitrate <= 0 {
+		return 0, 0, false
+	}
+
+	// Calculate video bitrate (subtract audio/subtitle bitrates)
+	videoBitrate := totalBitrate
+	for _, stream := range probeResult.Streams {
+		if stream.CodecType == "audio" || stream.CodecType == "subtitle" {
+			if stream.BitRate != "" {
+				if streamBR, err := strconv.ParseFloat(stream.BitRate, 64); err == nil {
+					videoBitrate -= streamBR
+				}
+			}
+		}
+	}
+
+	// If we couldn't parse stream bitrates, estimate audio overhead
+	// Typical: 1-2 audio streams at 192-384 kbps each, subtitles negligible
+	if videoBitrate >= totalBitrate*0.95 {
+		// Assume ~5% overhead for audio if we couldn't parse it
+		videoBitrate = totalBitrate * 0.95
+	}
+	return videoBitrate, totalBitrate, true
+}
+
+// frameRate returns a video stream's average frame rate, or 24 if it is
+// missing or malformed.
+func frameRate(videoStream *metadata.StreamInfo) float64 {
+	if fps := videoStream.FrameRate(); fps > 0 {
+		return fps
+	}
+	return 24
+}
+
+// bitsPerPixel returns how many bits the source spends on each pixel of each
+// frame, the same measure estimateOutputSize uses for AV1 output. It fails if
+// the bitrate or dimensions are unknown.
+func bitsPerPixel(probeResult *metadata.ProbeResult) (float64, bool) {
+	videoStream := probeResult.VideoStream
+	if videoStream == nil || videoStream.Width <= 0 || videoStream.Height <= 0 {
+		return 0, false
+	}
+	video, _, ok := videoBitrate(probeResult)
+	if !ok {
+		return 0, false
+	}
+	return video / (float64(videoStream.Width*videoStream.Height) * frameRate(videoStream)), true
+}
+
+// alreadyEfficient reports whether a source spends so few bits per pixel
+// that an AV1 encode is unlikely to get under the size gate, and why.
+// Sources whose bitrate is unknown are never skipped.
+func alreadyEfficient(profile config.ProfileConfig, probeResult *metadata.ProbeResult) (bool, string) {
+	if probeResult.VideoStream == nil {
+		return false, ""
+	}
+	codec := probeResult.VideoStream.CodecName
+	threshold := profile.MinBitsPerPixelFor(codec)
+	if threshold <= 0 {
+		return false, ""
+	}
+	bpp, ok := bitsPerPixel(probeResult)
+	if !ok || bpp >= threshold {
+		return false, ""
+	}
+	video, _, _ := videoBitrate(probeResult)
+	return true, fmt.Sprintf("already efficient: %s at %.3f bits per pixel per frame (%.0f kbps video, %dx%d @ %.3g fps), below %.3f",
+		codec, bpp, video/1000, probeResult.VideoStream.Width, probeResult.VideoStream.Height, frameRate(probeResult.VideoStream), threshold)
+}
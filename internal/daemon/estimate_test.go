@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"math"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+func TestAV1BitsPerPixel(t *testing.T) {
+	// The figures the estimate was tuned on
+	for quality, want := range map[int]float64{23: 0.15, 24: 0.12, 25: 0.10} {
+		if got := av1BitsPerPixel(quality); math.Abs(got-want) > 0.01 {
+			t.Errorf("av1BitsPerPixel(%d) = %.3f, want about %.2f", quality, got, want)
+		}
+	}
+	// Every quality gets its own estimate, fewer bits the higher it goes
+	prev := math.Inf(1)
+	for quality := 1; quality <= 255; quality++ {
+		bpp := av1BitsPerPixel(quality)
+		if bpp <= 0 || bpp >= prev {
+			t.Fatalf("av1BitsPerPixel(%d) = %g, want below %g and above 0", quality, bpp, prev)
+		}
+		prev = bpp
+	}
+}
+
+func TestFrameRate(t *testing.T) {
+	tests := []struct {
+		rate string
+		want float64
+	}{
+		{"24000/1001", 24000.0 / 1001},
+		{"25/1", 25},
+		{"50", 50},
+		{"", 24},
+		{"0/0", 24},
+		{"30/0", 24},
+		{"abc", 24},
+		{"30/x", 24},
+	}
+	for _, tt := range tests {
+		if got := frameRate(&metadata.StreamInfo{AvgFrameRate: tt.rate}); got != tt.want {
+			t.Errorf("frameRate(%q) = %g, want %g", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateOutputSize(t *testing.T) {
+	// Ten minutes of 1080p24 at 20 Mbps video plus 1.5 Mbps of audio
+	const size = 1612_500_000
+	probe := func() *metadata.ProbeResult {
+		video := metadata.StreamInfo{CodecType: "video", Width: 1920, Height: 1080, AvgFrameRate: "24/1"}
+		return &metadata.ProbeResult{
+			Format:      metadata.FormatInfo{Duration: "600", BitRate: "21500000"},
+			Streams:     []metadata.StreamInfo{video, {CodecType: "audio", BitRate: "1500000"}},
+			VideoStream: &video,
+		}
+	}
+
+	prev := int64(size)
+	for _, quality := range []int{20, 23, 24, 25, 30, 40} {
+		est := estimateOutputSize(size, probe(), quality)
+		if est <= 0 || est >= prev {
+			t.Errorf("quality %d: estimate %d, want below %d and above 0", quality, est, prev)
+		}
+		prev = est
+	}
+
+	// Bits per pixel at 24 is 0.12: 1920*1080*24*0.12 ≈ 5.97 Mbps against 20,
+	// with 112.5 MB of audio kept and 2% container overhead
+	want := (1_500_000_000*1920*1080*24*0.12/20_000_000 + 112_500_000) * 1.02
+	if got := estimateOutputSize(size, probe(), 24); math.Abs(float64(got)-want)/want > 0.01 {
+		t.Errorf("quality 24: estimate %d, want about %.0f", got, want)
+	}
+
+	noBitrate := probe()
+	noBitrate.Format.BitRate = ""
+	if got := estimateOutputSize(size, noBitrate, 24); got != 0 {
+		t.Errorf("estimate without a bitrate = %d, want 0", got)
+	}
+}
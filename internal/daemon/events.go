@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// Event types published on the daemon's event stream.
+const (
+	EventJob        = "job"         // a job was created or changed state
+	EventJobDeleted = "job_deleted" // a job was removed from the queue
+	EventProgress   = "progress"    // encode progress of a running job
+	EventScan       = "scan"        // a library scan finished
+)
+
+// Event is one entry on the daemon's event stream. Exactly one of Job,
+// Progress and Scan is set, matching Type; Job for both job event types.
+type Event struct {
+	Type     string       `json:"type"`
+	Time     time.Time    `json:"time"`
+	Job      *jobs.Job    `json:"job,omitempty"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	Scan     *ScanSummary `json:"scan,omitempty"`
+}
+
+// JobProgress is the encode progress of a running job.
+type JobProgress struct {
+	JobID      string `json:"job_id"`
+	SourcePath string `json:"source_path"`
+	Device     string `json:"device"`
+	ffmpeg.Progress
+}
+
+// ScanSummary describes the result of a library scan.
+type ScanSummary struct {
+	FinishedAt time.Time     `json:"finished_at"`
+	Duration   time.Duration `json:"duration_ns"`
+	Candidates []string      `json:"candidates"`
+	Skipped    []SkippedFile `json:"skipped"`
+	Unchanged  int           `json:"unchanged"`
+	Settling   int           `json:"settling"`
+	Excluded   int           `json:"excluded"`
+	Roots      []RootStats   `json:"roots"`
+}
+
+// Broker fans events out to subscribers.
+// Publishing never blocks: a subscriber that falls behind misses events
+// rather than stalling the daemon.
+type Broker struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewBroker creates an event broker with no subscribers.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events and a function that unsubscribes
+// and closes it.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to every subscriber with room for it.
+func (b *Broker) Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
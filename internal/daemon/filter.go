@@ -0,0 +1,294 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+// IgnoreFile is the per-directory ignore file. Each line is a glob relative
+// to the directory, and # starts a comment. A file without any globs ignores
+// the whole directory.
+const IgnoreFile = ".av1qsvdignore"
+
+// ignoreTTL is how long an ignore file is trusted before it is read again.
+const ignoreTTL = 30 * time.Second
+
+// pathFilter decides which files under the library roots are judged: by
+// extension, by include/exclude rules and by ignore files.
+type pathFilter struct {
+	roots      []rootFilter    // longest root first
+	extensions map[string]bool // for paths outside every root, e.g. enqueued on request
+
+	mu      sync.Mutex
+	ignores map[string]ignoreEntry // by directory
+	pruned  time.Time              // when expired ignores were last dropped
+}
+
+// rootFilter holds the compiled rules of one library root.
+type rootFilter struct {
+	root       string
+	extensions map[string]bool
+	include    []pattern
+	exclude    []pattern
+}
+
+// pattern matches paths relative to a directory.
+type pattern struct {
+	source string // as configured, for messages
+	re     *regexp.Regexp
+	elem   bool // a glob without a slash, matched against each path element
+	prefix bool // a glob with a slash, also matched against each parent directory
+}
+
+// ignoreEntry is a parsed ignore file, or the lack of one.
+type ignoreEntry struct {
+	patterns []pattern
+	whole    bool // the file has no globs and ignores its whole directory
+	readAt   time.Time
+}
+
+// newPathFilter compiles the path rules of every library root.
+func newPathFilter(cfg config.TranscodeConfig) (*pathFilter, error) {
+	f := &pathFilter{
+		extensions: extensionSet(cfg.Extensions),
+		ignores:    make(map[string]ignoreEntry),
+	}
+	var errs []string
+	for root, rules := range cfg.RootRules() {
+		rf := rootFilter{root: filepath.Clean(root), extensions: extensionSet(rules.Extensions)}
+		compile := func(list []string, compile func(string) (pattern, error), key string) []pattern {
+			var patterns []pattern
+			for _, s := range list {
+				p, err := compile(s)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s %q for %s: %v", key, s, root, err))
+					continue
+				}
+				patterns = append(patterns, p)
+			}
+			return patterns
+		}
+		rf.include = append(compile(rules.Include, compileGlob, "include"), compile(rules.IncludeRegex, compileRegex, "include_regex")...)
+		rf.exclude = append(compile(rules.Exclude, compileGlob, "exclude"), compile(rules.ExcludeRegex, compileRegex, "exclude_regex")...)
+		f.roots = append(f.roots, rf)
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	sort.Slice(f.roots, func(i, j int) bool { return len(f.roots[i].root) > len(f.roots[j].root) })
+	return f, nil
+}
+
+func extensionSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, ext := range list {
+		set[strings.ToLower(ext)] = true
+	}
+	return set
+}
+
+// compileGlob turns a glob into a pattern. * and ? match within a path
+// element, ** matches across elements, and [...] is a character class. A glob
+// without a slash matches any element, so "Extras" excludes every Extras
+// directory; one with a slash matches from the start of the relative path.
+func compileGlob(glob string) (pattern, error) {
+	g := strings.TrimSuffix(glob, "/")
+	p := pattern{source: glob, elem: !strings.Contains(g, "/"), prefix: strings.Contains(g, "/")}
+	g = strings.TrimPrefix(g, "/")
+	if g == "" {
+		return pattern{}, fmt.Errorf("empty pattern")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(g); i++ {
+		switch c := g[i]; c {
+		case '*':
+			if strings.HasPrefix(g[i:], "**/") {
+				b.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(g[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(g[i+1:], ']')
+			if end < 0 {
+				return pattern{}, fmt.Errorf("unterminated [")
+			}
+			class := g[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return pattern{}, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// compileRegex turns a regular expression into a pattern matched against
+// the whole relative path.
+func compileRegex(expr string) (pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return pattern{}, err
+	}
+	return pattern{source: expr, re: re}, nil
+}
+
+// match reports whether a slash-separated relative path matches.
+func (p pattern) match(rel string) bool {
+	switch {
+	case p.elem:
+		for _, elem := range strings.Split(rel, "/") {
+			if p.re.MatchString(elem) {
+				return true
+			}
+		}
+		return false
+	case p.prefix:
+		for i := 0; i < len(rel); i++ {
+			if rel[i] == '/' && p.re.MatchString(rel[:i]) {
+				return true
+			}
+		}
+	}
+	return p.re.MatchString(rel)
+}
+
+// rootFor returns the rules of the library root containing a path, or nil.
+func (f *pathFilter) rootFor(path string) *rootFilter {
+	for i := range f.roots {
+		if config.Within(path, f.roots[i].root) {
+			return &f.roots[i]
+		}
+	}
+	return nil
+}
+
+// media reports whether a path has a media extension we transcode. Our own
+// in-progress outputs are never media files.
+func (f *pathFilter) media(path string) bool {
+	if IsTempOutput(path) {
+		return false
+	}
+	extensions := f.extensions
+	if rf := f.rootFor(path); rf != nil {
+		extensions = rf.extensions
+	}
+	return extensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// excluded reports whether a file or directory is left out by the rules of
+// its root or by an ignore file in its root or any directory in between, and
+// why. Include rules only apply to files.
+func (f *pathFilter) excluded(path string, isDir bool) (bool, string) {
+	rf := f.rootFor(path)
+	if rf == nil || path == rf.root {
+		return false, ""
+	}
+	rel := relPath(path, rf.root)
+
+	for _, p := range rf.exclude {
+		if p.match(rel) {
+			return true, fmt.Sprintf("excluded by %q", p.source)
+		}
+	}
+	if !isDir && len(rf.include) > 0 {
+		included := false
+		for _, p := range rf.include {
+			if p.match(rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return true, "not matched by any include rule"
+		}
+	}
+
+	// Ignore files from the root down to the path's parent
+	dir := rf.root
+	for _, elem := range strings.Split(rel, "/") {
+		ignore := f.ignoreFile(dir)
+		if ignore.whole {
+			return true, "ignored by " + filepath.Join(dir, IgnoreFile)
+		}
+		for _, p := range ignore.patterns {
+			if p.match(relPath(path, dir)) {
+				return true, fmt.Sprintf("ignored by %q in %s", p.source, filepath.Join(dir, IgnoreFile))
+			}
+		}
+		dir = filepath.Join(dir, elem)
+	}
+	return false, ""
+}
+
+// relPath returns path relative to dir, which contains it, with slashes.
+func relPath(path, dir string) string {
+	return filepath.ToSlash(strings.TrimPrefix(path, strings.TrimSuffix(dir, "/")+"/"))
+}
+
+// ignoreFile returns the parsed ignore file of a directory, reading it again
+// once it is older than ignoreTTL. Expired entries are dropped every
+// ignoreTTL, so the cache only holds directories looked at recently.
+func (f *pathFilter) ignoreFile(dir string) ignoreEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now := time.Now(); now.Sub(f.pruned) >= ignoreTTL {
+		for d, entry := range f.ignores {
+			if now.Sub(entry.readAt) >= ignoreTTL {
+				delete(f.ignores, d)
+			}
+		}
+		f.pruned = now
+	}
+	if entry, ok := f.ignores[dir]; ok && time.Since(entry.readAt) < ignoreTTL {
+		return entry
+	}
+	entry := ignoreEntry{readAt: time.Now()}
+	path := filepath.Join(dir, IgnoreFile)
+	if data, err := os.ReadFile(path); err == nil {
+		entry.whole = true
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entry.whole = false
+			p, err := compileGlob(line)
+			if err != nil {
+				log.Printf("Warning: %s: ignoring pattern %q: %v", path, line, err)
+				continue
+			}
+			entry.patterns = append(entry.patterns, p)
+		}
+	}
+	f.ignores[dir] = entry
+	return entry
+}
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		rel  string
+		want bool
+	}{
+		// Without a slash: any path element
+		{"Extras", "Show/Extras/clip.mkv", true},
+		{"Extras", "Show/Extras", true},
+		{"Extras", "Show/ExtrasBonus/clip.mkv", false},
+		{"*.ts", "Show/e01.ts", true},
+		{"*.ts", "Show/e01.mkv", false},
+		{"Sample?", "Film/Sample1/x.mkv", true},
+		{"Sample?", "Film/Sample12/x.mkv", false},
+		{"Extras/", "Show/Extras/clip.mkv", true},
+
+		// With a slash: from the start, and any parent directory
+		{"TV/Some Show", "TV/Some Show/S01/e01.mkv", true},
+		{"TV/Some Show", "Kids/TV/Some Show/e01.mkv", false},
+		{"/TV", "TV/e01.mkv", true},
+		{"Movies/*.mkv", "Movies/film.mkv", true},
+		{"Movies/*.mkv", "Movies/Sub/film.mkv", false},
+
+		// **
+		{"Movies/**", "Movies/film.mkv", true},
+		{"Movies/**", "Movies/A/B/film.mkv", true},
+		{"Movies/**", "Movies", false},
+		{"**/Extras", "Extras/clip.mkv", true},
+		{"**/Extras", "A/B/Extras/clip.mkv", true},
+		{"**/Extras", "A/ExtrasB/clip.mkv", false},
+		{"a/**/b.mkv", "a/b.mkv", true},
+		{"a/**/b.mkv", "a/x/y/b.mkv", true},
+		{"a/**/b.mkv", "a/x/yb.mkv", false},
+		{"**/*.ts", "A/B/e01.ts", true},
+
+		// Regular expression metacharacters are literal
+		{"Film (2020).mkv", "Film (2020).mkv", true},
+		{"Film (2020).mkv", "Film 2020.mkv", false},
+		{"a+b.mkv", "a+b.mkv", true},
+		{"a+b.mkv", "aab.mkv", false},
+		{"x.mkv", "xamkv", false},
+		{"$money^.mkv", "$money^.mkv", true},
+		{"{a,b}|c", "{a,b}|c", true},
+		{"{a,b}|c", "a", false},
+
+		// Character classes
+		{"e0[1-3].mkv", "e02.mkv", true},
+		{"e0[1-3].mkv", "e04.mkv", false},
+		{"e0[!1-3].mkv", "e04.mkv", true},
+		{"e0[!1-3].mkv", "e01.mkv", false},
+	}
+	for _, tt := range tests {
+		p, err := compileGlob(tt.glob)
+		if err != nil {
+			t.Errorf("compileGlob(%q): %v", tt.glob, err)
+			continue
+		}
+		if got := p.match(tt.rel); got != tt.want {
+			t.Errorf("%q matching %q = %t, want %t (regexp %s)", tt.glob, tt.rel, got, tt.want, p.re)
+		}
+	}
+
+	for _, glob := range []string{"", "/", "e0[1-3.mkv"} {
+		if _, err := compileGlob(glob); err == nil {
+			t.Errorf("compileGlob(%q) succeeded, want an error", glob)
+		}
+	}
+}
+
+func TestExcludedIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(IgnoreFile, "# everywhere below the root\n*.ts\n")
+	write("TV/"+IgnoreFile, "Extras\nShow A/S01/e01.mkv\n")
+	write("TV/Show B/"+IgnoreFile, "")
+	write("Movies/"+IgnoreFile, "[oops\n")
+
+	cfg := config.DefaultConfig()
+	cfg.LibraryRoots = []string{root}
+	cfg.Exclude = []string{"Sample"}
+	f, err := newPathFilter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rel      string
+		excluded bool
+	}{
+		{"Movies/film.mkv", false},
+		{"Movies/film.ts", true},            // root ignore file reaches every level
+		{"TV/Show A/S02/e03.ts", true},      // inherited through TV's ignore file
+		{"TV/Show A/Extras/clip.mkv", true}, // TV's ignore file
+		{"Extras/clip.mkv", false},          // TV's rules don't apply above it
+		{"TV/Show A/S01/e01.mkv", true},     // relative to TV
+		{"TV/Show A/S01/e02.mkv", false},
+		{"Show A/S01/e01.mkv", false},
+		{"TV/Show B/e01.mkv", true}, // empty ignore file: whole directory
+		{"TV/Show B", false},        // the directory itself is walked, its contents are not
+		{"TV/Show C/e01.mkv", false},
+		{"Movies/Sample/x.mkv", true}, // config exclude
+	}
+	for _, tt := range tests {
+		path := filepath.Join(root, tt.rel)
+		isDir := filepath.Ext(path) == ""
+		if got, why := f.excluded(path, isDir); got != tt.excluded {
+			t.Errorf("excluded(%s) = %t (%s), want %t", tt.rel, got, why, tt.excluded)
+		}
+	}
+}
+
+func TestIgnoreCachePruned(t *testing.T) {
+	f := &pathFilter{ignores: make(map[string]ignoreEntry)}
+	old := time.Now().Add(-2 * ignoreTTL)
+	for _, dir := range []string{"/a", "/b", "/c"} {
+		f.ignores[dir] = ignoreEntry{readAt: old}
+	}
+	dir := t.TempDir()
+	f.ignoreFile(dir)
+	if len(f.ignores) != 1 {
+		t.Errorf("cache holds %d directories after pruning, want 1", len(f.ignores))
+	}
+	if _, ok := f.ignores[dir]; !ok {
+		t.Errorf("cache lost the directory just read")
+	}
+}
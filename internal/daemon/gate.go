@@ -0,0 +1,188 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// admissionPoll is how often a dispatcher held back by the schedule or
+// throttle checks again.
+const admissionPoll = 30 * time.Second
+
+// Reasons running ffmpeg processes are paused for. Processes run again once
+// no reason is left.
+const pauseSchedule = "schedule window closed"
+
+// admission reports whether a new job may start now, and if not, why.
+func (d *Daemon) admission() (bool, string) {
+	state := d.schedule.Load().At(time.Now())
+	if !state.Open {
+		return false, "outside the encoding schedule"
+	}
+	if state.MaxConcurrent > 0 && d.queue.Running() >= state.MaxConcurrent {
+		return false, fmt.Sprintf("schedule window %s allows %d concurrent job(s)", state.Window, state.MaxConcurrent)
+	}
+	if st := d.throttle.State(); st.Throttled {
+		return false, "host over throttle limits: " + strings.Join(st.Over, ", ")
+	}
+	return true, ""
+}
+
+// nextJob waits until a new job may start and claims it. Returns nil once
+// ctx is cancelled.
+func (d *Daemon) nextJob(ctx context.Context) *jobs.Job {
+	var held string
+	for {
+		var poll <-chan time.Time
+		if ok, why := d.admission(); ok {
+			if held != "" {
+				log.Printf("Starting jobs again")
+				held = ""
+			}
+			if job := d.queue.Claim(); job != nil {
+				return job
+			}
+		} else {
+			if why != held {
+				log.Printf("Holding new jobs: %s", why)
+				held = why
+			}
+			poll = time.After(admissionPoll)
+		}
+
+		// Also wake up when a job waiting to be retried becomes eligible
+		var retry <-chan time.Time
+		if next, ok := d.queue.NextRetry(); ok {
+			retry = time.After(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-d.queue.Ready():
+		case <-d.wake:
+		case <-retry:
+		case <-poll:
+		}
+	}
+}
+
+// wakeDispatcher makes a waiting dispatcher re-check whether it may start a job.
+func (d *Daemon) wakeDispatcher() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runSchedule applies schedule changes to running jobs until ctx is
+// cancelled: it pauses or resumes ffmpeg when a window closes or opens,
+// and renices running encodes to the current window's nice level.
+func (d *Daemon) runSchedule(ctx context.Context) {
+	ticker := time.NewTicker(admissionPoll)
+	defer ticker.Stop()
+
+	prev := d.schedule.Load().At(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		schedule := d.schedule.Load()
+		state := schedule.At(time.Now())
+		// Checked on every tick, so a reloaded schedule takes effect too
+		d.setPaused(pauseSchedule, !state.Open && schedule.PauseOnClose())
+		if state == prev {
+			continue
+		}
+		switch {
+		case prev.Open && !state.Open:
+			log.Printf("Encoding window closed")
+		case !prev.Open && state.Open:
+			log.Printf("Encoding window %s opened", state.Window)
+		}
+		// Back to 0 too when a window closes and its encodes finish
+		if state.Nice != prev.Nice {
+			d.reniceRunning(state.Nice)
+		}
+		prev = state
+		d.wakeDispatcher()
+	}
+}
+
+// trackProcess returns an ffmpeg OnStart hook that registers a job's process
+// so it can be paused, and pauses it right away if a pause is in effect.
+func (d *Daemon) trackProcess(id string) func(*os.Process) {
+	return func(p *os.Process) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.procs[id] = p
+		if len(d.pauses) > 0 {
+			p.Signal(syscall.SIGSTOP)
+		}
+	}
+}
+
+// setPaused turns a pause reason on or off. Running ffmpeg processes are
+// stopped with SIGSTOP while any reason is on, and continued with SIGCONT
+// once none is left.
+func (d *Daemon) setPaused(reason string, on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wasPaused := len(d.pauses) > 0
+	if on {
+		d.pauses[reason] = true
+	} else {
+		delete(d.pauses, reason)
+	}
+	paused := len(d.pauses) > 0
+	if paused == wasPaused {
+		return
+	}
+
+	sig := syscall.SIGCONT
+	if paused {
+		sig = syscall.SIGSTOP
+		log.Printf("Pausing %d running encode(s): %s", len(d.procs), reason)
+	} else {
+		log.Printf("Resuming %d paused encode(s)", len(d.procs))
+	}
+	for id, p := range d.procs {
+		if err := p.Signal(sig); err != nil {
+			log.Printf("Warning: failed to signal ffmpeg for job %s: %v", id, err)
+		}
+	}
+}
+
+// pauseReasons returns why running encodes are paused, if they are.
+func (d *Daemon) pauseReasons() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reasons := make([]string, 0, len(d.pauses))
+	for r := range d.pauses {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// reniceRunning sets the nice level of every running ffmpeg process.
+func (d *Daemon) reniceRunning(nice int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, p := range d.procs {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, p.Pid, nice); err != nil {
+			log.Printf("Warning: failed to renice ffmpeg for job %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// dynamicHDR describes a source's Dolby Vision and HDR10+ metadata, e.g.
+// "Dolby Vision profile 8.1, HDR10+", or returns "" if it has neither.
+func dynamicHDR(probeResult *metadata.ProbeResult) string {
+	v := probeResult.VideoStream
+	if v == nil {
+		return ""
+	}
+	var formats []string
+	if dv := v.DolbyVision(); dv != nil {
+		formats = append(formats, dv.String())
+	}
+	if v.HasHDR10Plus() {
+		formats = append(formats, "HDR10+")
+	}
+	return strings.Join(formats, ", ")
+}
+
+// dynamicHDRPolicy applies a profile's dynamic_hdr policy to a source. It
+// returns whether the source is skipped, and the reason or, for a source
+// that is encoded, a note on what happens to its dynamic metadata. Both are
+// empty for sources without Dolby Vision or HDR10+.
+func dynamicHDRPolicy(profile config.ProfileConfig, probeResult *metadata.ProbeResult) (bool, string) {
+	formats := dynamicHDR(probeResult)
+	if formats == "" {
+		return false, ""
+	}
+	switch profile.DynamicHDR {
+	case config.DynamicHDRAllow:
+		return false, fmt.Sprintf("%s: encoded as is (dynamic_hdr %s); the encoder may not keep the dynamic metadata", formats, profile.DynamicHDR)
+	case config.DynamicHDRBaseLayer:
+		if dv := probeResult.VideoStream.DolbyVision(); dv != nil && !dv.HasHDR10Base() {
+			return true, fmt.Sprintf("%s: no HDR10 base layer to keep (dynamic_hdr %s)", formats, profile.DynamicHDR)
+		}
+		return false, fmt.Sprintf("%s: encoded as the HDR10 base layer, dynamic metadata dropped (dynamic_hdr %s)", formats, profile.DynamicHDR)
+	}
+	return true, fmt.Sprintf("%s: left alone (dynamic_hdr %s)", formats, profile.DynamicHDR)
+}
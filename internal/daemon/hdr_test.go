@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+var hdr10Plus = metadata.SideData{Type: metadata.SideDataHDR10Plus}
+
+// dolbyVision returns a Dolby Vision configuration record.
+func dolbyVision(profile, blCompatibilityID int) metadata.SideData {
+	return metadata.SideData{
+		Type:              metadata.SideDataDolbyVision,
+		DVProfile:         metadata.FlexibleInt(profile),
+		DVLevel:           6,
+		RPUPresent:        1,
+		BLPresent:         1,
+		BLCompatibilityID: metadata.FlexibleInt(blCompatibilityID),
+	}
+}
+
+// hdrSource returns a probe result of a PQ video stream with side data.
+func hdrSource(sideData ...metadata.SideData) *metadata.ProbeResult {
+	v := metadata.StreamInfo{
+		CodecType:     "video",
+		CodecName:     "hevc",
+		PixFmt:        "yuv420p10le",
+		ColorTransfer: metadata.TransferPQ,
+		SideDataList:  sideData,
+	}
+	return &metadata.ProbeResult{HasVideo: true, Streams: []metadata.StreamInfo{v}, VideoStream: &v}
+}
+
+func TestDynamicHDRPolicy(t *testing.T) {
+	type outcome struct {
+		skip   bool
+		reason string // substring of the reason
+	}
+	var (
+		leftAlone = outcome{true, "left alone (dynamic_hdr skip)"}
+		noBase    = outcome{true, "no HDR10 base layer to keep (dynamic_hdr base_layer)"}
+		baseLayer = outcome{false, "encoded as the HDR10 base layer"}
+		asIs      = outcome{false, "encoded as is (dynamic_hdr allow)"}
+	)
+	tests := []struct {
+		name    string
+		source  *metadata.ProbeResult
+		formats string
+		// by policy
+		skip, base, allow outcome
+	}{
+		{"profile 5, BL id 0", hdrSource(dolbyVision(5, 0)), "Dolby Vision profile 5", leftAlone, noBase, asIs},
+		{"profile 8.1, BL id 1 (HDR10)", hdrSource(dolbyVision(8, 1)), "Dolby Vision profile 8.1", leftAlone, baseLayer, asIs},
+		{"profile 8.2, BL id 2 (SDR)", hdrSource(dolbyVision(8, 2)), "Dolby Vision profile 8.2", leftAlone, noBase, asIs},
+		{"profile 8.4, BL id 4 (HLG)", hdrSource(dolbyVision(8, 4)), "Dolby Vision profile 8.4", leftAlone, noBase, asIs},
+		{"profile 7, BL id 6 (Blu-ray HDR10)", hdrSource(dolbyVision(7, 6)), "Dolby Vision profile 7", leftAlone, baseLayer, asIs},
+		{"profile 8.1 with HDR10+", hdrSource(dolbyVision(8, 1), hdr10Plus), "Dolby Vision profile 8.1, HDR10+", leftAlone, baseLayer, asIs},
+		{"HDR10+ only", hdrSource(hdr10Plus), "HDR10+", leftAlone, baseLayer, asIs},
+		{"HDR10", hdrSource(), "", outcome{}, outcome{}, outcome{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dynamicHDR(tt.source); got != tt.formats {
+				t.Errorf("dynamicHDR = %q, want %q", got, tt.formats)
+			}
+			for policy, want := range map[string]outcome{
+				config.DynamicHDRSkip:      tt.skip,
+				config.DynamicHDRBaseLayer: tt.base,
+				config.DynamicHDRAllow:     tt.allow,
+			} {
+				skip, reason := dynamicHDRPolicy(config.ProfileConfig{DynamicHDR: policy}, tt.source)
+				if skip != want.skip || !strings.Contains(reason, want.reason) || !strings.HasPrefix(reason, tt.formats) {
+					t.Errorf("%s: got %t %q, want %t and a reason with %q", policy, skip, reason, want.skip, want.reason)
+				}
+				if want.reason == "" && reason != "" {
+					t.Errorf("%s: reason %q for a source without dynamic metadata", policy, reason)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyOutputDynamicHDR(t *testing.T) {
+	var output *metadata.ProbeResult
+	orig := probeFile
+	t.Cleanup(func() { probeFile = orig })
+	probeFile = func(_, _ string) (*metadata.ProbeResult, error) { return output, nil }
+
+	source := hdrSource(dolbyVision(8, 1), hdr10Plus)
+	tests := []struct {
+		name     string
+		output   *metadata.ProbeResult
+		stripped bool
+		problem  string // "" = passes
+	}{
+		{"base layer encode", hdrSource(), true, ""},
+		{"HDR10+ left", hdrSource(hdr10Plus), true, "HDR10+ metadata left in the HDR10 base layer encode"},
+		{"Dolby Vision left", hdrSource(dolbyVision(8, 1)), true, "Dolby Vision profile 8.1 metadata left"},
+		{"allowed to keep it", hdrSource(hdr10Plus), false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output = tt.output
+			err := verifyOutput("ffmpeg", "/lib/out.mkv", source, tt.stripped)
+			if tt.problem == "" {
+				if err != nil {
+					t.Errorf("verifyOutput = %v, want nil", err)
+				}
+				return
+			}
+			var verr *ffmpeg.VerifyError
+			if !errors.As(err, &verr) || !strings.Contains(err.Error(), tt.problem) {
+				t.Errorf("verifyOutput = %v, want a *ffmpeg.VerifyError with %q", err, tt.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// sseKeepalive is how often an idle event stream gets a comment line, so
+// proxies and clients don't time the connection out.
+const sseKeepalive = 15 * time.Second
+
+// RunningJob is a running job with its latest encode progress, if any yet.
+type RunningJob struct {
+	jobs.Job
+	Progress *ffmpeg.Progress `json:"progress,omitempty"`
+}
+
+// SystemStatus is the daemon and host status served at /api/status.
+type SystemStatus struct {
+	StartedAt     time.Time     `json:"started_at"`
+	UptimeSec     int64         `json:"uptime_sec"`
+	FFmpegPath    string        `json:"ffmpeg_path"`
+	Devices       []string      `json:"devices"`
+	Queue         QueueState    `json:"queue"`
+	Running       []RunningJob  `json:"running"`
+	LastScan      *ScanSummary  `json:"last_scan,omitempty"`
+	Schedule      ScheduleState `json:"schedule"`
+	PausedFor     []string      `json:"paused_for"` // why running encodes are paused, if they are
+	Throttle      ThrottleState `json:"throttle"`
+	CPUPercent    float64       `json:"cpu_percent"`
+	MemoryPercent float64       `json:"memory_percent"`
+	Load1         float64       `json:"load1"`
+	Load5         float64       `json:"load5"`
+	Load15        float64       `json:"load15"`
+}
+
+// ServeHTTP serves the read-only HTTP API on HTTPListen until ctx is cancelled.
+//
+//	GET /api/jobs        list jobs (?status=pending&path=substring)
+//	GET /api/jobs/{id}   get one job
+//	GET /api/queue       queue state
+//	GET /api/scan        summary of the last library scan
+//	GET /api/status      daemon and host status, with progress of running jobs
+//	GET /api/events      Server-Sent Events stream (?types=job,job_deleted,progress,scan)
+//	GET /metrics         Prometheus metrics
+//
+// Changing the queue is left to the control socket, which is protected by
+// file permissions; this listener has no authentication.
+func (d *Daemon) ServeHTTP(ctx context.Context) error {
+	addr := d.config().HTTPListen
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler:           d.httpHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Event streams end when the daemon stops
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("HTTP API listening on %s", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// httpHandler builds the routes of the HTTP API.
+func (d *Daemon) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, FilterJobs(d.queue.All(), r.URL.Query().Get("status"), r.URL.Query().Get("path")))
+	})
+	mux.HandleFunc("GET /api/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := d.queue.Get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("GET /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.QueueState())
+	})
+	mux.HandleFunc("GET /api/scan", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		summary := d.lastScan
+		d.mu.Unlock()
+		if summary == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no scan has finished yet"))
+			return
+		}
+		writeJSON(w, http.StatusOK, summary)
+	})
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.Status())
+	})
+	mux.HandleFunc("GET /api/events", d.serveEvents)
+	mux.HandleFunc("GET /metrics", d.serveMetrics)
+
+	return mux
+}
+
+// Status returns the daemon and host status.
+func (d *Daemon) Status() SystemStatus {
+	status := SystemStatus{
+		StartedAt:  d.startedAt,
+		UptimeSec:  int64(time.Since(d.startedAt).Seconds()),
+		FFmpegPath: d.ffmpegPath,
+		Devices:    d.limiter.Devices(),
+		Queue:      d.QueueState(),
+		Running:    []RunningJob{},
+		Schedule:   d.schedule.Load().At(time.Now()),
+		PausedFor:  d.pauseReasons(),
+		Throttle:   d.throttle.State(),
+	}
+
+	d.mu.Lock()
+	status.LastScan = d.lastScan
+	for id := range d.running {
+		job, ok := d.queue.Get(id)
+		if !ok {
+			continue
+		}
+		rj := RunningJob{Job: job}
+		if p, ok := d.progress[id]; ok {
+			rj.Progress = &p.Progress
+		}
+		status.Running = append(status.Running, rj)
+	}
+	d.mu.Unlock()
+
+	if percents, err := cpu.Percent(0, false); err == nil && len(percents) > 0 {
+		status.CPUPercent = percents[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		status.MemoryPercent = vm.UsedPercent
+	}
+	if avg, err := load.Avg(); err == nil {
+		status.Load1, status.Load5, status.Load15 = avg.Load1, avg.Load5, avg.Load15
+	}
+	return status
+}
+
+// serveEvents streams daemon events as Server-Sent Events. Each event is
+// sent as "event: <type>" with the JSON-encoded Event as its data.
+func (d *Daemon) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	var types map[string]bool
+	if t := r.URL.Query().Get("types"); t != "" {
+		types = make(map[string]bool)
+		for _, name := range strings.Split(t, ",") {
+			types[strings.TrimSpace(name)] = true
+		}
+	}
+
+	events, unsubscribe := d.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case ev := <-events:
+			if types != nil && !types[ev.Type] {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
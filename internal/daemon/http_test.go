@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+func TestServeEvents(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	srv := httptest.NewServer(d.httpHandler())
+	defer srv.Close()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(srv.URL + "/api/events?types=job,job_deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+
+	// The stream is subscribed once the headers are sent
+	job := addJob(t, d.queue, "/lib/movie.mkv", jobs.JobStatusPending)
+	d.events.Publish(Event{Type: EventProgress, Progress: &JobProgress{JobID: job.ID}})
+	d.events.Publish(Event{Type: EventScan, Scan: &ScanSummary{}})
+	if _, err := d.DeleteJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() (string, Event) {
+		t.Helper()
+		var typ string
+		for lines.Scan() {
+			line := lines.Text()
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				typ = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				var ev Event
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					t.Fatal(err)
+				}
+				return typ, ev
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return "", Event{}
+	}
+
+	// Progress and scan events are filtered out
+	for _, want := range []string{EventJob, EventJobDeleted} {
+		typ, ev := next()
+		if typ != want || ev.Type != want || ev.Job == nil || ev.Job.ID != job.ID {
+			t.Errorf("got %s event %+v, want %s for job %s", typ, ev, want, job.ID)
+		}
+	}
+}
+
+func TestHTTPJobs(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	h := d.httpHandler()
+	done := addJob(t, d.queue, "/lib/done.mkv", jobs.JobStatusSuccess)
+	addJob(t, d.queue, "/lib/pending.mkv", jobs.JobStatusPending)
+
+	var list []jobs.Job
+	if code := call(t, h, "GET", "/api/jobs?status=success", "", &list); code != http.StatusOK || len(list) != 1 || list[0].ID != done.ID {
+		t.Errorf("GET /api/jobs?status=success = %d, %v", code, list)
+	}
+	if code := call(t, h, "GET", "/api/jobs/nope", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET /api/jobs/nope = %d", code)
+	}
+	if code := call(t, h, "GET", "/api/scan", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET /api/scan before a scan = %d", code)
+	}
+
+	// The HTTP API is read-only
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/api/jobs/"+done.ID, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /api/jobs/{id} = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+	if _, ok := d.queue.Get(done.ID); !ok {
+		t.Error("job deleted through the HTTP API")
+	}
+}
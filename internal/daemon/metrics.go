@@ -0,0 +1,294 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// Histogram buckets for encode durations (seconds) and achieved size ratios.
+var (
+	encodeDurationBuckets = []float64{60, 300, 600, 1200, 1800, 3600, 7200, 14400, 28800}
+	sizeRatioBuckets      = []float64{0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1.0, 1.25}
+)
+
+// Metrics aggregates job outcomes and scan results for the Prometheus
+// /metrics endpoint. Counters cover the daemon's lifetime; totals over the
+// whole job history are exported as gauges computed from the queue.
+type Metrics struct {
+	mu             sync.Mutex
+	jobsFinished   map[jobOutcome]float64
+	bytesSaved     float64
+	bytesProcessed float64
+	encodeSeconds  float64
+	retries        map[string]float64 // by failure category
+	encodeDuration *histogram
+	sizeRatio      *histogram
+	scans          float64
+	lastScan       *ScanSummary
+}
+
+// jobOutcome labels a finished job.
+type jobOutcome struct {
+	status string
+	reason string
+}
+
+// NewMetrics creates an empty metrics set.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		jobsFinished:   make(map[jobOutcome]float64),
+		retries:        make(map[string]float64),
+		encodeDuration: newHistogram(encodeDurationBuckets),
+		sizeRatio:      newHistogram(sizeRatioBuckets),
+	}
+}
+
+// ObserveJob records a job a worker has finished with. Jobs that did not
+// reach a final status (e.g. interrupted by shutdown) are ignored.
+func (m *Metrics) ObserveJob(job jobs.Job) {
+	switch job.Status {
+	case jobs.JobStatusSuccess, jobs.JobStatusFailed, jobs.JobStatusSkipped:
+	default:
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.jobsFinished[jobOutcome{string(job.Status), ReasonCategory(job)}]++
+
+	// Only encodes that produced an output count towards throughput
+	if job.NewSize <= 0 || job.OriginalSize <= 0 {
+		return
+	}
+	m.bytesProcessed += float64(job.OriginalSize)
+	m.sizeRatio.observe(float64(job.NewSize) / float64(job.OriginalSize))
+	if job.Status == jobs.JobStatusSuccess {
+		m.bytesSaved += float64(job.OriginalSize - job.NewSize)
+	}
+	if job.StartedAt != nil && job.FinishedAt != nil {
+		secs := job.FinishedAt.Sub(*job.StartedAt).Seconds()
+		m.encodeSeconds += secs
+		m.encodeDuration.observe(secs)
+	}
+}
+
+// ObserveRetry records a failed attempt that will be retried.
+func (m *Metrics) ObserveRetry(category ffmpeg.FailureCategory) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries[string(category)]++
+}
+
+// ObserveScan records a finished library scan.
+func (m *Metrics) ObserveScan(summary *ScanSummary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scans++
+	m.lastScan = summary
+}
+
+// ReasonCategory buckets a job's free-form Reason into a short, stable label.
+// Failed jobs use their failure category.
+func ReasonCategory(job jobs.Job) string {
+	reason := job.Reason
+	switch {
+	case job.Status == jobs.JobStatusSuccess:
+		return "none"
+	case job.Status == jobs.JobStatusFailed && job.FailureCategory != "":
+		return job.FailureCategory
+	case strings.HasPrefix(reason, "size gate"):
+		return "size_gate"
+	case reason == errCancelledByUser.Error(), reason == errSkippedByUser.Error():
+		return "user"
+	case strings.HasPrefix(reason, "ffprobe failed"):
+		return "probe"
+	case strings.HasPrefix(reason, "ffmpeg exit code"), strings.HasPrefix(reason, "failed to build ffmpeg args"):
+		return "ffmpeg"
+	case strings.HasPrefix(reason, "output verification failed"):
+		return "verification"
+	case strings.HasPrefix(reason, "failed to stat output"),
+		strings.HasPrefix(reason, "failed to replace file"),
+		strings.HasPrefix(reason, "replaced file verification failed"):
+		return "io"
+	default:
+		return "other"
+	}
+}
+
+// writeMetrics writes the daemon's metrics in the Prometheus text format.
+func (d *Daemon) writeMetrics(w io.Writer) {
+	m := d.metrics
+	m.mu.Lock()
+	outcomes := make([]jobOutcome, 0, len(m.jobsFinished))
+	for o := range m.jobsFinished {
+		outcomes = append(outcomes, o)
+	}
+	sort.Slice(outcomes, func(i, j int) bool {
+		if outcomes[i].status != outcomes[j].status {
+			return outcomes[i].status < outcomes[j].status
+		}
+		return outcomes[i].reason < outcomes[j].reason
+	})
+
+	writeHeader(w, "av1d_jobs_finished_total", "counter", "Jobs finished by workers, by final status and reason category.")
+	for _, o := range outcomes {
+		fmt.Fprintf(w, "av1d_jobs_finished_total{status=%s,reason=%s} %g\n", label(o.status), label(o.reason), m.jobsFinished[o])
+	}
+	writeHeader(w, "av1d_job_retries_total", "counter", "Failed attempts scheduled for a retry, by failure category.")
+	for _, category := range sortedKeys(m.retries) {
+		fmt.Fprintf(w, "av1d_job_retries_total{category=%s} %g\n", label(category), m.retries[category])
+	}
+	writeMetric(w, "av1d_bytes_saved_total", "counter", "Bytes saved by successful encodes.", m.bytesSaved)
+	writeMetric(w, "av1d_bytes_processed_total", "counter", "Source bytes of encodes that produced an output.", m.bytesProcessed)
+	writeMetric(w, "av1d_encode_seconds_total", "counter", "Wall-clock seconds spent in encodes that produced an output.", m.encodeSeconds)
+	m.encodeDuration.write(w, "av1d_encode_duration_seconds", "Duration of encodes that produced an output.")
+	m.sizeRatio.write(w, "av1d_size_ratio", "Output size divided by source size of finished encodes.")
+
+	writeMetric(w, "av1d_scans_total", "counter", "Library scans completed.", m.scans)
+	if scan := m.lastScan; scan != nil {
+		writeMetric(w, "av1d_last_scan_timestamp_seconds", "gauge", "Unix time the last library scan finished.", float64(scan.FinishedAt.Unix()))
+		writeHeader(w, "av1d_scan_duration_seconds", "gauge", "Duration of the last scan of each library root.")
+		for _, r := range scan.Roots {
+			fmt.Fprintf(w, "av1d_scan_duration_seconds{root=%s} %g\n", label(r.Root), r.Duration.Seconds())
+		}
+		writeHeader(w, "av1d_scan_files", "gauge", "Media files seen in the last scan of each library root, by result.")
+		for _, r := range scan.Roots {
+			root := label(r.Root)
+			fmt.Fprintf(w, "av1d_scan_files{root=%s,result=\"candidate\"} %d\n", root, r.Candidates)
+			fmt.Fprintf(w, "av1d_scan_files{root=%s,result=\"skipped\"} %d\n", root, r.Skipped)
+			fmt.Fprintf(w, "av1d_scan_files{root=%s,result=\"unchanged\"} %d\n", root, r.Unchanged)
+			fmt.Fprintf(w, "av1d_scan_files{root=%s,result=\"settling\"} %d\n", root, r.Settling)
+			fmt.Fprintf(w, "av1d_scan_files{root=%s,result=\"excluded\"} %d\n", root, r.Excluded)
+		}
+	}
+	m.mu.Unlock()
+
+	state := d.QueueState()
+	writeMetric(w, "av1d_queue_depth", "gauge", "Pending jobs waiting for an encode slot.", float64(state.Pending))
+	writeMetric(w, "av1d_queue_waiting", "gauge", "Pending jobs not yet eligible, backing off before a retry or waiting for the file to settle.", float64(state.Waiting))
+	writeMetric(w, "av1d_running_jobs", "gauge", "Jobs currently being processed.", float64(state.Running))
+	writeMetric(w, "av1d_space_reserved_bytes", "gauge", "Disk space running encodes are still expected to write.", float64(d.space.Reserved()))
+	writeMetric(w, "av1d_encode_slots", "gauge", "Encode slots across all devices.", float64(state.Capacity))
+	paused := 0.0
+	if state.Paused {
+		paused = 1
+	}
+	writeMetric(w, "av1d_queue_paused", "gauge", "Whether the queue is paused (1) or not (0).", paused)
+	open := 0.0
+	if d.schedule.Load().At(time.Now()).Open {
+		open = 1
+	}
+	writeMetric(w, "av1d_schedule_open", "gauge", "Whether an encoding window is open (1) or not (0).", open)
+	writeMetric(w, "av1d_encodes_paused", "gauge", "Whether running encodes are paused (1) or not (0).", float64(min(len(d.pauseReasons()), 1)))
+	if d.throttle.Enabled() {
+		st := d.throttle.State()
+		throttled := 0.0
+		if st.Throttled {
+			throttled = 1
+		}
+		writeMetric(w, "av1d_throttled", "gauge", "Whether the host is over a throttle limit (1) or not (0).", throttled)
+		writeMetric(w, "av1d_throttle_load_per_cpu", "gauge", "Last sampled 1-minute load average per CPU core.", st.LoadPerCPU)
+		writeMetric(w, "av1d_throttle_temp_celsius", "gauge", "Last sampled temperature of the hottest watched sensor.", st.TempC)
+	}
+
+	// Totals over the persisted job history
+	byStatus := map[jobs.JobStatus]int{
+		jobs.JobStatusPending: 0,
+		jobs.JobStatusRunning: 0,
+		jobs.JobStatusSuccess: 0,
+		jobs.JobStatusFailed:  0,
+		jobs.JobStatusSkipped: 0,
+	}
+	var historySaved int64
+	for _, job := range d.queue.All() {
+		byStatus[job.Status]++
+		if job.Status == jobs.JobStatusSuccess && job.NewSize > 0 {
+			historySaved += job.OriginalSize - job.NewSize
+		}
+	}
+	statuses := make([]string, 0, len(byStatus))
+	for s := range byStatus {
+		statuses = append(statuses, string(s))
+	}
+	sort.Strings(statuses)
+	writeHeader(w, "av1d_jobs", "gauge", "Jobs in the job store, by status.")
+	for _, s := range statuses {
+		fmt.Fprintf(w, "av1d_jobs{status=%s} %d\n", label(s), byStatus[jobs.JobStatus(s)])
+	}
+	writeMetric(w, "av1d_history_bytes_saved", "gauge", "Bytes saved by all successful jobs in the job store.", float64(historySaved))
+	writeMetric(w, "av1d_uptime_seconds", "gauge", "Seconds since the daemon started.", time.Since(d.startedAt).Seconds())
+}
+
+// serveMetrics serves /metrics.
+func (d *Daemon) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	d.writeMetrics(w)
+}
+
+// sortedKeys returns a map's keys in order, for stable output.
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// histogram is a cumulative Prometheus histogram. Callers hold Metrics.mu.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	writeHeader(w, name, "histogram", help)
+	for i, le := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeMetric(w io.Writer, name, typ, help string, value float64) {
+	writeHeader(w, name, typ, help)
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+// labelEscaper escapes label values for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value.
+func label(s string) string {
+	return `"` + labelEscaper.Replace(s) + `"`
+}
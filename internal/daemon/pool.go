@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"context"
+)
+
+// Limiter bounds how much work runs at once.
+// Encode slots are handed out per render node, so a GPU that can run two AV1
+// sessions gets two slots; probes have their own, separate limit.
+type Limiter struct {
+	devices []string
+	slots   chan string
+	probes  chan struct{}
+}
+
+// NewLimiter creates a limiter with perDevice encode slots on each device and
+// maxProbes concurrent probes. An empty device name means "let VAAPI pick".
+func NewLimiter(devices []string, perDevice, maxProbes int) *Limiter {
+	if len(devices) == 0 {
+		devices = []string{""}
+	}
+	if perDevice < 1 {
+		perDevice = 1
+	}
+	if maxProbes < 1 {
+		maxProbes = 1
+	}
+
+	l := &Limiter{
+		devices: devices,
+		slots:   make(chan string, len(devices)*perDevice),
+		probes:  make(chan struct{}, maxProbes),
+	}
+	// Interleave slots so consecutive jobs spread across devices
+	for i := 0; i < perDevice; i++ {
+		for _, device := range devices {
+			l.slots <- device
+		}
+	}
+	return l
+}
+
+// Devices returns the render nodes the limiter schedules onto.
+func (l *Limiter) Devices() []string {
+	return l.devices
+}
+
+// Capacity returns the total number of encode slots.
+func (l *Limiter) Capacity() int {
+	return cap(l.slots)
+}
+
+// AcquireEncode blocks until an encode slot is free and returns its device
+// along with a function that releases the slot.
+func (l *Limiter) AcquireEncode(ctx context.Context) (string, func(), error) {
+	select {
+	case device := <-l.slots:
+		return device, func() { l.slots <- device }, nil
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+}
+
+// AcquireProbe blocks until a probe slot is free and returns its release function.
+func (l *Limiter) AcquireProbe() func() {
+	l.probes <- struct{}{}
+	return func() { <-l.probes }
+}
@@ -0,0 +1,69 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLimiterInterleavesDevices(t *testing.T) {
+	l := NewLimiter([]string{"/dev/dri/renderD128", "/dev/dri/renderD129"}, 2, 1)
+	if l.Capacity() != 4 {
+		t.Fatalf("Capacity() = %d, want 4", l.Capacity())
+	}
+
+	ctx := context.Background()
+	var got []string
+	var releases []func()
+	for i := 0; i < l.Capacity(); i++ {
+		device, release, err := l.AcquireEncode(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, device)
+		releases = append(releases, release)
+	}
+	want := []string{"/dev/dri/renderD128", "/dev/dri/renderD129", "/dev/dri/renderD128", "/dev/dri/renderD129"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("slots handed out %q, want %q", got, want)
+	}
+
+	// Every slot is taken
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := l.AcquireEncode(timeout); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireEncode on a full limiter = %v, want a timeout", err)
+	}
+
+	// A released slot goes back to its own device
+	releases[1]()
+	if device, _, err := l.AcquireEncode(ctx); err != nil || device != "/dev/dri/renderD129" {
+		t.Errorf("AcquireEncode after release = %q, %v, want renderD129", device, err)
+	}
+}
+
+func TestLimiterDefaults(t *testing.T) {
+	l := NewLimiter(nil, 0, 0)
+	if l.Capacity() != 1 || !reflect.DeepEqual(l.Devices(), []string{""}) {
+		t.Errorf("NewLimiter(nil, 0, 0) = devices %q, capacity %d", l.Devices(), l.Capacity())
+	}
+	release := l.AcquireProbe()
+	acquired := make(chan struct{})
+	go func() {
+		l.AcquireProbe()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second probe ran while the only probe slot was taken")
+	case <-time.After(10 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("probe slot not released")
+	}
+}
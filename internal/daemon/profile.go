@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"log"
+	"os"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// profileQuality returns the encoder quality a profile gives a source, from
+// its quality table or else the built-in one.
+func profileQuality(profile config.ProfileConfig, probeResult *metadata.ProbeResult) int {
+	if probeResult.VideoStream == nil {
+		return 24
+	}
+	height := probeResult.VideoStream.Height
+	if quality, ok := profile.QualityFor(height); ok {
+		return quality
+	}
+	return ffmpeg.DetermineQuality(height)
+}
+
+// encodeSettings turns a profile into the settings for encoding one source.
+func encodeSettings(profile config.ProfileConfig, probeResult *metadata.ProbeResult) ffmpeg.EncodeSettings {
+	return ffmpeg.EncodeSettings{
+		Encoder:          profile.Encoder,
+		StripDynamicHDR:  profile.DynamicHDR == config.DynamicHDRBaseLayer && dynamicHDR(probeResult) != "",
+		Quality:          profileQuality(profile, probeResult),
+		CompressionLevel: profile.CompressionLevel,
+		ExtraArgs:        profile.ExtraArgs,
+		Audio:            trackPolicy(profile, profile.AudioLanguages, profile.DropAudioLanguages),
+		Subtitles:        trackPolicy(profile, profile.SubtitleLanguages, profile.DropSubtitleLanguages),
+	}
+}
+
+// trackPolicy builds the audio or subtitle track policy of a profile from
+// its keep and drop languages for that track type.
+func trackPolicy(profile config.ProfileConfig, keep, drop []string) ffmpeg.TrackPolicy {
+	return ffmpeg.TrackPolicy{
+		Keep:           keep,
+		Drop:           drop,
+		DropUntagged:   profile.UntaggedTracks == config.TracksDrop,
+		DropCommentary: profile.CommentaryTracks == config.TracksDrop,
+	}
+}
+
+// jobProfile returns the profile a job was queued with, which a selection
+// rule may have chosen, or else the profile of its library.
+func jobProfile(cfg config.TranscodeConfig, job jobs.Job) (string, config.ProfileConfig) {
+	if _, ok := cfg.Profiles[job.Profile]; ok || job.Profile == config.DefaultProfile {
+		return job.Profile, cfg.Profile(job.Profile)
+	}
+	return cfg.ProfileFor(job.SourcePath)
+}
+
+// selectEncoder returns the encoder to use for a profile's encoder setting.
+// A GPU encoder falls back to SVT-AV1 on the CPU while there is no render
+// node to run it on, or when the startup self-test found it broken, so
+// encoding carries on while the card is out.
+func (d *Daemon) selectEncoder(cfg config.TranscodeConfig, name string) string {
+	enc, err := ffmpeg.LookupEncoder(name)
+	if err != nil || !enc.Hardware() {
+		return name
+	}
+	if d.brokenEncoders[enc.Name()] {
+		log.Printf("%s failed the self-test, using %s instead", enc.Name(), ffmpeg.EncoderSVT)
+		return ffmpeg.EncoderSVT
+	}
+	if !gpuAvailable(cfg) {
+		log.Printf("No GPU render node available, using %s instead of %s", ffmpeg.EncoderSVT, enc.Name())
+		return ffmpeg.EncoderSVT
+	}
+	return name
+}
+
+// DisableEncoder makes jobs whose profile uses a GPU encoder encode with
+// SVT-AV1 instead, e.g. because it failed the self-test. Call it before Run.
+func (d *Daemon) DisableEncoder(name string) {
+	d.brokenEncoders[name] = true
+}
+
+// DisableHDR10 records that an encoder drops HDR10 static metadata, which
+// would fail the verification of every HDR10 encode. Sources carrying it are
+// encoded with SVT-AV1 instead if fallback is true, and skipped otherwise.
+// Call it before Run.
+func (d *Daemon) DisableHDR10(name string, fallback bool) {
+	d.hdr10Fallback[name] = fallback
+}
+
+// hdr10Encoder returns the encoder for a source: encoder itself, unless the
+// source has HDR10 static metadata that encoder drops. ok is false if no
+// encoder can keep it.
+func (d *Daemon) hdr10Encoder(encoder string, probeResult *metadata.ProbeResult) (string, bool) {
+	fallback, drops := d.hdr10Fallback[encoder]
+	v := probeResult.VideoStream
+	if !drops || v == nil || (v.MasteringDisplay() == nil && v.ContentLightLevel() == nil) {
+		return encoder, true
+	}
+	if !fallback {
+		return "", false
+	}
+	log.Printf("%s drops HDR10 metadata, using %s instead", encoder, ffmpeg.EncoderSVT)
+	return ffmpeg.EncoderSVT, true
+}
+
+// gpuAvailable reports whether a render node is present: one of the
+// configured render_nodes, or any node if none are configured.
+func gpuAvailable(cfg config.TranscodeConfig) bool {
+	if len(cfg.RenderNodes) == 0 {
+		return len(ffmpeg.FindRenderNodes()) > 0
+	}
+	for _, node := range cfg.RenderNodes {
+		if _, err := os.Stat(node); err == nil {
+			return true
+		}
+	}
+	return false
+}
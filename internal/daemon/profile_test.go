@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+func TestHDR10Encoder(t *testing.T) {
+	probe := func(sideData ...metadata.SideData) *metadata.ProbeResult {
+		return &metadata.ProbeResult{VideoStream: &metadata.StreamInfo{ColorTransfer: metadata.TransferPQ, SideDataList: sideData}}
+	}
+	mastering := metadata.SideData{Type: metadata.SideDataMasteringDisplay, MaxLuminance: "10000000/10000"}
+	light := metadata.SideData{Type: metadata.SideDataContentLight, MaxContent: 1000, MaxAverage: 400}
+
+	d := &Daemon{hdr10Fallback: map[string]bool{
+		ffmpeg.EncoderVAAPI: true,
+		ffmpeg.EncoderQSV:   false,
+	}}
+	tests := []struct {
+		name    string
+		encoder string
+		probe   *metadata.ProbeResult
+		want    string
+		ok      bool
+	}{
+		{"keeps metadata", ffmpeg.EncoderSVT, probe(mastering, light), ffmpeg.EncoderSVT, true},
+		{"falls back", ffmpeg.EncoderVAAPI, probe(mastering, light), ffmpeg.EncoderSVT, true},
+		{"content light only", ffmpeg.EncoderVAAPI, probe(light), ffmpeg.EncoderSVT, true},
+		{"no fallback", ffmpeg.EncoderQSV, probe(mastering), "", false},
+		{"PQ without static metadata", ffmpeg.EncoderQSV, probe(), ffmpeg.EncoderQSV, true},
+		{"no video", ffmpeg.EncoderQSV, &metadata.ProbeResult{}, ffmpeg.EncoderQSV, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := d.hdr10Encoder(tt.encoder, tt.probe)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("hdr10Encoder(%s) = %q, %t, want %q, %t", tt.encoder, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSelectEncoder(t *testing.T) {
+	node := filepath.Join(t.TempDir(), "renderD128")
+	if err := os.WriteFile(node, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	withGPU := config.TranscodeConfig{RenderNodes: []string{"/dev/dri/missing", node}}
+	withoutGPU := config.TranscodeConfig{RenderNodes: []string{"/dev/dri/missing"}}
+
+	d := &Daemon{brokenEncoders: make(map[string]bool)}
+	d.DisableEncoder(ffmpeg.EncoderQSV)
+	tests := []struct {
+		name    string
+		cfg     config.TranscodeConfig
+		encoder string
+		want    string
+	}{
+		{"GPU encoder", withGPU, ffmpeg.EncoderVAAPI, ffmpeg.EncoderVAAPI},
+		{"failed the self-test", withGPU, ffmpeg.EncoderQSV, ffmpeg.EncoderSVT},
+		{"no render node", withoutGPU, ffmpeg.EncoderVAAPI, ffmpeg.EncoderSVT},
+		{"CPU encoder", withoutGPU, ffmpeg.EncoderSVT, ffmpeg.EncoderSVT},
+		{"unknown encoder", withoutGPU, "libaom-av1", "libaom-av1"},
+	}
+	for _, tt := range tests {
+		if got := d.selectEncoder(tt.cfg, tt.encoder); got != tt.want {
+			t.Errorf("%s: selectEncoder(%s) = %s, want %s", tt.name, tt.encoder, got, tt.want)
+		}
+	}
+}
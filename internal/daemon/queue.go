@@ -0,0 +1,395 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// ErrJobBusy is returned when a job is claimed by a worker and cannot be
+// changed by anyone else.
+var ErrJobBusy = errors.New("job is being processed")
+
+// Queue is the daemon's persistent job queue.
+// Jobs are kept in memory for lookups and written through to JobStateDir
+// with jobs.SaveJob, so the queue survives restarts and av1top can read it.
+//
+// A job is owned by whoever holds its claim. Unclaimed jobs are only changed
+// under the queue lock via Update; a claimed job is changed by its worker,
+// which publishes each state transition with Save. Readers get copies, taken
+// from the last published state for claimed jobs.
+type Queue struct {
+	mu      sync.Mutex
+	dir     string
+	jobs    map[string]*jobs.Job // by ID
+	byPath  map[string]*jobs.Job
+	claimed map[string]jobs.Job // last published state of claimed jobs
+	paused  bool
+	ready   chan struct{}
+
+	onChange func(jobs.Job, bool) // called with each persisted change, under mu
+}
+
+// NewQueue creates a queue backed by the given job state directory and
+// loads any jobs already persisted there.
+func NewQueue(jobStateDir string) (*Queue, error) {
+	existing, err := jobs.LoadAllJobs(jobStateDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+
+	q := &Queue{
+		dir:     jobStateDir,
+		jobs:    make(map[string]*jobs.Job),
+		byPath:  make(map[string]*jobs.Job),
+		claimed: make(map[string]jobs.Job),
+		ready:   make(chan struct{}, 1),
+	}
+	for _, job := range existing {
+		q.jobs[job.ID] = job
+		q.byPath[job.SourcePath] = job
+	}
+	return q, nil
+}
+
+// Dir returns the job state directory backing the queue.
+func (q *Queue) Dir() string {
+	return q.dir
+}
+
+// Len returns the number of jobs known to the queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// OnChange registers fn to be called with a copy of every job change the
+// queue persists; deleted is set for a job that was removed from the queue.
+// fn runs with the queue locked and must not block or call back into the
+// queue.
+func (q *Queue) OnChange(fn func(job jobs.Job, deleted bool)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onChange = fn
+}
+
+// changed reports a persisted job change. Must be called with q.mu held.
+func (q *Queue) changed(job jobs.Job, deleted bool) {
+	if q.onChange != nil {
+		q.onChange(job, deleted)
+	}
+}
+
+// Ready returns a channel that receives a value whenever a job becomes pending.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// view returns a copy of a job that is safe to read. Must be called with q.mu held.
+func (q *Queue) view(job *jobs.Job) jobs.Job {
+	if snap, ok := q.claimed[job.ID]; ok {
+		return snap
+	}
+	return *job
+}
+
+// signal wakes a dispatcher waiting on Ready. Must be called with q.mu held.
+func (q *Queue) signal(job *jobs.Job) {
+	if job.Status != jobs.JobStatusPending {
+		return
+	}
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Lookup returns a copy of the job for a source path.
+// busy reports whether the job is currently claimed by a worker.
+func (q *Queue) Lookup(sourcePath string) (job jobs.Job, ok bool, busy bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, ok := q.byPath[sourcePath]
+	if !ok {
+		return jobs.Job{}, false, false
+	}
+	_, busy = q.claimed[j.ID]
+	return q.view(j), true, busy
+}
+
+// Get returns a copy of the job with the given ID.
+func (q *Queue) Get(id string) (jobs.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	j, ok := q.jobs[id]
+	if !ok {
+		return jobs.Job{}, false
+	}
+	return q.view(j), true
+}
+
+// Update creates or changes the job for a source path under the queue lock
+// and persists it. It returns ErrJobBusy if a worker holds the job.
+func (q *Queue) Update(sourcePath string, fn func(job *jobs.Job)) (jobs.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.byPath[sourcePath]
+	if ok {
+		if _, busy := q.claimed[job.ID]; busy {
+			return jobs.Job{}, ErrJobBusy
+		}
+	}
+
+	next := jobs.NewJob(sourcePath)
+	if ok {
+		*next = *job
+	}
+	fn(next)
+
+	if err := jobs.SaveJob(next, q.dir); err != nil {
+		return jobs.Job{}, err
+	}
+	if ok {
+		*job = *next
+	} else {
+		job = next
+		q.jobs[job.ID] = job
+		q.byPath[job.SourcePath] = job
+	}
+	q.signal(job)
+	q.changed(*job, false)
+	return *job, nil
+}
+
+// SkipPending marks the job for a source path skipped with reason, if it is
+// pending and unclaimed, so a file that no longer qualifies is not encoded
+// from an old queue entry. It reports whether it changed a job.
+func (q *Queue) SkipPending(sourcePath, reason string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.byPath[sourcePath]
+	if !ok || job.Status != jobs.JobStatusPending {
+		return false, nil
+	}
+	if _, busy := q.claimed[job.ID]; busy {
+		return false, nil
+	}
+	next := *job
+	now := time.Now()
+	next.Status = jobs.JobStatusSkipped
+	next.Reason = reason
+	next.FinishedAt = &now
+	next.NextAttemptAt = nil
+	if err := jobs.SaveJob(&next, q.dir); err != nil {
+		return false, err
+	}
+	*job = next
+	q.changed(*job, false)
+	return true, nil
+}
+
+// OutputConflict returns a pending or running job for another source whose
+// AV1 output would end up at the same path as sourcePath's (see
+// FinalOutputPath), such as movie.ts and movie.avi both becoming movie.mkv.
+func (q *Queue) OutputConflict(sourcePath string) (jobs.Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	finalPath := FinalOutputPath(sourcePath)
+	for _, job := range q.jobs {
+		if job.SourcePath == sourcePath || FinalOutputPath(job.SourcePath) != finalPath {
+			continue
+		}
+		_, busy := q.claimed[job.ID]
+		if v := q.view(job); busy || v.Status == jobs.JobStatusPending || v.Status == jobs.JobStatusRunning {
+			return v, true
+		}
+	}
+	return jobs.Job{}, false
+}
+
+// UpdateByID is Update for a job looked up by ID.
+func (q *Queue) UpdateByID(id string, fn func(job *jobs.Job)) (jobs.Job, error) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return jobs.Job{}, fmt.Errorf("job %s not found", id)
+	}
+	return q.Update(job.SourcePath, fn)
+}
+
+// Delete removes a job from the queue and deletes its file. It returns
+// ErrJobBusy if a worker holds the job.
+func (q *Queue) Delete(id string) (jobs.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return jobs.Job{}, fmt.Errorf("job %s not found", id)
+	}
+	if _, busy := q.claimed[id]; busy {
+		return jobs.Job{}, ErrJobBusy
+	}
+	if err := jobs.DeleteJob(id, q.dir); err != nil {
+		return jobs.Job{}, err
+	}
+	delete(q.jobs, id)
+	if q.byPath[job.SourcePath] == job {
+		delete(q.byPath, job.SourcePath)
+	}
+	q.changed(*job, true)
+	return *job, nil
+}
+
+// Pause stops Claim from handing out jobs. Running jobs are not affected.
+func (q *Queue) Pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = true
+}
+
+// Resume lets Claim hand out jobs again.
+func (q *Queue) Resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = false
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Paused reports whether the queue is paused.
+func (q *Queue) Paused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// Claim hands the next pending, unclaimed job to the caller, who then owns
+// it until Release. Jobs are taken by priority, highest first, then oldest
+// first; jobs waiting for a retry are passed over until their time comes.
+// Returns nil if nothing is eligible or the queue is paused.
+func (q *Queue) Claim() *jobs.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.paused {
+		return nil
+	}
+
+	now := time.Now()
+	var next *jobs.Job
+	for _, job := range q.jobs {
+		if _, busy := q.claimed[job.ID]; busy || job.Status != jobs.JobStatusPending {
+			continue
+		}
+		if job.NextAttemptAt != nil && now.Before(*job.NextAttemptAt) {
+			continue
+		}
+		if next == nil || runsBefore(job, next) {
+			next = job
+		}
+	}
+	if next != nil {
+		q.claimed[next.ID] = *next
+	}
+	return next
+}
+
+// NextRetry returns the earliest time a pending job waiting for a retry
+// becomes eligible. ok is false if no job is waiting.
+func (q *Queue) NextRetry() (next time.Time, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range q.jobs {
+		if _, busy := q.claimed[job.ID]; busy || job.Status != jobs.JobStatusPending || job.NextAttemptAt == nil {
+			continue
+		}
+		if !ok || job.NextAttemptAt.Before(next) {
+			next, ok = *job.NextAttemptAt, true
+		}
+	}
+	return next, ok
+}
+
+// Save persists a state change made by the worker holding the job's claim.
+func (q *Queue) Save(job *jobs.Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.claimed[job.ID]; ok {
+		q.claimed[job.ID] = *job
+	}
+	if err := jobs.SaveJob(job, q.dir); err != nil {
+		return err
+	}
+	q.changed(*job, false)
+	return nil
+}
+
+// Release returns a claimed job to the queue.
+func (q *Queue) Release(job *jobs.Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.claimed, job.ID)
+	q.signal(job)
+}
+
+// Running returns the number of claimed jobs.
+func (q *Queue) Running() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.claimed)
+}
+
+// runsBefore orders jobs by priority, highest first, then by age, oldest first.
+func runsBefore(a, b *jobs.Job) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return a.CreatedAt.Before(b.CreatedAt)
+}
+
+// Pending returns copies of all pending jobs in the order they will run.
+func (q *Queue) Pending() []jobs.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var pending []jobs.Job
+	for _, job := range q.jobs {
+		if v := q.view(job); v.Status == jobs.JobStatusPending {
+			pending = append(pending, v)
+		}
+	}
+	sort.SliceStable(pending, func(i, j int) bool {
+		return runsBefore(&pending[i], &pending[j])
+	})
+	return pending
+}
+
+// All returns copies of every job in the queue, oldest first.
+func (q *Queue) All() []jobs.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	all := make([]jobs.Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		all = append(all, q.view(job))
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.Before(all[j].CreatedAt)
+	})
+	return all
+}
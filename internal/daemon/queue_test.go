@@ -0,0 +1,263 @@
+package daemon
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// newTestQueue returns an empty queue backed by a temporary directory.
+func newTestQueue(t *testing.T) *Queue {
+	t.Helper()
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// addJob queues a job for path with a status.
+func addJob(t *testing.T, q *Queue, path string, status jobs.JobStatus) jobs.Job {
+	t.Helper()
+	job, err := q.Update(path, func(job *jobs.Job) { job.Status = status })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestQueueSkipPending(t *testing.T) {
+	q := newTestQueue(t)
+	claimed := addJob(t, q, "/lib/claimed.mkv", jobs.JobStatusPending)
+	if got := q.Claim(); got == nil || got.ID != claimed.ID {
+		t.Fatalf("Claim() = %v, want job %s", got, claimed.ID)
+	}
+	addJob(t, q, "/lib/pending.mkv", jobs.JobStatusPending)
+	addJob(t, q, "/lib/done.mkv", jobs.JobStatusSuccess)
+
+	tests := []struct {
+		path    string
+		skipped bool
+		status  jobs.JobStatus
+	}{
+		{"/lib/pending.mkv", true, jobs.JobStatusSkipped},
+		{"/lib/done.mkv", false, jobs.JobStatusSuccess},
+		{"/lib/missing.mkv", false, ""},
+	}
+	for _, tt := range tests {
+		skipped, err := q.SkipPending(tt.path, "rule says no")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skipped != tt.skipped {
+			t.Errorf("SkipPending(%s) = %t, want %t", tt.path, skipped, tt.skipped)
+		}
+		job, ok, _ := q.Lookup(tt.path)
+		if ok != (tt.status != "") || job.Status != tt.status {
+			t.Errorf("%s: status %q, want %q", tt.path, job.Status, tt.status)
+		}
+		if tt.skipped && (job.Reason != "rule says no" || job.FinishedAt == nil) {
+			t.Errorf("%s: reason %q, finished %v", tt.path, job.Reason, job.FinishedAt)
+		}
+	}
+
+	// A worker owns a claimed job
+	if skipped, _ := q.SkipPending("/lib/claimed.mkv", "rule says no"); skipped {
+		t.Error("SkipPending changed a claimed job")
+	}
+
+	// The change is persisted
+	reloaded, err := NewQueue(q.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _, _ := reloaded.Lookup("/lib/pending.mkv"); job.Status != jobs.JobStatusSkipped {
+		t.Errorf("reloaded status %q, want skipped", job.Status)
+	}
+}
+
+func TestQueueOutputConflict(t *testing.T) {
+	q := newTestQueue(t)
+	addJob(t, q, "/lib/movie.ts", jobs.JobStatusPending)
+	addJob(t, q, "/lib/done.ts", jobs.JobStatusSuccess)
+	addJob(t, q, "/lib/failed.ts", jobs.JobStatusFailed)
+
+	tests := []struct {
+		path     string
+		conflict string // source of the conflicting job, "" = none
+	}{
+		{"/lib/movie.avi", "/lib/movie.ts"},
+		{"/lib/movie.mkv", "/lib/movie.ts"},
+		{"/lib/movie.ts", ""}, // its own job
+		{"/lib/movie.mp4", ""},
+		{"/lib/other/movie.avi", ""},
+		{"/lib/done.avi", ""},   // that output is already in place, and the encode fails on it
+		{"/lib/failed.avi", ""}, // not going to run
+	}
+	for _, tt := range tests {
+		other, ok := q.OutputConflict(tt.path)
+		if ok != (tt.conflict != "") || other.SourcePath != tt.conflict {
+			t.Errorf("OutputConflict(%s) = %q, %t, want %q", tt.path, other.SourcePath, ok, tt.conflict)
+		}
+	}
+
+	// A claimed job still holds its output
+	if job := q.Claim(); job == nil || job.SourcePath != "/lib/movie.ts" {
+		t.Fatalf("Claim() = %v, want movie.ts", job)
+	}
+	if _, ok := q.OutputConflict("/lib/movie.avi"); !ok {
+		t.Error("no conflict with a claimed job")
+	}
+}
+
+func TestQueueDelete(t *testing.T) {
+	q := newTestQueue(t)
+	type change struct {
+		path    string
+		deleted bool
+	}
+	var changes []change
+	q.OnChange(func(job jobs.Job, deleted bool) { changes = append(changes, change{job.SourcePath, deleted}) })
+
+	done := addJob(t, q, "/lib/done.mkv", jobs.JobStatusSuccess)
+	claimed := addJob(t, q, "/lib/claimed.mkv", jobs.JobStatusPending)
+	if got := q.Claim(); got == nil || got.ID != claimed.ID {
+		t.Fatalf("Claim() = %v, want job %s", got, claimed.ID)
+	}
+	changes = nil
+
+	if _, err := q.Delete(claimed.ID); !errors.Is(err, ErrJobBusy) {
+		t.Errorf("Delete(claimed) = %v, want ErrJobBusy", err)
+	}
+	if _, err := q.Delete("nope"); err == nil {
+		t.Error("Delete of an unknown job succeeded")
+	}
+	if _, err := q.Delete(done.ID); err != nil {
+		t.Fatal(err)
+	}
+	if want := []change{{"/lib/done.mkv", true}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes %v, want %v", changes, want)
+	}
+	if _, ok, _ := q.Lookup("/lib/done.mkv"); ok {
+		t.Error("deleted job still found by path")
+	}
+	reloaded, err := NewQueue(q.Dir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Get(done.ID); ok {
+		t.Error("deleted job came back on reload")
+	}
+}
+
+func TestQueueClaimOrder(t *testing.T) {
+	q := newTestQueue(t)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	add := func(path string, priority int, age time.Duration, status jobs.JobStatus, nextAttempt *time.Time) {
+		t.Helper()
+		if _, err := q.Update(path, func(job *jobs.Job) {
+			job.Status = status
+			job.Priority = priority
+			job.CreatedAt = now.Add(-age)
+			job.NextAttemptAt = nextAttempt
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("/lib/new.mkv", 0, time.Minute, jobs.JobStatusPending, nil)
+	add("/lib/old.mkv", 0, time.Hour, jobs.JobStatusPending, nil)
+	add("/lib/urgent.mkv", 5, 0, jobs.JobStatusPending, nil)
+	add("/lib/backoff.mkv", 10, 2*time.Hour, jobs.JobStatusPending, &future)
+	add("/lib/retry-due.mkv", 0, 2*time.Hour, jobs.JobStatusPending, &past)
+	add("/lib/failed.mkv", 10, 2*time.Hour, jobs.JobStatusFailed, nil)
+	add("/lib/done.mkv", 10, 2*time.Hour, jobs.JobStatusSuccess, nil)
+
+	var pending []string
+	for _, job := range q.Pending() {
+		pending = append(pending, job.SourcePath)
+	}
+	wantPending := []string{"/lib/backoff.mkv", "/lib/urgent.mkv", "/lib/retry-due.mkv", "/lib/old.mkv", "/lib/new.mkv"}
+	if !reflect.DeepEqual(pending, wantPending) {
+		t.Errorf("Pending() = %q, want %q", pending, wantPending)
+	}
+
+	// Highest priority first, then oldest; a job in backoff waits its turn
+	var claimed []string
+	for job := q.Claim(); job != nil; job = q.Claim() {
+		claimed = append(claimed, job.SourcePath)
+	}
+	wantClaimed := []string{"/lib/urgent.mkv", "/lib/retry-due.mkv", "/lib/old.mkv", "/lib/new.mkv"}
+	if !reflect.DeepEqual(claimed, wantClaimed) {
+		t.Errorf("claimed %q, want %q", claimed, wantClaimed)
+	}
+	if q.Running() != len(wantClaimed) {
+		t.Errorf("Running() = %d, want %d", q.Running(), len(wantClaimed))
+	}
+	if next, ok := q.NextRetry(); !ok || !next.Equal(future) {
+		t.Errorf("NextRetry() = %v, %t, want %v", next, ok, future)
+	}
+}
+
+func TestQueueClaimed(t *testing.T) {
+	q := newTestQueue(t)
+	addJob(t, q, "/lib/movie.mkv", jobs.JobStatusPending)
+	<-q.Ready()
+
+	q.Pause()
+	if job := q.Claim(); job != nil {
+		t.Fatalf("paused queue handed out %s", job.SourcePath)
+	}
+	q.Resume()
+	select {
+	case <-q.Ready():
+	default:
+		t.Error("Resume did not signal Ready")
+	}
+
+	job := q.Claim()
+	if job == nil {
+		t.Fatal("Claim() = nil")
+	}
+	if again := q.Claim(); again != nil {
+		t.Fatalf("job claimed twice")
+	}
+	if _, err := q.Update(job.SourcePath, func(j *jobs.Job) { j.Priority = 1 }); !errors.Is(err, ErrJobBusy) {
+		t.Errorf("Update of a claimed job = %v, want ErrJobBusy", err)
+	}
+	if _, _, busy := q.Lookup(job.SourcePath); !busy {
+		t.Error("Lookup does not report the claimed job busy")
+	}
+
+	// Readers see what the worker last published, not its unsaved changes
+	job.Status = jobs.JobStatusRunning
+	if err := q.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	job.Reason = "not published"
+	if got, _ := q.Get(job.ID); got.Status != jobs.JobStatusRunning || got.Reason != "" {
+		t.Errorf("Get() = status %q, reason %q, want the saved state", got.Status, got.Reason)
+	}
+
+	// A job released back to pending can be claimed again and wakes the dispatcher
+	job.Status = jobs.JobStatusPending
+	job.Reason = ""
+	if err := q.Save(job); err != nil {
+		t.Fatal(err)
+	}
+	q.Release(job)
+	select {
+	case <-q.Ready():
+	default:
+		t.Error("Release of a pending job did not signal Ready")
+	}
+	if again := q.Claim(); again == nil || again.ID != job.ID {
+		t.Errorf("released job not claimable")
+	}
+	if q.Running() != 1 {
+		t.Errorf("Running() = %d, want 1", q.Running())
+	}
+}
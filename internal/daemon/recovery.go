@@ -0,0 +1,219 @@
+package daemon
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// probeFile probes a media file; tests replace it so recovery and output
+// verification can be exercised without ffprobe.
+var probeFile = metadata.ProbeFile
+
+// recoverState reconciles persisted jobs and leftover temp outputs with the
+// filesystem after an unclean stop (crash, power loss, SIGKILL).
+// It runs once at startup, before the first scan and before any worker
+// starts, so nothing it inspects can be in use and the scan sees no job left
+// running and no temp output.
+func (d *Daemon) recoverState() {
+	handled := make(map[string]bool)
+
+	for _, job := range d.queue.All() {
+		if job.Status != jobs.JobStatusRunning {
+			continue
+		}
+		log.Printf("Recovery: job %s was left running: %s", job.ID, job.SourcePath)
+
+		// AtomicReplaceFile renames the temp output away, so while it exists
+		// the source is still the original and the encode never finished
+		tmpPath := TempOutputPath(job.SourcePath)
+		if _, err := os.Stat(tmpPath); err == nil {
+			d.reconcileTemp(tmpPath, job.SourcePath)
+			handled[tmpPath] = true
+		} else if d.sourceAlreadyEncoded(job) || d.renamedOutputInPlace(job.SourcePath) {
+			d.markRecoveredSuccess(job.SourcePath)
+			continue
+		}
+
+		d.queue.Update(job.SourcePath, func(job *jobs.Job) {
+			job.Status = jobs.JobStatusPending
+			job.Reason = "recovered after unclean shutdown, will restart"
+			job.StartedAt = nil
+			job.FinishedAt = nil
+			job.OutputPath = ""
+		})
+		log.Printf("Recovery: reset job %s to pending", job.ID)
+	}
+
+	for _, tmpPath := range findTempOutputs(d.config().Roots()) {
+		if !handled[tmpPath] {
+			d.reconcileTemp(tmpPath, d.sourceForTemp(tmpPath))
+		}
+	}
+}
+
+// findTempOutputs walks the library roots for temp outputs.
+func findTempOutputs(roots []string) []string {
+	var found []string
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				log.Printf("Recovery: error accessing %s: %v", path, err)
+				return nil
+			}
+			if !entry.IsDir() && IsTempOutput(path) {
+				found = append(found, path)
+			}
+			return nil
+		})
+	}
+	return found
+}
+
+// reconcileTemp discards a leftover temp output, which is always a partial
+// or unverified encode: AtomicReplaceFile moves a finished one into place in
+// a single rename. That includes a temp output whose source is missing:
+// AtomicReplaceFile never removes the original before the output is in
+// place, so the user deleted the source, and the output may never have
+// passed verification or the size gate. An encode that did replace its
+// source leaves no temp output behind and is found by sourceAlreadyEncoded.
+func (d *Daemon) reconcileTemp(tmpPath, sourcePath string) {
+	if _, err := os.Stat(tmpPath); err != nil {
+		return
+	}
+	switch _, err := os.Stat(sourcePath); {
+	case sourcePath == "":
+		d.discardTemp(tmpPath, "no source file found")
+	case err != nil:
+		d.discardTemp(tmpPath, "source "+sourcePath+" is missing")
+	default:
+		d.discardTemp(tmpPath, "partial encode")
+	}
+}
+
+// sourceAlreadyEncoded reports whether a job's source was replaced by its AV1
+// output before the crash, i.e. the size changed and it now probes as AV1.
+func (d *Daemon) sourceAlreadyEncoded(job jobs.Job) bool {
+	info, err := os.Stat(job.SourcePath)
+	if err != nil || info.Size() == job.OriginalSize {
+		return false
+	}
+	return job.SourceCodec != "av1" && d.isCompleteAV1(job.SourcePath)
+}
+
+// isCompleteAV1 probes a file and reports whether it is a readable AV1 video
+// with a duration, which a truncated encode won't have.
+func (d *Daemon) isCompleteAV1(path string) bool {
+	release := d.limiter.AcquireProbe()
+	probeResult, err := probeFile(d.ffmpegPath, path)
+	release()
+	if err != nil {
+		return false
+	}
+	return probeResult.HasVideo && probeResult.HasAV1 && probeResult.Format.Duration != ""
+}
+
+// sourceForTemp finds the source file a temp output belongs to, whose name
+// it extends (see TempOutputPath). Temp outputs of older versions replaced
+// the source's extension instead; for those it is a known job, or else any
+// media file next to it with the same base name. It returns "" if there is
+// none.
+func (d *Daemon) sourceForTemp(tmpPath string) string {
+	base := strings.TrimSuffix(tmpPath, tempOutputSuffix)
+	if d.scanner.IsMedia(base) {
+		return base
+	}
+
+	for _, job := range d.queue.All() {
+		if strings.TrimSuffix(job.SourcePath, filepath.Ext(job.SourcePath)) == base {
+			return job.SourcePath
+		}
+	}
+	if matches, err := filepath.Glob(globEscape(base) + ".*"); err == nil {
+		for _, m := range matches {
+			if d.scanner.IsMedia(m) {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+// renamedOutputInPlace finishes a replacement that gives the output a new
+// name (see FinalOutputPath) when the crash hit after the output was moved
+// into place but before the original was removed.
+func (d *Daemon) renamedOutputInPlace(sourcePath string) bool {
+	finalPath := FinalOutputPath(sourcePath)
+	if finalPath == sourcePath || !d.isCompleteAV1(finalPath) {
+		return false
+	}
+	log.Printf("Recovery: %s already holds the AV1 encode, removing original %s", finalPath, sourcePath)
+	if err := os.Remove(sourcePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Recovery: failed to remove %s: %v", sourcePath, err)
+	}
+	return true
+}
+
+// markRecoveredSuccess records a job whose encode completed before the crash.
+func (d *Daemon) markRecoveredSuccess(sourcePath string) {
+	if _, ok, _ := d.queue.Lookup(sourcePath); !ok {
+		return
+	}
+	info, err := os.Stat(FinalOutputPath(sourcePath))
+	if err != nil {
+		return
+	}
+	job, err := d.queue.Update(sourcePath, func(job *jobs.Job) {
+		now := time.Now()
+		job.Status = jobs.JobStatusSuccess
+		job.Reason = "recovered: encode had already replaced the original"
+		job.NewSize = info.Size()
+		job.FinishedAt = &now
+	})
+	if err == nil {
+		log.Printf("Recovery: marked job %s as succeeded", job.ID)
+	}
+}
+
+// discardTemp removes a partial temp output, or moves it to QuarantineDir when
+// one is configured.
+func (d *Daemon) discardTemp(tmpPath, why string) {
+	quarantine := d.config().QuarantineDir
+	if quarantine == "" {
+		log.Printf("Recovery: removing orphaned %s (%s)", tmpPath, why)
+		if err := os.Remove(tmpPath); err != nil {
+			log.Printf("Recovery: failed to remove %s: %v", tmpPath, err)
+		}
+		return
+	}
+
+	if err := os.MkdirAll(quarantine, 0755); err != nil {
+		log.Printf("Recovery: failed to create quarantine dir: %v", err)
+		return
+	}
+	dest := filepath.Join(quarantine, fmt.Sprintf("%d-%s", time.Now().Unix(), filepath.Base(tmpPath)))
+	log.Printf("Recovery: quarantining orphaned %s to %s (%s)", tmpPath, dest, why)
+	if err := os.Rename(tmpPath, dest); err != nil {
+		log.Printf("Recovery: failed to quarantine %s: %v", tmpPath, err)
+	}
+}
+
+// globEscape escapes glob metacharacters, which are common in media file names.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
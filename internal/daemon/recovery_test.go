@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// newTestDaemon returns a daemon for one library root, with its job state
+// and quarantine in temporary directories.
+func newTestDaemon(t *testing.T, root string) *Daemon {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.LibraryRoots = []string{root}
+	cfg.JobStateDir = t.TempDir()
+	cfg.QuarantineDir = filepath.Join(t.TempDir(), "quarantine")
+	d, err := New(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// fakeProbe stands in for ffprobe: files whose content starts with "AV1"
+// are complete AV1 encodes, anything else is H.264.
+func fakeProbe(t *testing.T) {
+	t.Helper()
+	orig := probeFile
+	t.Cleanup(func() { probeFile = orig })
+	probeFile = func(_, path string) (*metadata.ProbeResult, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		av1 := strings.HasPrefix(string(data), "AV1")
+		return &metadata.ProbeResult{HasVideo: true, HasAV1: av1, Format: metadata.FormatInfo{Duration: "60"}}, nil
+	}
+}
+
+func TestRecoverState(t *testing.T) {
+	fakeProbe(t)
+	root := t.TempDir()
+	d := newTestDaemon(t, root)
+	quarantine := d.config().QuarantineDir
+
+	write := func(name, content string) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	running := func(path string, size int64) {
+		if _, err := d.queue.Update(path, func(job *jobs.Job) {
+			job.Status = jobs.JobStatusRunning
+			job.OriginalSize = size
+			job.SourceCodec = "h264"
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stale running job, the crash hit before ffmpeg wrote anything
+	stale := write("stale.mkv", "h264 source")
+	running(stale, int64(len("h264 source")))
+
+	// Running job with a partial temp output
+	partial := write("partial.mkv", "h264 source")
+	running(partial, int64(len("h264 source")))
+	partialTemp := write("partial.mkv"+tempOutputSuffix, "AV1 half")
+
+	// Orphaned temp output without a job, source still there
+	orphanSource := write("orphan.ts", "h264 source")
+	orphanTemp := write("orphan.ts"+tempOutputSuffix, "AV1 half")
+
+	// Temp output of a source the user deleted
+	goneTemp := write("gone.mkv"+tempOutputSuffix, "AV1 complete")
+
+	// Temp output named by an older version, which replaced the extension
+	legacySource := write("legacy.mkv", "h264 source")
+	legacyTemp := write("legacy"+tempOutputSuffix, "AV1 half")
+
+	// The encode had replaced the source in place
+	done := write("done.mkv", "AV1 complete encode")
+	running(done, int64(len("h264 source")))
+
+	// The encode had been moved to its new name, the original not yet removed
+	renamedSource := write("renamed.ts", "h264 source")
+	running(renamedSource, int64(len("h264 source")))
+	renamedOutput := write("renamed.mkv", "AV1 complete encode")
+
+	d.recoverState()
+
+	for path, want := range map[string]jobs.JobStatus{
+		stale:         jobs.JobStatusPending,
+		partial:       jobs.JobStatusPending,
+		done:          jobs.JobStatusSuccess,
+		renamedSource: jobs.JobStatusSuccess,
+	} {
+		job, _, _ := d.queue.Lookup(path)
+		if job.Status != want {
+			t.Errorf("%s: status %q, want %q", filepath.Base(path), job.Status, want)
+		}
+	}
+	if job, _, _ := d.queue.Lookup(done); job.NewSize != int64(len("AV1 complete encode")) {
+		t.Errorf("done.mkv: new size %d", job.NewSize)
+	}
+
+	// Sources and finished encodes stay, the original of a renamed encode goes
+	for _, path := range []string{stale, partial, orphanSource, legacySource, done, renamedOutput} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	if _, err := os.Stat(renamedSource); !os.IsNotExist(err) {
+		t.Errorf("renamed.ts still exists after its encode was moved into place")
+	}
+
+	// Every temp output is gone from the library and quarantined
+	for _, path := range []string{partialTemp, orphanTemp, goneTemp, legacyTemp} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left in place", filepath.Base(path))
+		}
+	}
+	quarantined, _ := os.ReadDir(quarantine)
+	if len(quarantined) != 4 {
+		var names []string
+		for _, e := range quarantined {
+			names = append(names, e.Name())
+		}
+		t.Errorf("quarantined %q, want the 4 temp outputs", names)
+	}
+}
+
+func TestRecoverStateRemovesTempWithoutQuarantine(t *testing.T) {
+	fakeProbe(t)
+	root := t.TempDir()
+	d := newTestDaemon(t, root)
+	d.cfg.QuarantineDir = ""
+
+	temp := filepath.Join(root, "gone.mkv"+tempOutputSuffix)
+	if err := os.WriteFile(temp, []byte("AV1 complete"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d.recoverState()
+	if _, err := os.Stat(temp); !os.IsNotExist(err) {
+		t.Errorf("temp output of a missing source was not removed")
+	}
+	// Never moved into place under the source's name
+	if _, err := os.Stat(filepath.Join(root, "gone.mkv")); !os.IsNotExist(err) {
+		t.Errorf("temp output of a missing source was moved into place")
+	}
+}
@@ -0,0 +1,123 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/notify"
+	"github.com/yourname/av1qsvd/internal/rules"
+)
+
+// CheckConfig validates a configuration as the daemon would use it,
+// including the schedule, throttle, notification and include/exclude rules.
+func CheckConfig(cfg config.TranscodeConfig) error {
+	errs := []error{config.Validate(cfg)}
+	if _, err := NewSchedule(cfg.Schedule); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateThrottle(cfg.Throttle); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := notify.New(cfg.Notifications); err != nil {
+		errs = append(errs, fmt.Errorf("notifications: %w", err))
+	}
+	if _, err := newPathFilter(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := rules.New(cfg.Rules); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// config returns the configuration currently in effect.
+func (d *Daemon) config() config.TranscodeConfig {
+	d.cfgMu.RLock()
+	defer d.cfgMu.RUnlock()
+	return d.cfg
+}
+
+// Reload applies a new configuration to the running daemon. Only settings
+// that are safe to change on the fly are taken over:
+//
+//	min_bytes, max_size_ratio, scan_interval_sec, stable_quiet_sec,
+//	shutdown_grace_sec, max_attempts, free_space_margin, schedule, throttle
+//
+// Changes to anything else are logged and need a restart. Running jobs keep
+// the settings they started with, except that pauses follow the new
+// schedule and throttle.
+func (d *Daemon) Reload(next config.TranscodeConfig) error {
+	if err := CheckConfig(next); err != nil {
+		return err
+	}
+	schedule, err := NewSchedule(next.Schedule)
+	if err != nil {
+		return err
+	}
+
+	d.cfgMu.Lock()
+	prev := d.cfg
+	cfg := prev
+	cfg.MinBytes = next.MinBytes
+	cfg.MaxSizeRatio = next.MaxSizeRatio
+	cfg.ScanIntervalSec = next.ScanIntervalSec
+	cfg.StableQuietSec = next.StableQuietSec
+	cfg.ShutdownGraceSec = next.ShutdownGraceSec
+	cfg.MaxAttempts = next.MaxAttempts
+	cfg.FreeSpaceMargin = next.FreeSpaceMargin
+	cfg.Schedule = next.Schedule
+	cfg.Throttle = next.Throttle
+	d.cfg = cfg
+	d.cfgMu.Unlock()
+
+	d.scanner.SetMinBytes(cfg.MinBytes)
+	d.stability.SetQuietPeriod(stableQuiet(cfg))
+	d.schedule.Store(schedule)
+	if err := d.throttle.SetConfig(cfg.Throttle); err != nil {
+		return err
+	}
+
+	// Lift pauses the new settings no longer call for right away; the
+	// schedule and throttle loops pause again on their next check if needed
+	if !schedule.PauseOnClose() || schedule.At(time.Now()).Open {
+		d.setPaused(pauseSchedule, false)
+	}
+	if !cfg.Throttle.PauseRunning || !d.throttle.Enabled() {
+		d.setPaused(pauseThrottle, false)
+	}
+
+	select {
+	case d.reloaded <- struct{}{}:
+	default:
+	}
+	d.wakeDispatcher()
+
+	if changed := changedKeys(prev, cfg); len(changed) > 0 {
+		log.Printf("Configuration reloaded, changed: %s", strings.Join(changed, ", "))
+	} else {
+		log.Printf("Configuration reloaded, no changes")
+	}
+	if ignored := changedKeys(cfg, next); len(ignored) > 0 {
+		log.Printf("Warning: restart av1d to apply changes to: %s", strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// changedKeys lists the top-level config keys that differ between a and b.
+func changedKeys(a, b config.TranscodeConfig) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// defaultMaxAttempts is used when MaxAttempts is not configured.
+const defaultMaxAttempts = 5
+
+// retryPolicy is the backoff schedule for one failure category.
+// The n-th retry waits base * 2^(n-1), capped at max.
+type retryPolicy struct {
+	base        time.Duration
+	max         time.Duration
+	maxAttempts int // overrides MaxAttempts when lower, 0 = no override
+}
+
+// retryPolicies are tuned to how likely each kind of failure is to go away
+// by itself. GPU and I/O trouble is usually transient; a disk needs time to
+// be cleaned up; a file that fails to decode will most likely fail again,
+// and an output that failed verification certainly will.
+var retryPolicies = map[ffmpeg.FailureCategory]retryPolicy{
+	ffmpeg.FailureGPUInit:  {base: 2 * time.Minute, max: time.Hour},
+	ffmpeg.FailureIO:       {base: 5 * time.Minute, max: 2 * time.Hour},
+	ffmpeg.FailureDiskFull: {base: 30 * time.Minute, max: 6 * time.Hour},
+	ffmpeg.FailureDecode:   {base: 6 * time.Hour, max: 24 * time.Hour, maxAttempts: 2},
+	ffmpeg.FailureUnknown:  {base: 15 * time.Minute, max: 4 * time.Hour},
+	ffmpeg.FailureVerify:   {maxAttempts: 1},
+}
+
+// backoff returns how long to wait before the given attempt number.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.base
+	for i := 1; i < attempt && delay < p.max; i++ {
+		delay *= 2
+	}
+	return min(delay, p.max)
+}
+
+// maxAttempts returns how many attempts a job gets before it is parked,
+// defaulting to 5.
+func (d *Daemon) maxAttempts(category ffmpeg.FailureCategory) int {
+	return attemptLimit(d.config().MaxAttempts, category)
+}
+
+// attemptLimit returns the attempts a job failing in category gets, given
+// the configured MaxAttempts.
+func attemptLimit(configured int, category ffmpeg.FailureCategory) int {
+	limit := configured
+	if limit <= 0 {
+		limit = defaultMaxAttempts
+	}
+	if p := retryPolicies[category]; p.maxAttempts > 0 && p.maxAttempts < limit {
+		limit = p.maxAttempts
+	}
+	return limit
+}
+
+// nextAttempt returns when a job that failed its attempt-th time in category
+// may run again, or false if it has used up its limit and is parked.
+func nextAttempt(category ffmpeg.FailureCategory, attempt, limit int, now time.Time) (time.Time, bool) {
+	if attempt >= limit {
+		return time.Time{}, false
+	}
+	return now.Add(retryPolicies[category].backoff(attempt)), true
+}
+
+// scheduleRetry applies the retry policy to a job that just failed with err.
+// The job is put back to pending with a next-eligible time, or parked once it
+// has used up its attempts. Parked jobs stay failed until the file changes or
+// a user retries them. Every failed attempt is counted in the metrics and
+// sent as a job_failed notification, the parked one by the worker.
+func (d *Daemon) scheduleRetry(job *jobs.Job, err error) {
+	category := ffmpeg.FailureCategoryOf(err)
+	if category == "" {
+		category = ffmpeg.FailureUnknown
+	}
+	job.FailureCategory = string(category)
+	job.Attempts++
+
+	limit := d.maxAttempts(category)
+	now := time.Now()
+	next, retry := nextAttempt(category, job.Attempts, limit, now)
+	if !retry {
+		job.Parked = true
+		job.NextAttemptAt = nil
+		job.Reason = fmt.Sprintf("parked after %d attempt(s): %s", job.Attempts, job.Reason)
+		d.queue.Save(job)
+		log.Printf("Job %s parked after %d failed attempt(s) (%s)", job.ID, job.Attempts, category)
+		return
+	}
+
+	delay := next.Sub(now)
+	job.NextAttemptAt = &next
+	job.Reason = fmt.Sprintf("retry %d/%d at %s after %s failure: %s",
+		job.Attempts+1, limit, next.Format(time.DateTime), category, job.Reason)
+	// Report the failed attempt while the job still says failed; the worker
+	// only reports the state it leaves the job in, which is pending
+	d.metrics.ObserveJob(*job)
+	d.notifyJob(*job)
+	d.metrics.ObserveRetry(category)
+
+	job.Status = jobs.JobStatusPending
+	d.queue.Save(job)
+	log.Printf("Job %s failed (%s), retrying in %s (attempt %d of %d)", job.ID, category, delay, job.Attempts+1, limit)
+}
+
+// resetRetries clears a job's retry state.
+func resetRetries(job *jobs.Job) {
+	job.Attempts = 0
+	job.NextAttemptAt = nil
+	job.FailureCategory = ""
+	job.Parked = false
+}
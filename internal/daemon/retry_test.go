@@ -0,0 +1,121 @@
+package daemon
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		category ffmpeg.FailureCategory
+		attempt  int
+		want     time.Duration
+	}{
+		{ffmpeg.FailureGPUInit, 1, 2 * time.Minute},
+		{ffmpeg.FailureGPUInit, 2, 4 * time.Minute},
+		{ffmpeg.FailureGPUInit, 5, 32 * time.Minute},
+		{ffmpeg.FailureGPUInit, 6, time.Hour},
+		{ffmpeg.FailureGPUInit, 100, time.Hour},
+		{ffmpeg.FailureIO, 1, 5 * time.Minute},
+		{ffmpeg.FailureIO, 3, 20 * time.Minute},
+		{ffmpeg.FailureIO, 6, 2 * time.Hour},
+		{ffmpeg.FailureDiskFull, 1, 30 * time.Minute},
+		{ffmpeg.FailureDiskFull, 4, 4 * time.Hour},
+		{ffmpeg.FailureDiskFull, 5, 6 * time.Hour},
+		{ffmpeg.FailureDecode, 1, 6 * time.Hour},
+		{ffmpeg.FailureDecode, 2, 12 * time.Hour},
+		{ffmpeg.FailureDecode, 3, 24 * time.Hour},
+		{ffmpeg.FailureUnknown, 1, 15 * time.Minute},
+		{ffmpeg.FailureUnknown, 5, 4 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryPolicies[tt.category].backoff(tt.attempt); got != tt.want {
+			t.Errorf("%s backoff(%d) = %s, want %s", tt.category, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestAttemptLimit(t *testing.T) {
+	tests := []struct {
+		configured int
+		category   ffmpeg.FailureCategory
+		want       int
+	}{
+		{0, ffmpeg.FailureGPUInit, defaultMaxAttempts},
+		{-1, ffmpeg.FailureIO, defaultMaxAttempts},
+		{8, ffmpeg.FailureDiskFull, 8},
+		{0, ffmpeg.FailureDecode, 2},
+		{8, ffmpeg.FailureDecode, 2},
+		{1, ffmpeg.FailureDecode, 1},
+		{3, ffmpeg.FailureUnknown, 3},
+		{0, ffmpeg.FailureVerify, 1},
+		{8, ffmpeg.FailureVerify, 1},
+	}
+	for _, tt := range tests {
+		if got := attemptLimit(tt.configured, tt.category); got != tt.want {
+			t.Errorf("attemptLimit(%d, %s) = %d, want %d", tt.configured, tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestNextAttempt(t *testing.T) {
+	now := time.Date(2026, time.October, 12, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		category ffmpeg.FailureCategory
+		attempt  int
+		limit    int
+		want     time.Time // zero = parked
+	}{
+		{ffmpeg.FailureGPUInit, 1, 5, now.Add(2 * time.Minute)},
+		{ffmpeg.FailureGPUInit, 4, 5, now.Add(16 * time.Minute)},
+		{ffmpeg.FailureGPUInit, 5, 5, time.Time{}},
+		{ffmpeg.FailureDiskFull, 2, 5, now.Add(time.Hour)},
+		{ffmpeg.FailureDecode, 1, 2, now.Add(6 * time.Hour)},
+		{ffmpeg.FailureDecode, 2, 2, time.Time{}},
+		{ffmpeg.FailureUnknown, 7, 5, time.Time{}},
+		{ffmpeg.FailureVerify, 1, attemptLimit(5, ffmpeg.FailureVerify), time.Time{}},
+	}
+	for _, tt := range tests {
+		got, retry := nextAttempt(tt.category, tt.attempt, tt.limit, now)
+		if retry != !tt.want.IsZero() || !got.Equal(tt.want) {
+			t.Errorf("nextAttempt(%s, %d, %d) = %s, %t, want %s", tt.category, tt.attempt, tt.limit, got, retry, tt.want)
+		}
+	}
+}
+
+func TestScheduleRetryReportsEachFailure(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	d.cfg.MaxAttempts = 2
+	job, err := d.queue.Update("/lib/movie.mkv", func(job *jobs.Job) { job.Status = jobs.JobStatusRunning })
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := jobOutcome{string(jobs.JobStatusFailed), string(ffmpeg.FailureIO)}
+
+	// The first failure is retried, and still counted as a failed job
+	job.Status = jobs.JobStatusFailed
+	d.scheduleRetry(&job, &os.PathError{Op: "open", Path: job.SourcePath, Err: os.ErrPermission})
+	if job.Status != jobs.JobStatusPending || job.NextAttemptAt == nil {
+		t.Fatalf("after first failure: status %q, next attempt %v", job.Status, job.NextAttemptAt)
+	}
+	if got := d.metrics.jobsFinished[failed]; got != 1 {
+		t.Errorf("failed jobs counted after a retried failure: %g, want 1", got)
+	}
+	if got := d.metrics.retries[string(ffmpeg.FailureIO)]; got != 1 {
+		t.Errorf("retries counted: %g, want 1", got)
+	}
+
+	// The second is parked and left failed for the worker to report
+	job.Status = jobs.JobStatusFailed
+	d.scheduleRetry(&job, &os.PathError{Op: "open", Path: job.SourcePath, Err: os.ErrPermission})
+	if job.Status != jobs.JobStatusFailed || !job.Parked {
+		t.Fatalf("after second failure: status %q, parked %t", job.Status, job.Parked)
+	}
+	if got := d.metrics.jobsFinished[failed]; got != 1 {
+		t.Errorf("parked failure counted by scheduleRetry: %g, want 1 until the worker reports it", got)
+	}
+}
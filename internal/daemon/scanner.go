@@ -0,0 +1,592 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+	"github.com/yourname/av1qsvd/internal/rules"
+	"github.com/yourname/av1qsvd/internal/scan"
+)
+
+// SkippedFile records a media file that was judged and not queued.
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ScanResult summarizes one scan pass.
+type ScanResult struct {
+	Candidates []string
+	Skipped    []SkippedFile
+	Unchanged  int // files already judged in an earlier pass
+	Settling   int // files still being written, judged once they settle
+	Excluded   int // files and directories left out by path rules and ignore files
+	Duration   time.Duration
+	Roots      []RootStats // per-root breakdown, set by ScanAll
+}
+
+// RootStats counts the outcome of scanning one library root.
+type RootStats struct {
+	Root       string        `json:"root"`
+	Duration   time.Duration `json:"duration_ns"`
+	Candidates int           `json:"candidates"`
+	Skipped    int           `json:"skipped"`
+	Unchanged  int           `json:"unchanged"`
+	Settling   int           `json:"settling"`
+	Excluded   int           `json:"excluded"`
+}
+
+// fileStamp identifies a version of a file for change detection.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// Scanner walks library roots, probes media files and feeds candidates into the queue.
+// It remembers the size and mtime of every file it has judged, so unchanged files
+// are not re-probed on later passes.
+type Scanner struct {
+	cfg        config.TranscodeConfig
+	ffmpegPath string
+	queue      *Queue
+	limiter    *Limiter
+	stability  *scan.StabilityTracker
+	filter     *pathFilter
+	rules      *rules.Set
+	preview    func(Candidate) // set for a dry run: candidates are reported instead of queued
+
+	mu   sync.Mutex // guards seen and cfg.MinBytes
+	seen map[string]fileStamp
+}
+
+// NewScanner creates a scanner for the configured library roots. It fails if
+// the include/exclude rules or the selection rules don't compile.
+func NewScanner(cfg config.TranscodeConfig, ffmpegPath string, queue *Queue, limiter *Limiter, stability *scan.StabilityTracker) (*Scanner, error) {
+	filter, err := newPathFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ruleSet, err := rules.New(cfg.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Scanner{
+		cfg:        cfg,
+		ffmpegPath: ffmpegPath,
+		queue:      queue,
+		limiter:    limiter,
+		stability:  stability,
+		filter:     filter,
+		rules:      ruleSet,
+		seen:       make(map[string]fileStamp),
+	}, nil
+}
+
+// Candidate is a file a dry-run scan would queue.
+type Candidate struct {
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	EstimatedSize int64  `json:"estimated_size"` // 0 if it couldn't be estimated
+	Codec         string `json:"codec"`
+	Resolution    string `json:"resolution"`
+	Profile       string `json:"profile"`
+}
+
+// PreviewScan walks the library roots once and reports each file a scan would
+// queue, without writing anything: no jobs, markers or sidecar files.
+func PreviewScan(cfg config.TranscodeConfig, ffmpegPath string, report func(Candidate)) (ScanResult, error) {
+	queue, err := NewQueue(cfg.JobStateDir)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	limiter := NewLimiter(nil, 1, cfg.MaxConcurrentProbes)
+	s, err := NewScanner(cfg, ffmpegPath, queue, limiter, scan.NewStabilityTracker(stableQuiet(cfg)))
+	if err != nil {
+		return ScanResult{}, err
+	}
+	s.preview = report
+	return s.ScanAll(), nil
+}
+
+// ScanAll walks every configured library root once.
+func (s *Scanner) ScanAll() ScanResult {
+	start := time.Now()
+	var result ScanResult
+	for _, root := range s.cfg.Roots() {
+		r := s.ScanRoot(root)
+		result.Candidates = append(result.Candidates, r.Candidates...)
+		result.Skipped = append(result.Skipped, r.Skipped...)
+		result.Unchanged += r.Unchanged
+		result.Settling += r.Settling
+		result.Excluded += r.Excluded
+		result.Roots = append(result.Roots, RootStats{
+			Root:       root,
+			Duration:   r.Duration,
+			Candidates: len(r.Candidates),
+			Skipped:    len(r.Skipped),
+			Unchanged:  r.Unchanged,
+			Settling:   r.Settling,
+			Excluded:   r.Excluded,
+		})
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// ScanRoot walks a single library root.
+func (s *Scanner) ScanRoot(root string) ScanResult {
+	start := time.Now()
+	var result ScanResult
+
+	log.Printf("Scanning library root: %s", root)
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Error accessing %s: %v", path, err)
+			return nil // Continue walking
+		}
+		if info.IsDir() {
+			if excluded, _ := s.filter.excluded(path, true); excluded {
+				result.Excluded++
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !s.filter.media(path) {
+			return nil
+		}
+		if excluded, _ := s.filter.excluded(path, false); excluded {
+			result.Excluded++
+			return nil
+		}
+
+		if !s.changed(path, info) {
+			result.Unchanged++
+			return nil
+		}
+		if !s.settled(path, info) {
+			result.Settling++
+			return nil
+		}
+
+		accepted, reason := s.Evaluate(path, info)
+		if accepted {
+			result.Candidates = append(result.Candidates, path)
+		} else if reason != "" {
+			result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: reason})
+		}
+		return nil
+	}); err != nil {
+		log.Printf("Error walking directory %s: %v", root, err)
+	}
+
+	result.Duration = time.Since(start)
+	return result
+}
+
+// ScanPath judges a single file, as reported by the watcher.
+// It returns false if the path is not a media file, is unchanged since it was
+// last judged, or was not queued.
+func (s *Scanner) ScanPath(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || !s.filter.media(path) {
+		return false
+	}
+	if excluded, reason := s.filter.excluded(path, false); excluded {
+		log.Printf("Not judging %s: %s", path, reason)
+		return false
+	}
+	if !s.changed(path, info) || !s.settled(path, info) {
+		return false
+	}
+	accepted, _ := s.Evaluate(path, info)
+	return accepted
+}
+
+// settled reports whether a file has stopped changing. A file that is still
+// being written is forgotten again, so the next pass looks at it afresh.
+func (s *Scanner) settled(path string, info os.FileInfo) bool {
+	stable, wait := s.stability.Observe(path, info)
+	if !stable {
+		log.Printf("Still settling, checking again in %s or later: %s", wait.Round(time.Second), path)
+		s.Forget(path)
+	}
+	return stable
+}
+
+// SetMinBytes changes the size at or below which files are skipped. Files
+// already judged are not re-judged until they change or a full rescan.
+func (s *Scanner) SetMinBytes(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.MinBytes = n
+}
+
+// profile returns the name and settings of the profile for a file.
+func (s *Scanner) profile(path string) (string, config.ProfileConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.ProfileFor(path)
+}
+
+// namedProfile returns the settings of a profile chosen by a rule.
+func (s *Scanner) namedProfile(name string) config.ProfileConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.Profile(name)
+}
+
+// Forget drops the remembered stamp for a path so the next pass re-judges it.
+func (s *Scanner) Forget(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seen, path)
+}
+
+// ForgetAll drops every remembered stamp so the next pass re-judges all files.
+func (s *Scanner) ForgetAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen = make(map[string]fileStamp)
+}
+
+// changed reports whether a file differs from the version last judged,
+// and records the current version.
+func (s *Scanner) changed(path string, info os.FileInfo) bool {
+	stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prev, ok := s.seen[path]; ok && prev == stamp {
+		return false
+	}
+	s.seen[path] = stamp
+	return true
+}
+
+// IsMedia reports whether a path has one of the media extensions configured
+// for its library root.
+func (s *Scanner) IsMedia(path string) bool {
+	return s.filter.media(path)
+}
+
+// Evaluate runs the skip rules against a single media file and creates or
+// updates its job if it is a transcode candidate.
+// Returns whether the file was queued, and the skip reason if it was not.
+// An empty reason with accepted == false means the file needs no action.
+func (s *Scanner) Evaluate(path string, info os.FileInfo) (bool, string) {
+	return s.evaluate(path, info, false)
+}
+
+// Enqueue forces a file into the queue on request, bypassing the min_bytes
+// check, include/exclude rules and any .av1qsvd-skip marker. Files outside
+// the library roots, and files that are not video or are already AV1, are
+// still refused. Returns the queued job, or the reason it was refused.
+func (s *Scanner) Enqueue(path string) (jobs.Job, error) {
+	// The file will be replaced or deleted, possibly by a more privileged
+	// user than the one asking
+	if s.filter.rootFor(path) == nil {
+		return jobs.Job{}, fmt.Errorf("%s is not under a library root", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if info.IsDir() {
+		return jobs.Job{}, fmt.Errorf("%s is a directory", path)
+	}
+	if !s.filter.media(path) {
+		return jobs.Job{}, fmt.Errorf("%s is not a supported media file", path)
+	}
+
+	s.changed(path, info)
+	accepted, reason := s.evaluate(path, info, true)
+	if !accepted {
+		if reason == "" {
+			reason = "no action needed"
+		}
+		return jobs.Job{}, fmt.Errorf("not queued: %s", reason)
+	}
+	job, _, _ := s.queue.Lookup(path)
+	return job, nil
+}
+
+// evaluate implements Evaluate; force is set for files a user asked to queue.
+func (s *Scanner) evaluate(path string, info os.FileInfo, force bool) (bool, string) {
+	ext := strings.ToLower(filepath.Ext(path))
+	log.Printf("Found media file: %s (ext: %s, size: %.2f GB)", path, ext, float64(info.Size())/(1024*1024*1024))
+
+	// Check for .av1qsvd-skip marker (new pattern to avoid old .av1skip conflicts)
+	if _, err := os.Stat(SkipMarkerPath(path)); err == nil {
+		if !force {
+			reason := "marked with .av1qsvd-skip"
+			s.skip(path, reason)
+			return false, reason
+		}
+		log.Printf("  → Removing .av1qsvd-skip marker (enqueued on request)")
+		os.Remove(SkipMarkerPath(path))
+	}
+
+	// Check if job already exists for this file
+	existingJob, exists, busy := s.queue.Lookup(path)
+	if busy {
+		// A worker owns this job; leave it alone
+		return false, ""
+	}
+	if exists {
+		switch existingJob.Status {
+		case jobs.JobStatusSuccess:
+			// Only skip if job succeeded (already transcoded)
+			log.Printf("  → Skipped: already successfully transcoded (job %s)", existingJob.ID)
+			return false, ""
+		case jobs.JobStatusRunning:
+			return false, ""
+		case jobs.JobStatusSkipped, jobs.JobStatusFailed:
+			// Only a changed file gets another chance; failed jobs are retried
+			// by the retry policy, not by rescans
+			if !force && !sourceChanged(existingJob, info) {
+				log.Printf("  → Skipped: previously %s and unchanged since (job %s)", existingJob.Status, existingJob.ID)
+				return false, ""
+			}
+		}
+		// Pending jobs and changed files continue to be re-evaluated
+	}
+
+	// Check file size
+	profileName, profile := s.profile(path)
+	if !force && info.Size() <= profile.MinSize() {
+		reason := fmt.Sprintf("file < %.2f GB (size: %d bytes, %.2f GB, profile %s)", gb(profile.MinSize()), info.Size(), gb(info.Size()), profileName)
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+	log.Printf("  → File size OK: %.2f GB", float64(info.Size())/(1024*1024*1024))
+
+	// Run ffprobe to get metadata
+	log.Printf("  → Running ffprobe... (ffmpegPath: %q)", s.ffmpegPath)
+	release := s.limiter.AcquireProbe()
+	probeResult, err := metadata.ProbeFile(s.ffmpegPath, path)
+	release()
+	if err != nil {
+		reason := fmt.Sprintf("ffprobe failed: %v", err)
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+
+	// Check if it's a video
+	if !probeResult.HasVideo {
+		reason := "not a video"
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+	log.Printf("  → Video detected: codec=%s, resolution=%dx%d",
+		probeResult.VideoStream.CodecName,
+		probeResult.VideoStream.Width,
+		probeResult.VideoStream.Height)
+
+	// Check if already AV1
+	if probeResult.HasAV1 {
+		reason := "already av1"
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+
+	// Selection rules: the first match accepts, skips or picks a profile
+	accepted := false
+	if decision, ok := s.rules.Decide(rules.FactsFor(probeResult, path, info.Size(), profileName)); ok {
+		switch {
+		case decision.Action == config.RuleSkip && force:
+			log.Printf("  → Ignoring rule %q (enqueued on request): %s", decision.Rule, decision.Reason)
+		case decision.Action == config.RuleSkip:
+			log.Printf("  → Skipped: %s", decision.Reason)
+			s.skip(path, decision.Reason)
+			return false, decision.Reason
+		default:
+			log.Printf("  → %s", decision.Reason)
+			accepted = decision.Action == config.RuleAccept
+			if decision.Action == config.RuleProfile {
+				profileName, profile = decision.Profile, s.namedProfile(decision.Profile)
+			}
+		}
+	}
+
+	// Dolby Vision and HDR10+ sources follow the profile's dynamic_hdr policy
+	skipHDR, hdrNote := dynamicHDRPolicy(profile, probeResult)
+	if skipHDR {
+		reason := fmt.Sprintf("%s (profile %s)", hdrNote, profileName)
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+
+	// Sources that spend few bits per pixel rarely get under the size gate;
+	// an accept rule or a request to queue the file overrides this
+	if efficient, reason := alreadyEfficient(profile, probeResult); efficient && !accepted && !force {
+		reason = fmt.Sprintf("%s (profile %s)", reason, profileName)
+		log.Printf("  → Skipped: %s", reason)
+		s.skip(path, reason)
+		return false, reason
+	}
+
+	// Calculate estimated output size based on bitrate analysis
+	quality := profileQuality(profile, probeResult)
+	estimatedSize := estimateOutputSize(info.Size(), probeResult, quality)
+	if estimatedSize > 0 {
+		estGB := float64(estimatedSize) / (1024 * 1024 * 1024)
+		log.Printf("  → Estimated output size: %.2f GB (rough estimate)", estGB)
+	} else {
+		log.Printf("  → Warning: Could not estimate output size (missing bitrate/duration data)")
+	}
+
+	if s.preview != nil {
+		var job jobs.Job
+		populateJobMetadata(&job, probeResult)
+		s.preview(Candidate{
+			Path:          path,
+			Size:          info.Size(),
+			EstimatedSize: estimatedSize,
+			Codec:         job.SourceCodec,
+			Resolution:    job.Resolution,
+			Profile:       profileName,
+		})
+		return true, ""
+	}
+
+	// Two sources must not be encoded into the same output
+	if other, conflict := s.queue.OutputConflict(path); conflict {
+		reason := fmt.Sprintf("output %s is already the target of job %s for %s", FinalOutputPath(path), other.ID, other.SourcePath)
+		log.Printf("  → Skipped: %s", reason)
+		s.why(path, reason)
+		return false, reason
+	}
+
+	// File passed all checks - create or update job
+	job, err := s.queue.Update(path, func(job *jobs.Job) {
+		// Reset status to pending if it was previously skipped/failed and the
+		// file has changed since (or a user asked for it)
+		if job.Status == jobs.JobStatusSkipped || job.Status == jobs.JobStatusFailed {
+			log.Printf("  → Resetting old %s job to pending for re-evaluation", job.Status)
+			job.Status = jobs.JobStatusPending
+			job.Reason = "" // Clear old reason
+			job.StartedAt = nil
+			job.FinishedAt = nil
+			resetRetries(job)
+		} else if job.Attempts > 0 && sourceChanged(*job, info) {
+			// A replaced file starts over with a full set of attempts
+			resetRetries(job)
+			job.Reason = ""
+		}
+		job.OriginalSize = info.Size()
+		job.SourceModTime = info.ModTime()
+		populateJobMetadata(job, probeResult)
+		job.EstimatedSize = estimatedSize
+		job.Profile = profileName
+		job.HDRPolicy = ""
+		if job.DynamicHDR != "" {
+			job.HDRPolicy = profile.DynamicHDR
+		}
+	})
+	if err != nil {
+		log.Printf("Failed to save job for %s: %v", path, err)
+		s.Forget(path)
+		return false, ""
+	}
+
+	if hdrNote != "" {
+		log.Printf("  → %s", hdrNote)
+		s.why(path, hdrNote)
+	}
+
+	// Log classification decision with details
+	if probeResult.SourceDecision != nil {
+		log.Printf("  → ✓ ACCEPTED: %s (source: %s, score: %.1f, codec: %s, resolution: %s)",
+			path, probeResult.SourceDecision.Class.String(), probeResult.SourceDecision.Score, job.SourceCodec, job.Resolution)
+		if len(probeResult.SourceDecision.Reasons) > 0 {
+			log.Printf("    Classification reasons: %s", strings.Join(probeResult.SourceDecision.Reasons, "; "))
+		}
+		// Write classification info to sidecar file for debugging
+		if err := metadata.WriteClassificationInfo(path, probeResult.SourceDecision); err != nil {
+			log.Printf("  Warning: failed to write classification info: %v", err)
+		}
+	} else {
+		log.Printf("  → ✓ ACCEPTED: %s (WebRip-like: %v, codec: %s, resolution: %s)",
+			path, probeResult.IsWebRipLike, job.SourceCodec, job.Resolution)
+	}
+
+	return true, ""
+}
+
+// why records the reason a file was skipped in its .why.txt sidecar, except
+// in a dry run.
+func (s *Scanner) why(path, reason string) {
+	if s.preview == nil {
+		metadata.WriteWhyFile(path, reason)
+	}
+}
+
+// skip records why a file is not encoded, like why, and marks a job still
+// pending for it skipped: a rule, marker or threshold that changed since it
+// was queued would otherwise not stop the encode.
+func (s *Scanner) skip(path, reason string) {
+	s.why(path, reason)
+	if s.preview != nil {
+		return
+	}
+	if skipped, err := s.queue.SkipPending(path, reason); err != nil {
+		log.Printf("  → Warning: failed to mark pending job skipped: %v", err)
+	} else if skipped {
+		log.Printf("  → Pending job marked skipped")
+	}
+}
+
+// sourceChanged reports whether a file differs from the version its job was
+// created for. Jobs from before SourceModTime was recorded compare size only.
+func sourceChanged(job jobs.Job, info os.FileInfo) bool {
+	if info.Size() != job.OriginalSize {
+		return true
+	}
+	return !job.SourceModTime.IsZero() && !job.SourceModTime.Equal(info.ModTime())
+}
+
+// populateJobMetadata copies probe metadata into the job.
+func populateJobMetadata(job *jobs.Job, probeResult *metadata.ProbeResult) {
+	job.IsWebRipLike = probeResult.IsWebRipLike
+
+	if probeResult.VideoStream != nil {
+		job.SourceCodec = probeResult.VideoStream.CodecName
+		job.Resolution = fmt.Sprintf("%dx%d", probeResult.VideoStream.Width, probeResult.VideoStream.Height)
+		job.BitDepth = probeResult.VideoStream.BitsPerSample()
+		job.DynamicHDR = dynamicHDR(probeResult)
+		job.FrameRate = probeResult.VideoStream.AvgFrameRate
+		if job.FrameRate == "" {
+			job.FrameRate = probeResult.VideoStream.RFrameRate
+		}
+	}
+
+	// Count streams
+	audioCount := 0
+	subCount := 0
+	for _, stream := range probeResult.Streams {
+		switch stream.CodecType {
+		case "audio":
+			audioCount++
+		case "subtitle":
+			subCount++
+		}
+	}
+	job.AudioStreams = audioCount
+	job.SubStreams = subCount
+
+	// Container from format
+	job.Container = probeResult.Format.FormatName
+}
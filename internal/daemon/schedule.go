@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+// Schedule decides when new jobs may start, from the configured windows.
+// A schedule without windows is always open.
+type Schedule struct {
+	windows      []scheduleWindow
+	pauseOnClose bool
+}
+
+// scheduleWindow is a parsed config.ScheduleWindow.
+type scheduleWindow struct {
+	name          string
+	days          [7]bool // indexed by time.Weekday
+	start, end    int     // minutes after midnight; end <= start wraps into the next day
+	maxConcurrent int
+	nice          int
+}
+
+// ScheduleState is what the schedule allows at a point in time.
+type ScheduleState struct {
+	Open          bool   `json:"open"`
+	Window        string `json:"window,omitempty"`         // the window in effect, e.g. "mon-fri 22:00-07:00"
+	MaxConcurrent int    `json:"max_concurrent,omitempty"` // 0 = all encode slots
+	Nice          int    `json:"nice,omitempty"`
+}
+
+// weekdayNames maps day names in the config to weekdays.
+var weekdayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// NewSchedule parses the schedule config.
+func NewSchedule(cfg config.ScheduleConfig) (*Schedule, error) {
+	s := &Schedule{}
+	switch cfg.OnClose {
+	case "", "finish":
+	case "pause":
+		s.pauseOnClose = true
+	default:
+		return nil, fmt.Errorf("schedule.on_close must be \"finish\" or \"pause\", got %q", cfg.OnClose)
+	}
+
+	for i, wc := range cfg.Windows {
+		w := scheduleWindow{maxConcurrent: wc.MaxConcurrent, nice: wc.Nice}
+		var err error
+		if w.start, err = parseClock(wc.Start); err != nil {
+			return nil, fmt.Errorf("schedule window %d: start: %w", i+1, err)
+		}
+		if w.end, err = parseClock(wc.End); err != nil {
+			return nil, fmt.Errorf("schedule window %d: end: %w", i+1, err)
+		}
+		if wc.MaxConcurrent < 0 {
+			return nil, fmt.Errorf("schedule window %d: max_concurrent must not be negative", i+1)
+		}
+		if wc.Nice < -20 || wc.Nice > 19 {
+			return nil, fmt.Errorf("schedule window %d: nice must be between -20 and 19", i+1)
+		}
+
+		days := "daily"
+		if len(wc.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		} else {
+			for _, name := range wc.Days {
+				weekdays, ok := weekdayNames[strings.ToLower(name)]
+				if !ok {
+					return nil, fmt.Errorf("schedule window %d: unknown day %q", i+1, name)
+				}
+				for _, d := range weekdays {
+					w.days[d] = true
+				}
+			}
+			days = strings.Join(wc.Days, ",")
+		}
+		w.name = fmt.Sprintf("%s %s-%s", days, wc.Start, wc.End)
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// PauseOnClose reports whether running jobs are paused when a window closes.
+func (s *Schedule) PauseOnClose() bool {
+	return s.pauseOnClose
+}
+
+// At returns what the schedule allows at t. The first matching window wins.
+func (s *Schedule) At(t time.Time) ScheduleState {
+	if len(s.windows) == 0 {
+		return ScheduleState{Open: true}
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range s.windows {
+		var in bool
+		if w.end > w.start {
+			in = w.days[today] && minute >= w.start && minute < w.end
+		} else {
+			// Wraps past midnight: the evening part belongs to today's window,
+			// the early morning part to yesterday's
+			in = (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+		}
+		if in {
+			return ScheduleState{Open: true, Window: w.name, MaxConcurrent: w.maxConcurrent, Nice: w.nice}
+		}
+	}
+	return ScheduleState{}
+}
+
+// parseClock parses "HH:MM" into minutes after midnight. "24:00" is allowed
+// as the end of the day.
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+// at returns a local time in the week of Monday 2026-10-12.
+func at(day time.Weekday, hour, minute int) time.Time {
+	monday := 12 + int(day+6)%7
+	return time.Date(2026, time.October, monday, hour, minute, 0, 0, time.Local)
+}
+
+func TestScheduleAt(t *testing.T) {
+	overnight := config.ScheduleWindow{Start: "22:00", End: "07:00", MaxConcurrent: 2, Nice: 10}
+	friday := config.ScheduleWindow{Days: []string{"fri"}, Start: "22:00", End: "07:00"}
+	sunday := config.ScheduleWindow{Days: []string{"sun"}, Start: "23:00", End: "02:00"}
+	weekdays := config.ScheduleWindow{Days: []string{"weekdays"}, Start: "00:00", End: "24:00", MaxConcurrent: 1}
+	allDay := config.ScheduleWindow{Days: []string{"weekends"}, Start: "00:00", End: "00:00"}
+
+	tests := []struct {
+		name    string
+		windows []config.ScheduleWindow
+		t       time.Time
+		open    bool
+		window  string
+		max     int
+		nice    int
+	}{
+		{"no windows", nil, at(time.Wednesday, 12, 0), true, "", 0, 0},
+		{"overnight evening", []config.ScheduleWindow{overnight}, at(time.Monday, 23, 0), true, "daily 22:00-07:00", 2, 10},
+		{"overnight start", []config.ScheduleWindow{overnight}, at(time.Monday, 22, 0), true, "daily 22:00-07:00", 2, 10},
+		{"overnight before start", []config.ScheduleWindow{overnight}, at(time.Monday, 21, 59), false, "", 0, 0},
+		{"overnight morning", []config.ScheduleWindow{overnight}, at(time.Tuesday, 6, 59), true, "daily 22:00-07:00", 2, 10},
+		{"overnight end", []config.ScheduleWindow{overnight}, at(time.Tuesday, 7, 0), false, "", 0, 0},
+		{"day evening", []config.ScheduleWindow{friday}, at(time.Friday, 23, 30), true, "fri 22:00-07:00", 0, 0},
+		{"day morning after", []config.ScheduleWindow{friday}, at(time.Saturday, 3, 0), true, "fri 22:00-07:00", 0, 0},
+		{"day morning of", []config.ScheduleWindow{friday}, at(time.Friday, 3, 0), false, "", 0, 0},
+		{"day next evening", []config.ScheduleWindow{friday}, at(time.Saturday, 23, 0), false, "", 0, 0},
+		{"week wrap evening", []config.ScheduleWindow{sunday}, at(time.Sunday, 23, 30), true, "sun 23:00-02:00", 0, 0},
+		{"week wrap morning", []config.ScheduleWindow{sunday}, at(time.Monday, 1, 0), true, "sun 23:00-02:00", 0, 0},
+		{"week wrap morning of", []config.ScheduleWindow{sunday}, at(time.Sunday, 1, 0), false, "", 0, 0},
+		{"until midnight", []config.ScheduleWindow{weekdays}, at(time.Friday, 23, 59), true, "weekdays 00:00-24:00", 1, 0},
+		{"until midnight weekend", []config.ScheduleWindow{weekdays}, at(time.Saturday, 0, 0), false, "", 0, 0},
+		{"equal start and end", []config.ScheduleWindow{allDay}, at(time.Sunday, 12, 0), true, "weekends 00:00-00:00", 0, 0},
+		{"overlap first wins", []config.ScheduleWindow{weekdays, overnight}, at(time.Monday, 23, 0), true, "weekdays 00:00-24:00", 1, 0},
+		{"overlap second", []config.ScheduleWindow{weekdays, overnight}, at(time.Saturday, 23, 0), true, "daily 22:00-07:00", 2, 10},
+		{"overlap wrap into first", []config.ScheduleWindow{overnight, weekdays}, at(time.Monday, 3, 0), true, "daily 22:00-07:00", 2, 10},
+		{"overlap neither", []config.ScheduleWindow{weekdays, friday}, at(time.Saturday, 12, 0), false, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSchedule(config.ScheduleConfig{Windows: tt.windows})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.At(tt.t)
+			want := ScheduleState{Open: tt.open, Window: tt.window, MaxConcurrent: tt.max, Nice: tt.nice}
+			if got != want {
+				t.Errorf("At(%s) = %+v, want %+v", tt.t.Format("Mon 15:04"), got, want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ScheduleConfig
+	}{
+		{"bad on_close", config.ScheduleConfig{OnClose: "stop"}},
+		{"bad start", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Start: "22", End: "07:00"}}}},
+		{"bad end", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Start: "22:00", End: "24:30"}}}},
+		{"bad minute", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Start: "22:60", End: "07:00"}}}},
+		{"unknown day", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Days: []string{"funday"}, Start: "22:00", End: "07:00"}}}},
+		{"negative max_concurrent", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Start: "22:00", End: "07:00", MaxConcurrent: -1}}}},
+		{"nice out of range", config.ScheduleConfig{Windows: []config.ScheduleWindow{{Start: "22:00", End: "07:00", Nice: 20}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSchedule(tt.cfg); err == nil {
+				t.Error("NewSchedule succeeded, want an error")
+			}
+		})
+	}
+}
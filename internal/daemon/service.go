@@ -0,0 +1,549 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/ffmpeg"
+	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/metadata"
+	"github.com/yourname/av1qsvd/internal/notify"
+	"github.com/yourname/av1qsvd/internal/scan"
+)
+
+// Daemon is the long-running av1d service.
+// It rescans the library roots every ScanIntervalSec and hands pending jobs
+// from the persistent queue to a pool of workers, bounded by the Limiter.
+type Daemon struct {
+	cfgMu          sync.RWMutex
+	cfg            config.TranscodeConfig // replaced on reload, read through config()
+	ffmpegPath     string
+	queue          *Queue
+	scanner        *Scanner
+	limiter        *Limiter
+	stability      *scan.StabilityTracker
+	space          *SpaceLedger
+	schedule       atomic.Pointer[Schedule]
+	throttle       *Throttle
+	rescan         chan bool     // true forces a full rescan
+	wake           chan struct{} // wakes the dispatcher when a job finishes or the schedule changes
+	reloaded       chan struct{} // tells Run the configuration was reloaded
+	events         *Broker
+	metrics        *Metrics
+	notifier       *notify.Manager
+	startedAt      time.Time
+	brokenEncoders map[string]bool // GPU encoders replaced by SVT-AV1, see DisableEncoder
+	hdr10Fallback  map[string]bool // encoders that drop HDR10 metadata, and whether SVT-AV1 takes over, see DisableHDR10
+
+	mu       sync.Mutex
+	running  map[string]context.CancelCauseFunc // cancel funcs of running jobs, by ID
+	progress map[string]JobProgress             // latest encode progress of running jobs, by ID
+	procs    map[string]*os.Process             // ffmpeg processes of running jobs, by ID
+	pauses   map[string]bool                    // reasons running encodes are paused
+	lastScan *ScanSummary
+}
+
+// New creates a daemon, loading the persisted job queue from JobStateDir.
+func New(cfg config.TranscodeConfig, ffmpegPath string) (*Daemon, error) {
+	queue, err := NewQueue(cfg.JobStateDir)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d existing jobs", queue.Len())
+
+	// Only pin explicit devices when configured or when there is more than one
+	// GPU to spread across; a single GPU keeps VAAPI auto-detection.
+	devices := cfg.RenderNodes
+	if len(devices) == 0 {
+		if nodes := ffmpeg.FindRenderNodes(); len(nodes) > 1 {
+			devices = nodes
+		}
+	}
+	limiter := NewLimiter(devices, cfg.MaxEncodesPerDevice, cfg.MaxConcurrentProbes)
+	log.Printf("Worker pool: %d encode slot(s) across %d device(s), %d probe slot(s)",
+		limiter.Capacity(), len(limiter.Devices()), cap(limiter.probes))
+
+	notifier, err := notify.New(cfg.Notifications)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications config: %w", err)
+	}
+
+	stability := scan.NewStabilityTracker(stableQuiet(cfg))
+
+	schedule, err := NewSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	throttle, err := NewThrottle(cfg.Throttle)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner, err := NewScanner(cfg, ffmpegPath, queue, limiter, stability)
+	if err != nil {
+		return nil, err
+	}
+
+	events := NewBroker()
+	queue.OnChange(func(job jobs.Job, deleted bool) {
+		if deleted {
+			events.Publish(Event{Type: EventJobDeleted, Job: &job})
+			return
+		}
+		events.Publish(Event{Type: EventJob, Job: &job})
+	})
+
+	d := &Daemon{
+		cfg:            cfg,
+		ffmpegPath:     ffmpegPath,
+		queue:          queue,
+		scanner:        scanner,
+		limiter:        limiter,
+		stability:      stability,
+		space:          NewSpaceLedger(),
+		throttle:       throttle,
+		rescan:         make(chan bool, 1),
+		wake:           make(chan struct{}, 1),
+		reloaded:       make(chan struct{}, 1),
+		events:         events,
+		metrics:        NewMetrics(),
+		notifier:       notifier,
+		startedAt:      time.Now(),
+		brokenEncoders: make(map[string]bool),
+		hdr10Fallback:  make(map[string]bool),
+		running:        make(map[string]context.CancelCauseFunc),
+		progress:       make(map[string]JobProgress),
+		procs:          make(map[string]*os.Process),
+		pauses:         make(map[string]bool),
+	}
+	d.schedule.Store(schedule)
+	return d, nil
+}
+
+// Queue returns the daemon's job queue.
+func (d *Daemon) Queue() *Queue {
+	return d.queue
+}
+
+// Scanner returns the daemon's library scanner.
+func (d *Daemon) Scanner() *Scanner {
+	return d.scanner
+}
+
+// Events returns the daemon's event broker.
+func (d *Daemon) Events() *Broker {
+	return d.events
+}
+
+// scanInterval returns the configured rescan interval, defaulting to 60 seconds.
+func (d *Daemon) scanInterval() time.Duration {
+	sec := d.config().ScanIntervalSec
+	if sec <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// watchDebounce returns the configured watcher quiet period, defaulting to 10 seconds.
+func (d *Daemon) watchDebounce() time.Duration {
+	sec := d.config().WatchDebounceSec
+	if sec <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// stableQuiet returns how long a file must stay unchanged before it is
+// judged or encoded, defaulting to 30 seconds.
+func stableQuiet(cfg config.TranscodeConfig) time.Duration {
+	if cfg.StableQuietSec <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(cfg.StableQuietSec) * time.Second
+}
+
+// freeSpaceMargin returns the space kept free on every filesystem,
+// defaulting to 5 GiB.
+func (d *Daemon) freeSpaceMargin() int64 {
+	margin := d.config().FreeSpaceMargin
+	if margin <= 0 {
+		return defaultFreeSpaceMargin
+	}
+	return margin
+}
+
+// shutdownGrace returns how long running encodes may keep going after shutdown
+// is requested, defaulting to 60 seconds.
+func (d *Daemon) shutdownGrace() time.Duration {
+	sec := d.config().ShutdownGraceSec
+	if sec <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// Run scans and processes jobs until ctx is cancelled.
+// Scanning and watcher events are handled on this goroutine; pending jobs are
+// dispatched to workers as encode slots free up.
+//
+// On cancellation no new jobs start. Running encodes get the shutdown grace
+// period to finish; after that ffmpeg is stopped and the interrupted jobs go
+// back to pending. Run returns once all workers have finished.
+func (d *Daemon) Run(ctx context.Context) error {
+	cfg := d.config()
+	if len(cfg.Roots()) == 0 {
+		return fmt.Errorf("no library roots configured")
+	}
+
+	interval := d.scanInterval()
+	log.Printf("Daemon started, rescanning every %s", interval)
+
+	var watched <-chan string
+	if !cfg.DisableWatch {
+		w, err := NewWatcher(cfg.Roots(), d.watchDebounce(), d.stability, d.scanner.IsMedia)
+		if err != nil {
+			log.Printf("Warning: filesystem watcher unavailable, relying on periodic rescans: %v", err)
+		} else {
+			go w.Run(ctx)
+			watched = w.Paths()
+			log.Printf("Watching library roots for new files (debounce %s)", d.watchDebounce())
+		}
+	}
+
+	// Reconcile jobs stuck in running and temp outputs left behind by a crash
+	// before the first scan judges them and workers start
+	d.recoverState()
+	d.scan()
+
+	// Notifications keep flowing until the last job has finished
+	notifyCtx, stopNotify := context.WithCancel(context.Background())
+	notifyDone := make(chan struct{})
+	go func() {
+		d.notifier.Run(notifyCtx)
+		close(notifyDone)
+	}()
+
+	// Jobs run under their own context so they can outlive ctx by the grace period
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	// Know whether the host is over a throttle limit before the first job starts
+	if d.throttle.Enabled() {
+		d.throttle.Sample(nil, false)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.dispatch(ctx, jobCtx)
+	}()
+	go d.runSchedule(ctx)
+	go d.runThrottle(ctx)
+
+	if cfg.ControlSocket != "" {
+		go func() {
+			if err := d.ServeControl(ctx); err != nil {
+				log.Printf("Control socket: %v", err)
+			}
+		}()
+	}
+	if cfg.HTTPListen != "" {
+		go func() {
+			if err := d.ServeHTTP(ctx); err != nil {
+				log.Printf("HTTP API: %v", err)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.shutdown(&wg, cancelJobs)
+			stopNotify()
+			<-notifyDone
+			return nil
+		case <-ticker.C:
+			d.scan()
+		case path := <-watched:
+			d.scanner.ScanPath(path)
+		case full := <-d.rescan:
+			if full {
+				d.scanner.ForgetAll()
+			}
+			d.scan()
+		case <-d.reloaded:
+			ticker.Reset(d.scanInterval())
+		}
+	}
+}
+
+// shutdown waits for running workers, cancelling their jobs once the grace
+// period runs out.
+func (d *Daemon) shutdown(wg *sync.WaitGroup, cancelJobs context.CancelFunc) {
+	grace := d.shutdownGrace()
+	log.Printf("Daemon stopping, giving %d running job(s) %s to finish", d.queue.Running(), grace)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("All jobs finished")
+	case <-time.After(grace):
+		log.Printf("Grace period expired, stopping %d running job(s)", d.queue.Running())
+		cancelJobs()
+		<-done
+	}
+}
+
+// dispatch claims pending jobs and starts a worker for each one as encode
+// slots become available. Workers run under jobCtx. It returns after ctx is
+// cancelled and every worker it started has finished.
+func (d *Daemon) dispatch(ctx, jobCtx context.Context) {
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	for {
+		device, release, err := d.limiter.AcquireEncode(ctx)
+		if err != nil {
+			return
+		}
+
+		job := d.nextJob(ctx)
+		if job == nil {
+			release()
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(jobCtx)
+		d.mu.Lock()
+		d.running[job.ID] = cancel
+		d.mu.Unlock()
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer release()
+			defer d.queue.Release(job)
+			defer func() {
+				d.mu.Lock()
+				delete(d.running, job.ID)
+				delete(d.progress, job.ID)
+				delete(d.procs, job.ID)
+				d.mu.Unlock()
+				cancel(nil)
+				d.wakeDispatcher()
+			}()
+			d.processJob(ctx, job, device)
+		}()
+	}
+}
+
+// scan runs one pass over all library roots and logs a summary.
+func (d *Daemon) scan() ScanResult {
+	result := d.scanner.ScanAll()
+
+	log.Printf("=== Scan Summary ===")
+	log.Printf("Candidates (queued as jobs): %d", len(result.Candidates))
+	for _, path := range result.Candidates {
+		log.Printf("  [CANDIDATE] %s", path)
+	}
+	log.Printf("Skipped files: %d", len(result.Skipped))
+	for _, sf := range result.Skipped {
+		log.Printf("  [SKIPPED] %s - reason: %s", sf.Path, sf.Reason)
+	}
+	log.Printf("Unchanged since last scan: %d", result.Unchanged)
+	log.Printf("Still being written: %d", result.Settling)
+	log.Printf("Excluded by path rules: %d", result.Excluded)
+	log.Printf("=== Scan Complete (%s) ===", result.Duration.Round(time.Millisecond))
+
+	summary := &ScanSummary{
+		FinishedAt: time.Now(),
+		Duration:   result.Duration,
+		Candidates: result.Candidates,
+		Skipped:    result.Skipped,
+		Unchanged:  result.Unchanged,
+		Settling:   result.Settling,
+		Excluded:   result.Excluded,
+		Roots:      result.Roots,
+	}
+	d.mu.Lock()
+	d.lastScan = summary
+	d.mu.Unlock()
+	d.metrics.ObserveScan(summary)
+	d.events.Publish(Event{Type: EventScan, Scan: summary})
+
+	return result
+}
+
+// processJob re-probes a claimed job's source and runs it through ProcessJob
+// on the given device.
+func (d *Daemon) processJob(ctx context.Context, job *jobs.Job, device string) {
+	// A file that changed since it was queued stays queued until it settles
+	if stable, wait, err := d.stability.Check(job.SourcePath); err == nil && !stable {
+		next := time.Now().Add(wait)
+		job.NextAttemptAt = &next
+		job.Reason = "waiting for file to settle"
+		d.queue.Save(job)
+		log.Printf("Job %s: %s is still being written, deferring %s", job.ID, job.SourcePath, wait.Round(time.Second))
+		return
+	}
+
+	cfg := d.config()
+	profileName, profile := jobProfile(cfg, *job)
+
+	// Make sure the output fits on the source's disk alongside other encodes
+	releaseSpace, err := d.space.Reserve(TempOutputPath(job.SourcePath), expectedOutputSize(job, profile.MaxSizeRatio), d.freeSpaceMargin())
+	if err != nil {
+		next := time.Now().Add(spaceRetryDelay)
+		job.NextAttemptAt = &next
+		job.Reason = fmt.Sprintf("deferred: %v", err)
+		d.queue.Save(job)
+		log.Printf("Job %s deferred for %s: %v", job.ID, spaceRetryDelay, err)
+		return
+	}
+	defer releaseSpace()
+
+	log.Printf("Processing job %s on %s with profile %s: %s", job.ID, deviceName(device), profileName, job.SourcePath)
+	defer func() {
+		d.metrics.ObserveJob(*job)
+		d.notifyJob(*job)
+	}()
+
+	// Re-probe file to get fresh metadata
+	release := d.limiter.AcquireProbe()
+	probeResult, err := metadata.ProbeFile(d.ffmpegPath, job.SourcePath)
+	release()
+	if err != nil {
+		log.Printf("Failed to probe file %s: %v", job.SourcePath, err)
+		job.Status = jobs.JobStatusFailed
+		job.Reason = fmt.Sprintf("ffprobe failed: %v", err)
+		d.scheduleRetry(job, err)
+		return
+	}
+
+	// Update job with fresh metadata
+	job.IsWebRipLike = probeResult.IsWebRipLike
+	job.Profile = profileName
+	job.DynamicHDR = dynamicHDR(probeResult)
+	job.HDRPolicy = ""
+	if job.DynamicHDR != "" {
+		job.HDRPolicy = profile.DynamicHDR
+	}
+
+	// The profile's dynamic_hdr policy may have changed since the job was queued
+	if skip, reason := dynamicHDRPolicy(profile, probeResult); skip {
+		now := time.Now()
+		job.Status = jobs.JobStatusSkipped
+		job.Reason = reason
+		job.FinishedAt = &now
+		d.queue.Save(job)
+		metadata.WriteWhyFile(job.SourcePath, reason)
+		return
+	}
+
+	settings := encodeSettings(profile, probeResult)
+	settings.Encoder = d.selectEncoder(cfg, settings.Encoder)
+	encoder, ok := d.hdr10Encoder(settings.Encoder, probeResult)
+	if !ok {
+		now := time.Now()
+		job.Status = jobs.JobStatusSkipped
+		job.Reason = fmt.Sprintf("%s drops HDR10 metadata and %s can't take over", settings.Encoder, ffmpeg.EncoderSVT)
+		job.FinishedAt = &now
+		d.queue.Save(job)
+		metadata.WriteWhyFile(job.SourcePath, job.Reason)
+		return
+	}
+	settings.Encoder = encoder
+	job.Tracks = nil
+	for _, track := range ffmpeg.SelectTracks(probeResult, settings.Audio, settings.Subtitles) {
+		job.Tracks = append(job.Tracks, track.String())
+	}
+	if len(job.Tracks) > 0 {
+		log.Printf("Job %s tracks: %s", job.ID, strings.Join(job.Tracks, "; "))
+	}
+
+	daemonCfg := TranscodeConfig{
+		JobStateDir:  cfg.JobStateDir,
+		MaxSizeRatio: profile.MaxSizeRatio,
+		Encode:       settings,
+		WebSafe:      profile.UseWebSafe(probeResult.IsWebRipLike),
+		Device:       device,
+		SaveJob:      d.queue.Save,
+		OnProgress:   d.recordProgress,
+		OnStart:      d.trackProcess(job.ID),
+		Nice:         d.schedule.Load().At(time.Now()).Nice,
+	}
+
+	if err := ProcessJob(ctx, job, d.ffmpegPath, probeResult, daemonCfg); err != nil {
+		if ctx.Err() != nil {
+			d.finishInterrupted(ctx, job)
+			return
+		}
+		log.Printf("Job %s failed: %v", job.ID, err)
+		if job.Status == jobs.JobStatusFailed {
+			d.scheduleRetry(job, err)
+		}
+		return
+	}
+
+	// Log result
+	switch job.Status {
+	case jobs.JobStatusSuccess:
+		savings := float64(job.OriginalSize-job.NewSize) / float64(job.OriginalSize) * 100
+		log.Printf("Job succeeded: %s - savings: %.1f%%", job.SourcePath, savings)
+	case jobs.JobStatusSkipped:
+		log.Printf("Job skipped: %s - reason: %s", job.SourcePath, job.Reason)
+	case jobs.JobStatusFailed:
+		log.Printf("Job failed: %s - reason: %s", job.SourcePath, job.Reason)
+	}
+}
+
+// notifyJob sends the notification for a job a worker has finished with, if
+// its outcome is one that notifications cover.
+func (d *Daemon) notifyJob(job jobs.Job) {
+	switch {
+	case job.Status == jobs.JobStatusSuccess:
+		d.notifier.Notify(notify.ForJob(notify.EventJobSuccess, job))
+	case job.Status == jobs.JobStatusFailed:
+		d.notifier.Notify(notify.ForJob(notify.EventJobFailed, job))
+	case job.Status == jobs.JobStatusSkipped && ReasonCategory(job) == "size_gate":
+		d.notifier.Notify(notify.ForJob(notify.EventSizeGate, job))
+	}
+}
+
+// recordProgress keeps the latest encode progress of a running job and
+// publishes it on the event stream.
+func (d *Daemon) recordProgress(job *jobs.Job, p ffmpeg.Progress) {
+	jp := JobProgress{
+		JobID:      job.ID,
+		SourcePath: job.SourcePath,
+		Device:     job.Device,
+		Progress:   p,
+	}
+	d.mu.Lock()
+	d.progress[job.ID] = jp
+	d.mu.Unlock()
+	d.events.Publish(Event{Type: EventProgress, Progress: &jp})
+}
+
+// deviceName returns a printable name for a render node.
+func deviceName(device string) string {
+	if device == "" {
+		return "auto-detected device"
+	}
+	return device
+}
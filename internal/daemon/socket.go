@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// ServeControl serves the local control API on the configured Unix socket
+// until ctx is cancelled.
+//
+// The API is plain HTTP with JSON bodies, so it can be used with
+// `curl --unix-socket`:
+//
+//	GET  /jobs                 list jobs (?status=pending&path=substring)
+//	GET  /jobs/{id}            get one job
+//	POST /jobs                 enqueue a path under a library root: {"path": "/media/file.mkv"}
+//	POST /jobs/{id}/cancel     stop a running or pending job
+//	POST /jobs/{id}/retry      put a failed, skipped or backing-off job back to pending
+//	POST /jobs/{id}/skip       permanently skip a job's file
+//	POST /jobs/{id}/priority   reprioritize: {"priority": 10}
+//	DELETE /jobs/{id}          forget a job that is not running
+//	GET  /queue                queue state
+//	POST /queue/pause          stop starting new jobs
+//	POST /queue/resume         start new jobs again
+//	POST /scan                 rescan now (?full=true re-judges every file)
+//	GET  /status               daemon status, as served by the HTTP API
+//	GET  /config               effective configuration, without notifier secrets
+//
+// Access is controlled by the socket's file mode and group. Since the daemon
+// may run as a more privileged user than the socket's group, the API only
+// touches files under the configured library roots and never shows secrets.
+func (d *Daemon) ServeControl(ctx context.Context) error {
+	cfg := d.config()
+	path := cfg.ControlSocket
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	// Remove a stale socket left by a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+
+	if err := applySocketPermissions(path, cfg.ControlSocketMode, cfg.ControlSocketGroup); err != nil {
+		ln.Close()
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           d.controlHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Control API listening on %s", path)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// applySocketPermissions sets the socket's mode (octal string, e.g. "0660")
+// and group. Empty values leave the defaults: 0660 and the daemon's group.
+func applySocketPermissions(path, mode, group string) error {
+	perm := os.FileMode(0660)
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return fmt.Errorf("invalid control_socket_mode %q: %w", mode, err)
+		}
+		perm = os.FileMode(m)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return fmt.Errorf("failed to chmod socket: %w", err)
+	}
+
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("control_socket_group %q: %w", group, err)
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			return fmt.Errorf("control_socket_group %q: invalid gid %q", group, g.Gid)
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return fmt.Errorf("failed to chown socket to group %s: %w", group, err)
+		}
+	}
+	return nil
+}
+
+// controlHandler builds the routes of the control API.
+func (d *Daemon) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, FilterJobs(d.queue.All(), r.URL.Query().Get("status"), r.URL.Query().Get("path")))
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := d.queue.Get(r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("expected {\"path\": ...}"))
+			return
+		}
+		job, err := d.EnqueuePath(req.Path)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, job)
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", d.jobAction(d.CancelJob))
+	mux.HandleFunc("POST /jobs/{id}/retry", d.jobAction(d.RetryJob))
+	mux.HandleFunc("POST /jobs/{id}/skip", d.jobAction(d.SkipJob))
+	mux.HandleFunc("POST /jobs/{id}/priority", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Priority *int `json:"priority"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Priority == nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("expected {\"priority\": n}"))
+			return
+		}
+		d.jobAction(func(id string) (jobs.Job, error) {
+			return d.SetPriority(id, *req.Priority)
+		})(w, r)
+	})
+
+	mux.HandleFunc("DELETE /jobs/{id}", d.jobAction(d.DeleteJob))
+
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.QueueState())
+	})
+	mux.HandleFunc("POST /queue/pause", func(w http.ResponseWriter, r *http.Request) {
+		d.PauseQueue()
+		writeJSON(w, http.StatusOK, d.QueueState())
+	})
+	mux.HandleFunc("POST /queue/resume", func(w http.ResponseWriter, r *http.Request) {
+		d.ResumeQueue()
+		writeJSON(w, http.StatusOK, d.QueueState())
+	})
+
+	mux.HandleFunc("POST /scan", func(w http.ResponseWriter, r *http.Request) {
+		d.TriggerScan(r.URL.Query().Get("full") == "true")
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "scan requested"})
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.Status())
+	})
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.Config().Redacted())
+	})
+
+	return mux
+}
+
+// jobAction adapts a job operation to a handler for /jobs/{id}/... routes.
+func (d *Daemon) jobAction(op func(id string) (jobs.Job, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if _, ok := d.queue.Get(id); !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", id))
+			return
+		}
+		job, err := op(id)
+		if err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, ErrJobBusy) {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+}
+
+// FilterJobs returns the jobs matching a status and a source path substring.
+// Empty filters match everything.
+func FilterJobs(all []jobs.Job, status, pathContains string) []jobs.Job {
+	filtered := []jobs.Job{}
+	for _, job := range all {
+		if status != "" && string(job.Status) != status {
+			continue
+		}
+		if pathContains != "" && !strings.Contains(job.SourcePath, pathContains) {
+			continue
+		}
+		filtered = append(filtered, job)
+	}
+	return filtered
+}
+
+// writeJSON writes v as an indented JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeError writes an error as {"error": "..."}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,224 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// call sends a request to a handler and decodes the JSON response into out,
+// if given.
+func call(t *testing.T, h http.Handler, method, target, body string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	if out != nil {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, target, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestControlHandlerJobs(t *testing.T) {
+	root := t.TempDir()
+	d := newTestDaemon(t, root)
+	h := d.controlHandler()
+
+	source := func(name string) string {
+		path := filepath.Join(root, name)
+		if err := os.WriteFile(path, []byte("h264 source"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pending := addJob(t, d.queue, source("pending.mkv"), jobs.JobStatusPending)
+	skip := addJob(t, d.queue, source("skip.mkv"), jobs.JobStatusPending)
+	done := addJob(t, d.queue, source("done.mkv"), jobs.JobStatusSuccess)
+	failed := addJob(t, d.queue, source("failed.mkv"), jobs.JobStatusFailed)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		code   int
+		status jobs.JobStatus // of the returned job, "" = not checked
+	}{
+		{"get", "GET", "/jobs/" + done.ID, "", http.StatusOK, jobs.JobStatusSuccess},
+		{"get unknown", "GET", "/jobs/nope", "", http.StatusNotFound, ""},
+		{"cancel pending", "POST", "/jobs/" + pending.ID + "/cancel", "", http.StatusOK, jobs.JobStatusSkipped},
+		{"cancel finished", "POST", "/jobs/" + done.ID + "/cancel", "", http.StatusUnprocessableEntity, ""},
+		{"cancel unknown", "POST", "/jobs/nope/cancel", "", http.StatusNotFound, ""},
+		{"retry", "POST", "/jobs/" + failed.ID + "/retry", "", http.StatusOK, jobs.JobStatusPending},
+		{"retry finished", "POST", "/jobs/" + done.ID + "/retry", "", http.StatusUnprocessableEntity, ""},
+		{"skip", "POST", "/jobs/" + skip.ID + "/skip", "", http.StatusOK, jobs.JobStatusSkipped},
+		{"priority", "POST", "/jobs/" + failed.ID + "/priority", `{"priority": 7}`, http.StatusOK, jobs.JobStatusPending},
+		{"priority without a value", "POST", "/jobs/" + failed.ID + "/priority", `{}`, http.StatusBadRequest, ""},
+		{"priority of a finished job", "POST", "/jobs/" + done.ID + "/priority", `{"priority": 7}`, http.StatusUnprocessableEntity, ""},
+		{"enqueue without a path", "POST", "/jobs", `{}`, http.StatusBadRequest, ""},
+		{"enqueue outside the library", "POST", "/jobs", `{"path": "/etc/passwd"}`, http.StatusUnprocessableEntity, ""},
+		{"enqueue a directory", "POST", "/jobs", `{"path": "` + root + `"}`, http.StatusUnprocessableEntity, ""},
+		{"delete", "DELETE", "/jobs/" + done.ID, "", http.StatusOK, jobs.JobStatusSuccess},
+		{"get deleted", "GET", "/jobs/" + done.ID, "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		var job jobs.Job
+		var resp any = &job
+		if tt.code != http.StatusOK {
+			resp = &map[string]string{}
+		}
+		if code := call(t, h, tt.method, tt.target, tt.body, resp); code != tt.code {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.code)
+			continue
+		}
+		if tt.status != "" && job.Status != tt.status {
+			t.Errorf("%s: job status %q, want %q", tt.name, job.Status, tt.status)
+		}
+		if tt.code != http.StatusOK && (*resp.(*map[string]string))["error"] == "" {
+			t.Errorf("%s: no error message", tt.name)
+		}
+	}
+
+	if job, _ := d.queue.Get(failed.ID); job.Priority != 7 {
+		t.Errorf("priority %d, want 7", job.Priority)
+	}
+	if _, err := os.Stat(SkipMarkerPath(skip.SourcePath)); err != nil {
+		t.Errorf("skip left no marker: %v", err)
+	}
+
+	// A job a worker holds can't be deleted or changed under it
+	claimed := d.queue.Claim()
+	if claimed == nil {
+		t.Fatal("nothing to claim")
+	}
+	if code := call(t, h, "DELETE", "/jobs/"+claimed.ID, "", nil); code != http.StatusConflict {
+		t.Errorf("delete claimed: status %d, want %d", code, http.StatusConflict)
+	}
+
+	var list []jobs.Job
+	call(t, h, "GET", "/jobs?status=skipped", "", &list)
+	if len(list) != 2 {
+		t.Errorf("GET /jobs?status=skipped returned %d jobs, want 2", len(list))
+	}
+	call(t, h, "GET", "/jobs?path=pending", "", &list)
+	if len(list) != 1 || list[0].ID != pending.ID {
+		t.Errorf("GET /jobs?path=pending returned %v", list)
+	}
+}
+
+func TestControlHandlerQueue(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	h := d.controlHandler()
+
+	var state QueueState
+	if code := call(t, h, "POST", "/queue/pause", "", &state); code != http.StatusOK || !state.Paused {
+		t.Errorf("pause: status %d, state %+v", code, state)
+	}
+	if !d.queue.Paused() {
+		t.Error("queue not paused")
+	}
+	if code := call(t, h, "POST", "/queue/resume", "", &state); code != http.StatusOK || state.Paused {
+		t.Errorf("resume: status %d, state %+v", code, state)
+	}
+	call(t, h, "GET", "/queue", "", &state)
+	if state.Capacity != d.limiter.Capacity() {
+		t.Errorf("capacity %d, want %d", state.Capacity, d.limiter.Capacity())
+	}
+
+	if code := call(t, h, "POST", "/scan?full=true", "", nil); code != http.StatusAccepted {
+		t.Errorf("scan: status %d", code)
+	}
+	select {
+	case full := <-d.rescan:
+		if !full {
+			t.Error("full rescan requested as a quick one")
+		}
+	default:
+		t.Error("scan not requested")
+	}
+}
+
+func TestControlHandlerConfigRedacted(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	d.cfg.Notifications = []config.NotifierConfig{{
+		Name:    "discord",
+		URL:     "https://discord.com/api/webhooks/123/secret-token",
+		Token:   "secret-token",
+		Headers: map[string]string{"Authorization": "Bearer secret-token"},
+	}}
+
+	rec := httptest.NewRecorder()
+	d.controlHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "secret-token") || !strings.Contains(body, "discord.com") {
+		t.Errorf("/config leaks or lost the notifier:\n%s", body)
+	}
+}
+
+func TestServeControl(t *testing.T) {
+	d := newTestDaemon(t, t.TempDir())
+	socket := filepath.Join(t.TempDir(), "run", "av1d.sock")
+	d.cfg.ControlSocket = socket
+	d.cfg.ControlSocketMode = "0600"
+
+	// A stale socket from an earlier run is replaced
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(socket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- d.ServeControl(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if resp, err = client.Get("http://av1d/queue"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /queue over the socket: status %d", resp.StatusCode)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ServeControl = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeControl did not stop")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Error("socket left behind")
+	}
+}
@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// spaceRetryDelay is how long a job that didn't fit on its disk waits
+// before it is tried again.
+const spaceRetryDelay = 5 * time.Minute
+
+// defaultFreeSpaceMargin is kept free on every filesystem when
+// FreeSpaceMargin is not configured.
+const defaultFreeSpaceMargin = 5 * 1024 * 1024 * 1024
+
+// SpaceLedger tracks disk space promised to running encodes, per filesystem,
+// so concurrent jobs writing to the same disk don't overcommit it.
+type SpaceLedger struct {
+	mu           sync.Mutex
+	reservations map[*reservation]struct{}
+}
+
+// reservation is the space set aside for one job's output.
+type reservation struct {
+	fsid   uint64 // st_dev of the filesystem
+	output string // temp output being written
+	bytes  int64
+}
+
+// InsufficientSpaceError is returned when a job doesn't fit on its filesystem.
+type InsufficientSpaceError struct {
+	Dir      string
+	Need     int64 // estimated output plus the safety margin
+	Free     int64 // available to unprivileged writers
+	Reserved int64 // still to be written by other running jobs
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough free space in %s: need %.1f GB, %.1f GB free with %.1f GB reserved by running jobs",
+		e.Dir, gb(e.Need), gb(e.Free), gb(e.Reserved))
+}
+
+// NewSpaceLedger creates an empty ledger.
+func NewSpaceLedger() *SpaceLedger {
+	return &SpaceLedger{reservations: make(map[*reservation]struct{})}
+}
+
+// Reserve checks that the filesystem holding output has room for bytes plus
+// margin on top of what other running jobs are still going to write, and
+// sets the space aside. The returned func releases the reservation.
+func (l *SpaceLedger) Reserve(output string, bytes, margin int64) (func(), error) {
+	dir := filepath.Dir(output)
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return nil, fmt.Errorf("failed to check free space in %s: %w", dir, err)
+	}
+	free := int64(st.Bavail) * int64(st.Bsize)
+	fsid, err := filesystemID(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reserved := l.outstanding(fsid)
+	if need := bytes + margin; free-reserved < need {
+		return nil, &InsufficientSpaceError{Dir: dir, Need: need, Free: free, Reserved: reserved}
+	}
+
+	r := &reservation{fsid: fsid, output: output, bytes: bytes}
+	l.reservations[r] = struct{}{}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.reservations, r)
+	}, nil
+}
+
+// Reserved returns the bytes running jobs are still expected to write,
+// across all filesystems.
+func (l *SpaceLedger) Reserved() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var total int64
+	for r := range l.reservations {
+		total += r.remaining()
+	}
+	return total
+}
+
+// outstanding returns the bytes reserved on a filesystem that have not been
+// written yet. Free space already reflects what has been written. Must be
+// called with l.mu held.
+func (l *SpaceLedger) outstanding(fsid uint64) int64 {
+	var total int64
+	for r := range l.reservations {
+		if r.fsid == fsid {
+			total += r.remaining()
+		}
+	}
+	return total
+}
+
+// remaining returns how much of the reservation the output hasn't used yet.
+func (r *reservation) remaining() int64 {
+	written := int64(0)
+	if info, err := os.Stat(r.output); err == nil {
+		written = info.Size()
+	}
+	return max(r.bytes-written, 0)
+}
+
+// filesystemID identifies the filesystem a path is on.
+func filesystemID(path string) (uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return uint64(st.Dev), nil
+}
+
+// expectedOutputSize returns the space to set aside for a job's output: the
+// estimate from scanning, or the largest output the size gate would accept
+// when there is no estimate.
+func expectedOutputSize(job *jobs.Job, maxSizeRatio float64) int64 {
+	if job.EstimatedSize > 0 {
+		return job.EstimatedSize
+	}
+	if maxSizeRatio <= 0 {
+		maxSizeRatio = 1
+	}
+	return int64(float64(job.OriginalSize) * maxSizeRatio)
+}
+
+// gb converts bytes to GiB for messages.
+func gb(bytes int64) float64 {
+	return float64(bytes) / (1024 * 1024 * 1024)
+}
@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSpaceLedgerReserve(t *testing.T) {
+	dir := t.TempDir()
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		t.Fatal(err)
+	}
+	free := int64(st.Bavail) * int64(st.Bsize)
+	if free < 1<<20 {
+		t.Skipf("only %d bytes free in %s", free, dir)
+	}
+	// Sizes leave a tenth of the disk either way, so other writers don't
+	// change the outcome
+	half, tenth := free/2, free/10
+
+	l := NewSpaceLedger()
+	first := filepath.Join(dir, "first"+tempOutputSuffix)
+	releaseFirst, err := l.Reserve(first, half, 0)
+	if err != nil {
+		t.Fatalf("Reserve(half) = %v", err)
+	}
+	if l.Reserved() != half {
+		t.Errorf("Reserved() = %d, want %d", l.Reserved(), half)
+	}
+
+	// Two jobs may not promise the same space
+	second := filepath.Join(dir, "second"+tempOutputSuffix)
+	_, err = l.Reserve(second, half-tenth, 2*tenth)
+	var serr *InsufficientSpaceError
+	if !errors.As(err, &serr) {
+		t.Fatalf("overcommitting Reserve = %v, want an InsufficientSpaceError", err)
+	}
+	if serr.Reserved != half || serr.Need != half+tenth || serr.Dir != dir {
+		t.Errorf("error = %+v", serr)
+	}
+
+	// The margin counts too
+	if _, err := l.Reserve(second, tenth, half); err == nil {
+		t.Error("Reserve ignored the margin")
+	}
+	releaseSecond, err := l.Reserve(second, tenth, tenth)
+	if err != nil {
+		t.Fatalf("Reserve within the remaining space = %v", err)
+	}
+
+	// What a job has already written is no longer outstanding: free space
+	// reflects it
+	if err := os.WriteFile(first, make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if want := half - 4096 + tenth; l.Reserved() != want {
+		t.Errorf("Reserved() after writing = %d, want %d", l.Reserved(), want)
+	}
+
+	releaseFirst()
+	releaseSecond()
+	if l.Reserved() != 0 {
+		t.Errorf("Reserved() after release = %d", l.Reserved())
+	}
+	if release, err := l.Reserve(second, half, 0); err != nil {
+		t.Errorf("Reserve after release = %v", err)
+	} else {
+		release()
+	}
+
+	if _, err := l.Reserve(filepath.Join(dir, "missing", "out.mkv"), 1, 0); err == nil || errors.As(err, &serr) {
+		t.Errorf("Reserve in a missing directory = %v", err)
+	}
+}
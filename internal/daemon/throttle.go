@@ -0,0 +1,300 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/sysmon"
+)
+
+const (
+	defaultThrottleInterval = 10 * time.Second
+
+	// A signal over its limit only counts as recovered once it drops below
+	// releaseRatio of the limit (releaseTempC under it for temperatures), so
+	// encodes don't flap on and off around the limit.
+	releaseRatio = 0.9
+	releaseTempC = 5.0
+
+	pauseThrottle = "host over throttle limits"
+
+	// When other programs' GPU use can't be told apart from av1d's own (see
+	// Throttle.Sample), running encodes are paused every gpuProbeInterval for
+	// gpuProbeSettle and the GPU is sampled while they are stopped.
+	gpuProbeInterval = 5 * time.Minute
+	gpuProbeSettle   = 2 * time.Second
+	pauseGPUProbe    = "measuring GPU use of other programs"
+)
+
+// Signals a throttle can be over.
+const (
+	signalLoad   = "load"
+	signalMemory = "memory"
+	signalGPU    = "gpu"
+	signalTemp   = "temperature"
+)
+
+// ThrottleState is the latest host sample and which limits it is over.
+type ThrottleState struct {
+	Throttled     bool      `json:"throttled"`
+	Over          []string  `json:"over,omitempty"` // signals over their limit: load, memory, gpu, temperature
+	LoadPerCPU    float64   `json:"load_per_cpu"`
+	MemoryPercent float64   `json:"memory_percent"`
+	GPUPercent    float64   `json:"gpu_percent"`
+	TempC         float64   `json:"temp_c"`
+	TempSensor    string    `json:"temp_sensor,omitempty"`
+	GPUStale      bool      `json:"gpu_stale,omitempty"` // other programs' GPU use couldn't be measured, the last judgement stands
+	SampledAt     time.Time `json:"sampled_at"`
+}
+
+// Throttle samples host load, memory, GPU and temperatures and decides when
+// the daemon should hold back.
+type Throttle struct {
+	mu        sync.Mutex
+	cfg       config.ThrottleConfig
+	over      map[string]bool
+	state     ThrottleState
+	drm       sysmon.DRMSnapshot // GPU clients at the last sample
+	lastProbe time.Time          // when running encodes were last paused to sample the GPU
+}
+
+// NewThrottle validates cfg and returns a throttle for it.
+func NewThrottle(cfg config.ThrottleConfig) (*Throttle, error) {
+	if err := validateThrottle(cfg); err != nil {
+		return nil, err
+	}
+	return &Throttle{cfg: cfg, over: make(map[string]bool)}, nil
+}
+
+func validateThrottle(cfg config.ThrottleConfig) error {
+	if cfg.MaxLoad < 0 || cfg.MaxTempC < 0 || cfg.IntervalSec < 0 {
+		return fmt.Errorf("throttle: limits and interval_sec must not be negative")
+	}
+	for name, percent := range map[string]float64{"max_memory_percent": cfg.MaxMemoryPercent, "max_gpu_percent": cfg.MaxGPUPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("throttle: %s must be between 0 and 100, got %g", name, percent)
+		}
+	}
+	return nil
+}
+
+// SetConfig changes the limits. Signals already over a limit stay that way
+// until the next sample judges them against the new one.
+func (t *Throttle) SetConfig(cfg config.ThrottleConfig) error {
+	if err := validateThrottle(cfg); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+	if !enabled(cfg) {
+		t.over = make(map[string]bool)
+		t.state = ThrottleState{}
+	}
+	return nil
+}
+
+// Enabled reports whether any limit is set.
+func (t *Throttle) Enabled() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return enabled(t.cfg)
+}
+
+func enabled(cfg config.ThrottleConfig) bool {
+	return cfg.MaxLoad > 0 || cfg.MaxMemoryPercent > 0 || cfg.MaxGPUPercent > 0 || cfg.MaxTempC > 0
+}
+
+// Interval returns how often the host is sampled.
+func (t *Throttle) Interval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cfg.IntervalSec <= 0 {
+		return defaultThrottleInterval
+	}
+	return time.Duration(t.cfg.IntervalSec) * time.Second
+}
+
+// State returns the latest sample.
+func (t *Throttle) State() ThrottleState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// Sample reads the host signals and updates the throttle state. own are the
+// PIDs of the daemon's ffmpeg processes and encoding whether any of them is
+// running (not paused).
+//
+// GPU use is measured per process from DRM fdinfo, leaving out own. Where
+// that is not possible (an old kernel, or other users' processes that can't
+// be inspected) only whole-GPU utilization is available, which is judged
+// while encoding is false; while it is true the last judgement stands and
+// GPUStale is set, see probeGPU.
+func (t *Throttle) Sample(own map[int]bool, encoding bool) ThrottleState {
+	t.mu.Lock()
+	cfg := t.cfg
+	t.mu.Unlock()
+
+	st := ThrottleState{SampledAt: time.Now()}
+	if avg, err := load.Avg(); err == nil {
+		st.LoadPerCPU = avg.Load1 / float64(runtime.NumCPU())
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		st.MemoryPercent = vm.UsedPercent
+	}
+	judgeGPU := false
+	if cfg.MaxGPUPercent > 0 {
+		snap := sysmon.DRMClients()
+		t.mu.Lock()
+		prev := t.drm
+		t.drm = snap
+		t.mu.Unlock()
+		if percent, ok := sysmon.ExternalGPUPercent(prev, snap, own); ok {
+			st.GPUPercent, judgeGPU = percent, true
+		} else if !encoding {
+			st.GPUPercent, judgeGPU = sysmon.GPUUsage(), true
+		} else {
+			st.GPUStale = true
+		}
+	}
+	if cfg.MaxTempC > 0 {
+		if hottest, ok := sysmon.Hottest(sysmon.Temperatures(), cfg.TempSensors); ok {
+			st.TempC = hottest.Celsius
+			st.TempSensor = hottest.Chip + " " + hottest.Label
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.judge(signalLoad, st.LoadPerCPU, cfg.MaxLoad, cfg.MaxLoad*releaseRatio)
+	t.judge(signalMemory, st.MemoryPercent, cfg.MaxMemoryPercent, cfg.MaxMemoryPercent*releaseRatio)
+	if judgeGPU || cfg.MaxGPUPercent <= 0 {
+		t.judge(signalGPU, st.GPUPercent, cfg.MaxGPUPercent, cfg.MaxGPUPercent*releaseRatio)
+	}
+	t.judge(signalTemp, st.TempC, cfg.MaxTempC, cfg.MaxTempC-releaseTempC)
+	for _, signal := range []string{signalLoad, signalMemory, signalGPU, signalTemp} {
+		if t.over[signal] {
+			st.Over = append(st.Over, signal)
+		}
+	}
+	st.Throttled = len(st.Over) > 0
+	t.state = st
+	return st
+}
+
+// judge updates whether a signal is over its limit. Must be called with t.mu held.
+func (t *Throttle) judge(signal string, value, limit, release float64) {
+	switch {
+	case limit <= 0:
+		delete(t.over, signal)
+	case value >= limit:
+		t.over[signal] = true
+	case value < release:
+		delete(t.over, signal)
+	}
+}
+
+// describe explains a sample for the log.
+func (t *Throttle) describe(st ThrottleState) string {
+	t.mu.Lock()
+	cfg := t.cfg
+	t.mu.Unlock()
+
+	var parts []string
+	for _, signal := range st.Over {
+		switch signal {
+		case signalLoad:
+			parts = append(parts, fmt.Sprintf("load %.2f per core (limit %.2f)", st.LoadPerCPU, cfg.MaxLoad))
+		case signalMemory:
+			parts = append(parts, fmt.Sprintf("memory %.0f%% (limit %.0f%%)", st.MemoryPercent, cfg.MaxMemoryPercent))
+		case signalGPU:
+			parts = append(parts, fmt.Sprintf("GPU %.0f%% busy (limit %.0f%%)", st.GPUPercent, cfg.MaxGPUPercent))
+		case signalTemp:
+			parts = append(parts, fmt.Sprintf("%s at %.0f°C (limit %.0f°C)", st.TempSensor, st.TempC, cfg.MaxTempC))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runThrottle samples the host until ctx is cancelled. Crossing a limit holds
+// back new jobs, and with pause_running also pauses running encodes.
+func (d *Daemon) runThrottle(ctx context.Context) {
+	ticker := time.NewTicker(d.throttle.Interval())
+	defer ticker.Stop()
+
+	throttled := false
+	for {
+		// Limits may be switched on and off by a reload
+		var st ThrottleState
+		if d.throttle.Enabled() {
+			st = d.throttle.Sample(d.ownEncodes())
+			if st.GPUStale && d.throttle.probeDue() {
+				st = d.probeGPU(ctx)
+			}
+		}
+		if st.Throttled != throttled {
+			throttled = st.Throttled
+			if throttled {
+				log.Printf("Throttling: %s", d.throttle.describe(st))
+			} else {
+				log.Printf("Host back under throttle limits")
+			}
+			d.wakeDispatcher()
+		}
+		// Checked on every sample, so a reloaded pause_running takes effect too
+		d.setPaused(pauseThrottle, throttled && d.config().Throttle.PauseRunning)
+		d.setPaused(pauseGPUProbe, false)
+
+		ticker.Reset(d.throttle.Interval())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeDue reports whether running encodes may be paused to sample the GPU.
+func (t *Throttle) probeDue() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.lastProbe) >= gpuProbeInterval
+}
+
+// probeGPU pauses running encodes briefly, so the whole-GPU utilization is
+// other programs' alone, and samples the host. The caller lifts the pause
+// once it has applied the result, so a GPU found busy can keep encodes
+// paused without resuming them in between.
+func (d *Daemon) probeGPU(ctx context.Context) ThrottleState {
+	d.throttle.mu.Lock()
+	d.throttle.lastProbe = time.Now()
+	d.throttle.mu.Unlock()
+
+	d.setPaused(pauseGPUProbe, true)
+	select {
+	case <-ctx.Done():
+	case <-time.After(gpuProbeSettle):
+	}
+	return d.throttle.Sample(nil, false)
+}
+
+// ownEncodes returns the PIDs of the daemon's ffmpeg processes, and whether
+// any of them is running and not paused.
+func (d *Daemon) ownEncodes() (map[int]bool, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pids := make(map[int]bool, len(d.procs))
+	for _, p := range d.procs {
+		pids[p.Pid] = true
+	}
+	return pids, len(d.procs) > 0 && len(d.pauses) == 0
+}
@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yourname/av1qsvd/internal/scan"
+)
+
+// Watcher picks up new and moved media under the library roots using inotify,
+// so files are queued within seconds instead of waiting for the next rescan.
+//
+// Events are debounced per path: a file is only handed on once no events have
+// arrived for the debounce period and the stability tracker confirms it has
+// been unchanged for its quiet period. Files still being copied keep
+// generating write events and are held until the copy finishes.
+type Watcher struct {
+	fsw       *fsnotify.Watcher
+	debounce  time.Duration
+	stability *scan.StabilityTracker
+	isMedia   func(path string) bool
+	paths     chan string
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewWatcher creates a watcher on every directory below the given roots.
+// Directories that cannot be watched (for example when fs.inotify.max_user_watches
+// is exhausted) are logged and left to the periodic rescan. Only files isMedia
+// accepts are reported.
+func NewWatcher(roots []string, debounce time.Duration, stability *scan.StabilityTracker, isMedia func(path string) bool) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		fsw:       fsw,
+		debounce:  debounce,
+		stability: stability,
+		isMedia:   isMedia,
+		paths:     make(chan string, 64),
+		timers:    make(map[string]*time.Timer),
+	}
+	for _, root := range roots {
+		w.addTree(root)
+	}
+	return w, nil
+}
+
+// Paths returns the channel of settled media file paths.
+func (w *Watcher) Paths() <-chan string {
+	return w.paths
+}
+
+// Run processes filesystem events until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	defer w.fsw.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.stopTimers()
+			return
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(ctx, event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
+
+// handle reacts to a single filesystem event.
+func (w *Watcher) handle(ctx context.Context, event fsnotify.Event) {
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// The old name is gone; a Create follows for the new name if it
+		// was moved within a watched tree.
+		w.cancel(event.Name)
+		w.stability.Forget(event.Name)
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) {
+			// A directory was created or moved in: watch it and pick up
+			// anything that arrived with it.
+			w.addTree(event.Name)
+			filepath.Walk(event.Name, func(path string, fi os.FileInfo, err error) error {
+				if err == nil && !fi.IsDir() && w.isMedia(path) {
+					w.schedule(ctx, path)
+				}
+				return nil
+			})
+		}
+		return
+	}
+
+	if w.isMedia(event.Name) {
+		w.stability.Observe(event.Name, info)
+		w.schedule(ctx, event.Name)
+	}
+}
+
+// schedule (re)starts the debounce timer for a path.
+func (w *Watcher) schedule(ctx context.Context, path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.timers[path]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.timers[path] = time.AfterFunc(w.debounce, func() {
+		w.settle(ctx, path)
+	})
+}
+
+// settle runs once a path has had no events for the debounce period.
+// It emits the path once the file has been unchanged for the quiet period,
+// and otherwise re-arms the timer for the time remaining.
+func (w *Watcher) settle(ctx context.Context, path string) {
+	stable, wait, err := w.stability.Check(path)
+	if err != nil {
+		w.cancel(path)
+		return
+	}
+	if !stable {
+		log.Printf("Watcher: %s still settling, checking again in %s", path, wait.Round(time.Second))
+		w.mu.Lock()
+		if t, ok := w.timers[path]; ok {
+			t.Reset(wait)
+		}
+		w.mu.Unlock()
+		return
+	}
+
+	w.cancel(path)
+	select {
+	case w.paths <- path:
+	case <-ctx.Done():
+	}
+}
+
+// cancel drops any pending timer for a path.
+func (w *Watcher) cancel(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.timers[path]; ok {
+		t.Stop()
+		delete(w.timers, path)
+	}
+}
+
+// stopTimers cancels all pending timers.
+func (w *Watcher) stopTimers() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for path, t := range w.timers {
+		t.Stop()
+		delete(w.timers, path)
+	}
+}
+
+// addTree adds a directory and all of its subdirectories to the watch list.
+func (w *Watcher) addTree(root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if err := w.fsw.Add(path); err != nil {
+			log.Printf("Watcher: cannot watch %s: %v", path, err)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/scan"
+)
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	quiet := 200 * time.Millisecond
+	isMedia := func(path string) bool { return strings.HasSuffix(path, ".mkv") }
+	w, err := NewWatcher([]string{root}, 20*time.Millisecond, scan.NewStabilityTracker(quiet), isMedia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A file copied in several writes, a non-media file and a directory
+	// moved in with a file already in it
+	copying := filepath.Join(root, "copying.mkv")
+	write(copying, "part 1")
+	write(filepath.Join(root, "notes.txt"), "not media")
+	outside := filepath.Join(t.TempDir(), "season")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write(filepath.Join(outside, "episode.mkv"), "episode")
+	if err := os.Rename(outside, filepath.Join(root, "season")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	write(copying, "part 1, part 2")
+	lastWrite := time.Now()
+
+	got := make(map[string]time.Time)
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case path := <-w.Paths():
+			if _, dup := got[path]; dup {
+				t.Errorf("%s reported twice", path)
+			}
+			got[path] = time.Now()
+		case <-timeout:
+			t.Fatalf("reported %v, want copying.mkv and season/episode.mkv", got)
+		}
+	}
+
+	at, ok := got[copying]
+	if !ok {
+		t.Errorf("copying.mkv not reported: %v", got)
+	} else if at.Sub(lastWrite) < quiet {
+		t.Errorf("copying.mkv reported %v after its last write, before the quiet period", at.Sub(lastWrite))
+	}
+	if _, ok := got[filepath.Join(root, "season", "episode.mkv")]; !ok {
+		t.Errorf("file in a moved-in directory not reported: %v", got)
+	}
+
+	// Nothing else turns up, including the non-media file
+	select {
+	case path := <-w.Paths():
+		t.Errorf("unexpected %s", path)
+	case <-time.After(quiet + 100*time.Millisecond):
+	}
+}
@@ -0,0 +1,174 @@
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// Capabilities reports what an encoder backend can do on this machine, as
+// found by ProbeCapabilities.
+type Capabilities struct {
+	Encoder   string `json:"encoder"`
+	OK        bool   `json:"ok"`              // the probe, decode, filter and encode chain works
+	Device    string `json:"device"`          // render node it worked on, "" = auto-detected or CPU
+	TenBit    bool   `json:"ten_bit"`         // a 10-bit source comes out as 10-bit AV1
+	HDR10     bool   `json:"hdr10"`           // an HDR10 source keeps its color description and static metadata
+	MaxWidth  int    `json:"max_width"`       // largest test frame that encoded, 0 = none
+	MaxHeight int    `json:"max_height"`      // height of that frame
+	Error     string `json:"error,omitempty"` // why the chain failed, if not OK
+}
+
+// String summarizes the report on one line.
+func (c *Capabilities) String() string {
+	if !c.OK {
+		return fmt.Sprintf("%s: not working: %s", c.Encoder, c.Error)
+	}
+	device := c.Device
+	if device == "" {
+		device = "auto-detected device"
+		if enc, err := LookupEncoder(c.Encoder); err == nil && !enc.Hardware() {
+			device = "CPU"
+		}
+	}
+	depth := "8-bit only"
+	if c.TenBit {
+		depth = "10-bit"
+	}
+	hdr := "drops HDR10 metadata"
+	if c.HDR10 {
+		hdr = "keeps HDR10 metadata"
+	}
+	return fmt.Sprintf("%s: working on %s, %s, %s, up to %dx%d", c.Encoder, device, depth, hdr, c.MaxWidth, c.MaxHeight)
+}
+
+// testSizes are the frame sizes tried for the maximum resolution, largest
+// first.
+var testSizes = []struct{ width, height int }{
+	{7680, 4320},
+	{3840, 2160},
+	{1920, 1080},
+	{1280, 720},
+}
+
+// selfTestTimeout bounds each ffmpeg run of the self-test.
+const selfTestTimeout = 2 * time.Minute
+
+// ProbeCapabilities runs short test clips through an encoder's real
+// pipeline, built by TranscodeArgs from an ffprobe of the clip, trying each
+// device in turn ("" when devices is empty). It reports the first device the
+// pipeline works on, whether 10-bit sources stay 10-bit, whether HDR10
+// sources pass VerifyOutput, and the largest frame the encoder takes there.
+//
+// The returned error means the test itself could not run; a broken encoder
+// is reported in the Capabilities.
+func ProbeCapabilities(ffmpegPath, encoder string, devices []string) (*Capabilities, error) {
+	enc, err := LookupEncoder(encoder)
+	if err != nil {
+		return nil, err
+	}
+	caps := &Capabilities{Encoder: enc.Name()}
+	if !enc.Hardware() || len(devices) == 0 {
+		devices = []string{""}
+	}
+
+	dir, err := os.MkdirTemp("", "av1d-selftest-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create self-test directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// H.264 8-bit decodes on every GPU; the 10-bit clip is HEVC Main 10,
+	// which Intel GPUs decode but not 10-bit H.264
+	clip := filepath.Join(dir, "clip-8bit.mkv")
+	if err := makeTestClip(ffmpegPath, clip, "libx264", "yuv420p"); err != nil {
+		return nil, err
+	}
+
+	for _, device := range devices {
+		if _, err = runPipeline(ffmpegPath, enc, clip, filepath.Join(dir, "out.mkv"), device); err == nil {
+			caps.OK, caps.Device = true, device
+			break
+		}
+	}
+	if !caps.OK {
+		caps.Error = err.Error()
+		if FailureCategoryOf(err) == FailureGPUInit {
+			caps.Error += " (check that vainfo works as the service user, that it can open /dev/dri/* and that the Intel media driver is installed)"
+		}
+		return caps, nil
+	}
+
+	clip10 := filepath.Join(dir, "clip-10bit.mkv")
+	if makeTestClip(ffmpegPath, clip10, "libx265", "yuv420p10le") == nil {
+		out, err := runPipeline(ffmpegPath, enc, clip10, filepath.Join(dir, "out-10bit.mkv"), caps.Device)
+		caps.TenBit = err == nil && out.VideoStream != nil && out.VideoStream.BitsPerSample() >= 10
+	}
+
+	// Encodes of HDR10 sources fail verification if the encoder drops the
+	// mastering display or content light metadata, so find out up front
+	clipHDR := filepath.Join(dir, "clip-hdr10.mkv")
+	if makeTestClip(ffmpegPath, clipHDR, "libx265", "yuv420p10le", hdr10ClipArgs...) == nil {
+		source, err := metadata.ProbeFile(ffmpegPath, clipHDR)
+		if err == nil && source.VideoStream != nil {
+			out, err := runPipeline(ffmpegPath, enc, clipHDR, filepath.Join(dir, "out-hdr10.mkv"), caps.Device)
+			caps.HDR10 = err == nil && VerifyOutput(source.VideoStream, out.VideoStream) == nil
+		}
+	}
+
+	for _, size := range testSizes {
+		if enc.Check(ffmpegPath, caps.Device, size.width, size.height) == nil {
+			caps.MaxWidth, caps.MaxHeight = size.width, size.height
+			break
+		}
+	}
+	return caps, nil
+}
+
+// hdr10ClipArgs tag a libx265 test clip as HDR10, with BT.2020 primaries,
+// the PQ transfer and a typical 1000-nit mastering display.
+var hdr10ClipArgs = []string{
+	"-color_primaries", "bt2020", "-color_trc", "smpte2084", "-colorspace", "bt2020nc",
+	"-x265-params", "hdr10=1:master-display=G(13250,34500)B(7500,3000)R(34000,16000)WP(15635,16450)L(10000000,50):max-cll=1000,400",
+}
+
+// makeTestClip encodes a second of test pattern with a software encoder, so
+// the self-test has a real file to probe and decode. extra are further
+// output options.
+func makeTestClip(ffmpegPath, path, codec, pixFmt string, extra ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	args := []string{
+		"-hide_banner", "-v", "error", "-y",
+		"-f", "lavfi", "-i", "testsrc2=s=1280x720:r=24:d=1",
+		"-c:v", codec, "-pix_fmt", pixFmt,
+	}
+	args = append(append(args, extra...), path)
+	if _, err := RunTranscode(ctx, ffmpegPath, args); err != nil {
+		return fmt.Errorf("failed to create %s test clip: %w", codec, err)
+	}
+	return nil
+}
+
+// runPipeline encodes a clip to outputPath exactly as the daemon would with
+// the default encode settings, and returns the probe of the output.
+func runPipeline(ffmpegPath string, enc Encoder, clip, outputPath, device string) (*metadata.ProbeResult, error) {
+	probeResult, err := metadata.ProbeFile(ffmpegPath, clip)
+	if err != nil {
+		return nil, err
+	}
+	args, err := TranscodeArgs(ffmpegPath, clip, outputPath, probeResult, false, device, EncodeSettings{Encoder: enc.Name()})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	if _, err := RunTranscode(ctx, ffmpegPath, append([]string{"-y"}, args...)); err != nil {
+		return nil, err
+	}
+	return metadata.ProbeFile(ffmpegPath, outputPath)
+}
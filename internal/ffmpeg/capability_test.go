@@ -0,0 +1,32 @@
+package ffmpeg
+
+import "testing"
+
+func TestCapabilitiesString(t *testing.T) {
+	tests := []struct {
+		caps Capabilities
+		want string
+	}{
+		{
+			Capabilities{Encoder: EncoderVAAPI, OK: true, Device: "/dev/dri/renderD128", MaxWidth: 7680, MaxHeight: 4320},
+			"av1_vaapi: working on /dev/dri/renderD128, 8-bit only, drops HDR10 metadata, up to 7680x4320",
+		},
+		{
+			Capabilities{Encoder: EncoderQSV, OK: true, TenBit: true, HDR10: true, MaxWidth: 3840, MaxHeight: 2160},
+			"av1_qsv: working on auto-detected device, 10-bit, keeps HDR10 metadata, up to 3840x2160",
+		},
+		{
+			Capabilities{Encoder: EncoderSVT, OK: true, TenBit: true, HDR10: true, MaxWidth: 7680, MaxHeight: 4320},
+			"libsvtav1: working on CPU, 10-bit, keeps HDR10 metadata, up to 7680x4320",
+		},
+		{
+			Capabilities{Encoder: EncoderQSV, Error: "no usable device"},
+			"av1_qsv: not working: no usable device",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.caps.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// VideoFormat is what an encode keeps of the source video's format: its bit
+// depth and HDR10 static metadata.
+type VideoFormat struct {
+	BitDepth         int                         // 10 or more encodes 10-bit
+	MasteringDisplay *metadata.MasteringDisplay  // nil if the source has none
+	ContentLight     *metadata.ContentLightLevel // nil if the source has none
+}
+
+// videoFormatOf returns the format of a source video stream.
+func videoFormatOf(v *metadata.StreamInfo) VideoFormat {
+	return VideoFormat{
+		BitDepth:         v.BitsPerSample(),
+		MasteringDisplay: v.MasteringDisplay(),
+		ContentLight:     v.ContentLightLevel(),
+	}
+}
+
+// softwareFormat returns the pixel format software encoders get.
+func (f VideoFormat) softwareFormat() string {
+	if f.BitDepth >= 10 {
+		return "yuv420p10le"
+	}
+	return "yuv420p"
+}
+
+// svtHDRParams returns the -svtav1-params value carrying the HDR10 static
+// metadata, or "" if there is none.
+func svtHDRParams(f VideoFormat) string {
+	var params []string
+	if md := f.MasteringDisplay; md != nil {
+		params = append(params, fmt.Sprintf("mastering-display=G(%.4f,%.4f)B(%.4f,%.4f)R(%.4f,%.4f)WP(%.4f,%.4f)L(%.4f,%.4f)",
+			md.Green[0], md.Green[1], md.Blue[0], md.Blue[1], md.Red[0], md.Red[1],
+			md.WhitePoint[0], md.WhitePoint[1], md.MaxLuminance, md.MinLuminance))
+	}
+	if cl := f.ContentLight; cl != nil {
+		params = append(params, fmt.Sprintf("content-light=%d,%d", cl.MaxCLL, cl.MaxFALL))
+	}
+	return strings.Join(params, ":")
+}
+
+// colorTags returns the source's color description, by ffmpeg output option.
+func colorTags(v *metadata.StreamInfo) [][2]string {
+	return [][2]string{
+		{"-color_primaries:v:0", v.ColorPrimaries},
+		{"-color_trc:v:0", v.ColorTransfer},
+		{"-colorspace:v:0", v.ColorSpace},
+		{"-color_range:v:0", v.ColorRange},
+	}
+}
+
+// knownColor reports whether ffprobe gave a color value worth keeping.
+func knownColor(value string) bool {
+	return value != "" && value != "unknown" && value != "reserved"
+}
+
+// colorArgs tags the output with the source's color description, so the
+// AV1 sequence header and the Matroska track say the same as the source.
+func colorArgs(v *metadata.StreamInfo) []string {
+	var args []string
+	for _, tag := range colorTags(v) {
+		if knownColor(tag[1]) {
+			args = append(args, tag[0], tag[1])
+		}
+	}
+	return args
+}
+
+// stripDynamicHDRFilters remove the Dolby Vision and HDR10+ metadata the
+// decoder attaches to frames, so encoders don't pass it on.
+func stripDynamicHDRFilters() []string {
+	return []string{
+		"sidedata=mode=delete:type=DOVI_RPU_BUFFER",
+		"sidedata=mode=delete:type=DOVI_METADATA",
+		"sidedata=mode=delete:type=DYNAMIC_HDR_PLUS",
+	}
+}
+
+// VerifyError is returned when an encode lost part of the source's format.
+// Encoding the same source with the same encoder loses it again, so it is
+// not worth retrying.
+type VerifyError struct {
+	Problems []string
+}
+
+func (e *VerifyError) Error() string {
+	return strings.Join(e.Problems, "; ")
+}
+
+// VerifyOutput checks that an encode kept the source video's bit depth,
+// color description and HDR10 static metadata, and returns a *VerifyError
+// listing what was lost.
+func VerifyOutput(source, output *metadata.StreamInfo) error {
+	if output == nil {
+		return &VerifyError{Problems: []string{"output has no video stream"}}
+	}
+	var problems []string
+	if in, out := source.BitsPerSample(), output.BitsPerSample(); in >= 10 && out < 10 {
+		problems = append(problems, fmt.Sprintf("%d-bit source came out as %d-bit", in, out))
+	}
+	for i, tag := range colorTags(source) {
+		got := colorTags(output)[i][1]
+		if knownColor(tag[1]) && got != tag[1] {
+			name := strings.TrimSuffix(strings.TrimPrefix(tag[0], "-"), ":v:0")
+			problems = append(problems, fmt.Sprintf("%s is %q, source has %q", name, got, tag[1]))
+		}
+	}
+	if source.MasteringDisplay() != nil && output.MasteringDisplay() == nil {
+		problems = append(problems, "mastering display metadata was lost")
+	}
+	if source.ContentLightLevel() != nil && output.ContentLightLevel() == nil {
+		problems = append(problems, "content light level metadata was lost")
+	}
+	if len(problems) > 0 {
+		return &VerifyError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package ffmpeg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// Side data as ffprobe reports it for a typical HDR10 Blu-ray: a P3 D65
+// mastering display of 1000 cd/m² and a content light level.
+var (
+	masteringDisplay = metadata.SideData{
+		Type: metadata.SideDataMasteringDisplay,
+		RedX: "34000/50000", RedY: "16000/50000",
+		GreenX: "13250/50000", GreenY: "34500/50000",
+		BlueX: "7500/50000", BlueY: "3000/50000",
+		WhitePointX: "15635/50000", WhitePointY: "16450/50000",
+		MinLuminance: "50/10000", MaxLuminance: "10000000/10000",
+	}
+	contentLight = metadata.SideData{Type: metadata.SideDataContentLight, MaxContent: 1000, MaxAverage: 400}
+)
+
+// hdr10Stream returns a 10-bit PQ BT.2020 video stream with side data.
+func hdr10Stream(sideData ...metadata.SideData) *metadata.StreamInfo {
+	return &metadata.StreamInfo{
+		CodecType:      "video",
+		PixFmt:         "yuv420p10le",
+		ColorPrimaries: "bt2020",
+		ColorTransfer:  metadata.TransferPQ,
+		ColorSpace:     "bt2020nc",
+		ColorRange:     "tv",
+		SideDataList:   sideData,
+	}
+}
+
+func TestSvtHDRParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		sideData []metadata.SideData
+		want     string
+	}{
+		{
+			name:     "mastering display and content light",
+			sideData: []metadata.SideData{masteringDisplay, contentLight},
+			want:     "mastering-display=G(0.2650,0.6900)B(0.1500,0.0600)R(0.6800,0.3200)WP(0.3127,0.3290)L(1000.0000,0.0050):content-light=1000,400",
+		},
+		{
+			name:     "mastering display only",
+			sideData: []metadata.SideData{masteringDisplay},
+			want:     "mastering-display=G(0.2650,0.6900)B(0.1500,0.0600)R(0.6800,0.3200)WP(0.3127,0.3290)L(1000.0000,0.0050)",
+		},
+		{
+			name:     "content light only",
+			sideData: []metadata.SideData{contentLight},
+			want:     "content-light=1000,400",
+		},
+		{
+			name:     "mastering display without luminance is ignored",
+			sideData: []metadata.SideData{{Type: metadata.SideDataMasteringDisplay, RedX: "34000/50000"}},
+			want:     "",
+		},
+		{
+			name: "no static metadata",
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svtHDRParams(videoFormatOf(hdr10Stream(tt.sideData...))); got != tt.want {
+				t.Errorf("svtHDRParams:\n got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyOutput(t *testing.T) {
+	source := hdr10Stream(masteringDisplay, contentLight)
+	tests := []struct {
+		name   string
+		output func(*metadata.StreamInfo)
+		want   []string // problems, nil = passes
+	}{
+		{
+			name:   "everything kept",
+			output: func(*metadata.StreamInfo) {},
+		},
+		{
+			name:   "lost bit depth",
+			output: func(s *metadata.StreamInfo) { s.PixFmt = "yuv420p" },
+			want:   []string{"10-bit source came out as 8-bit"},
+		},
+		{
+			name:   "raw bit depth wins over the pixel format",
+			output: func(s *metadata.StreamInfo) { s.BitDepth = 8 },
+			want:   []string{"10-bit source came out as 8-bit"},
+		},
+		{
+			name: "lost color tags",
+			output: func(s *metadata.StreamInfo) {
+				s.ColorPrimaries = "bt709"
+				s.ColorTransfer = ""
+				s.ColorRange = "unknown"
+			},
+			want: []string{
+				`color_primaries is "bt709", source has "bt2020"`,
+				`color_trc is "", source has "smpte2084"`,
+				`color_range is "unknown", source has "tv"`,
+			},
+		},
+		{
+			name:   "lost static metadata",
+			output: func(s *metadata.StreamInfo) { s.SideDataList = nil },
+			want: []string{
+				"mastering display metadata was lost",
+				"content light level metadata was lost",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := hdr10Stream(masteringDisplay, contentLight)
+			tt.output(output)
+			err := VerifyOutput(source, output)
+			var verr *VerifyError
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("VerifyOutput = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.As(err, &verr) {
+				t.Fatalf("VerifyOutput = %v, want a *VerifyError", err)
+			}
+			if !reflect.DeepEqual(verr.Problems, tt.want) {
+				t.Errorf("problems:\n got %q\nwant %q", verr.Problems, tt.want)
+			}
+			if FailureCategoryOf(err) != FailureVerify {
+				t.Errorf("category %q, want %q", FailureCategoryOf(err), FailureVerify)
+			}
+		})
+	}
+
+	// Unknown source tags and an 8-bit source have nothing to lose
+	sdr := &metadata.StreamInfo{CodecType: "video", PixFmt: "yuv420p", ColorPrimaries: "unknown"}
+	if err := VerifyOutput(sdr, &metadata.StreamInfo{CodecType: "video", PixFmt: "yuv420p10le"}); err != nil {
+		t.Errorf("SDR source: %v", err)
+	}
+	if err := VerifyOutput(source, nil); err == nil {
+		t.Error("output without a video stream passed")
+	}
+}
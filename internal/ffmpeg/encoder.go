@@ -0,0 +1,232 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+// Encoder names, as ffmpeg knows them. The config package owns the list so
+// it can validate profiles.
+const (
+	EncoderVAAPI = config.EncoderVAAPI
+	EncoderQSV   = config.EncoderQSV
+	EncoderSVT   = config.EncoderSVT
+)
+
+// DefaultEncoder is used when EncodeSettings.Encoder is empty.
+const DefaultEncoder = EncoderVAAPI
+
+// Encoder is an AV1 encoder backend. It owns the parts of the ffmpeg command
+// that depend on the encoder: hardware setup and decoding, the video filter
+// chain and the codec options. Stream mapping and muxing are shared.
+type Encoder interface {
+	// Name returns the ffmpeg encoder name, e.g. "av1_vaapi".
+	Name() string
+	// Hardware reports whether the encoder runs on a GPU render node.
+	Hardware() bool
+	// InputArgs returns the options before -i: device setup and hardware
+	// decoding. device is a render node, or "" to let ffmpeg pick one.
+	InputArgs(device string) []string
+	// Filters returns the video filter chain, keeping the source's bit
+	// depth. webSafe adds the sample aspect ratio fixes for web sources.
+	Filters(webSafe bool, format VideoFormat) []string
+	// CodecArgs returns the video encoder options.
+	CodecArgs(quality, compressionLevel int, format VideoFormat) []string
+	// Check encodes one generated width x height frame on device and
+	// returns why the encoder can't, or nil.
+	Check(ffmpegPath, device string, width, height int) error
+}
+
+var encoders = map[string]Encoder{
+	EncoderVAAPI: vaapiEncoder{},
+	EncoderQSV:   qsvEncoder{},
+	EncoderSVT:   svtEncoder{},
+}
+
+// LookupEncoder returns the encoder backend with the given name; "" is the
+// default encoder.
+func LookupEncoder(name string) (Encoder, error) {
+	if name == "" {
+		name = DefaultEncoder
+	}
+	enc, ok := encoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoder %q (have %s)", name, strings.Join(EncoderNames(), ", "))
+	}
+	return enc, nil
+}
+
+// EncoderNames returns the names of every encoder backend, sorted.
+func EncoderNames() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// vaapiEncoder decodes, scales and encodes through VAAPI. This avoids QSV's
+// MFX session errors on Intel Arc GPUs, which support AV1 via VAAPI directly.
+type vaapiEncoder struct{}
+
+func (vaapiEncoder) Name() string   { return EncoderVAAPI }
+func (vaapiEncoder) Hardware() bool { return true }
+
+func (vaapiEncoder) InputArgs(device string) []string {
+	// Auto-detection (vaapi=va) is more reliable; an explicit device is only
+	// used when the daemon schedules across several GPUs
+	return []string{
+		"-init_hw_device", vaapiDevice(device),
+		"-hwaccel", "vaapi",
+		"-hwaccel_output_format", "vaapi",
+		"-filter_hw_device", "va",
+	}
+}
+
+func (vaapiEncoder) Filters(webSafe bool, format VideoFormat) []string {
+	return append(vaapiScale(webSafe, format), "hwupload")
+}
+
+func (vaapiEncoder) CodecArgs(quality, compressionLevel int, _ VideoFormat) []string {
+	return []string{
+		"-c:v:0", EncoderVAAPI,
+		"-global_quality:v:0", fmt.Sprintf("%d", quality),
+		"-compression_level", fmt.Sprintf("%d", compressionLevel), // VAAPI equivalent of preset
+	}
+}
+
+func (e vaapiEncoder) Check(ffmpegPath, device string, width, height int) error {
+	return checkEncoder(ffmpegPath, e, width, height, "-init_hw_device", vaapiDevice(device), "-filter_hw_device", "va")
+}
+
+// qsvEncoder decodes and scales through VAAPI and encodes with oneVPL on a
+// QSV device derived from the same GPU.
+type qsvEncoder struct{}
+
+func (qsvEncoder) Name() string   { return EncoderQSV }
+func (qsvEncoder) Hardware() bool { return true }
+
+func (qsvEncoder) InputArgs(device string) []string {
+	return []string{
+		"-init_hw_device", vaapiDevice(device),
+		"-init_hw_device", "qsv=qsv@va",
+		"-hwaccel", "vaapi",
+		"-hwaccel_output_format", "vaapi",
+		"-hwaccel_device", "va",
+		"-filter_hw_device", "qsv",
+	}
+}
+
+func (qsvEncoder) Filters(webSafe bool, format VideoFormat) []string {
+	return append(vaapiScale(webSafe, format), "hwupload=extra_hw_frames=64")
+}
+
+func (qsvEncoder) CodecArgs(quality, compressionLevel int, _ VideoFormat) []string {
+	return []string{
+		"-c:v:0", EncoderQSV,
+		"-global_quality:v:0", fmt.Sprintf("%d", quality),
+		"-preset", fmt.Sprintf("%d", compressionLevel), // 1 (veryslow) to 7 (veryfast)
+	}
+}
+
+func (e qsvEncoder) Check(ffmpegPath, device string, width, height int) error {
+	return checkEncoder(ffmpegPath, e, width, height,
+		"-init_hw_device", vaapiDevice(device),
+		"-init_hw_device", "qsv=qsv@va",
+		"-filter_hw_device", "qsv",
+	)
+}
+
+// svtEncoder encodes with SVT-AV1 on the CPU. It is much slower than the GPU
+// encoders but works on any machine.
+type svtEncoder struct{}
+
+func (svtEncoder) Name() string              { return EncoderSVT }
+func (svtEncoder) Hardware() bool            { return false }
+func (svtEncoder) InputArgs(string) []string { return nil }
+
+func (svtEncoder) Filters(webSafe bool, format VideoFormat) []string {
+	var parts []string
+	if webSafe {
+		parts = append(parts, "scale=w='if(gt(iw,iw*sar),iw,iw*sar)':h='if(gt(iw,iw*sar),iw/sar,ih)'")
+	}
+	return append(parts,
+		"scale=w=ceil(iw/2)*2:h=ceil(ih/2)*2",
+		"setsar=1",
+		"format="+format.softwareFormat(),
+	)
+}
+
+// CodecArgs uses quality as SVT-AV1's CRF, capped at its maximum of 63, and
+// maps compression levels 1 to 7 onto presets 5 to 11. HDR10 static
+// metadata is passed to SVT-AV1 directly, which doesn't read it from frames.
+func (svtEncoder) CodecArgs(quality, compressionLevel int, format VideoFormat) []string {
+	args := []string{
+		"-c:v:0", EncoderSVT,
+		"-crf:v:0", fmt.Sprintf("%d", min(quality, 63)),
+		"-preset:v:0", fmt.Sprintf("%d", compressionLevel+4),
+	}
+	if params := svtHDRParams(format); params != "" {
+		args = append(args, "-svtav1-params:v:0", params)
+	}
+	return args
+}
+
+func (e svtEncoder) Check(ffmpegPath, _ string, width, height int) error {
+	return checkEncoder(ffmpegPath, e, width, height)
+}
+
+// vaapiDevice returns the -init_hw_device value for a VAAPI device named va.
+func vaapiDevice(device string) string {
+	if device == "" {
+		return "vaapi=va"
+	}
+	return "vaapi=va:" + device
+}
+
+// vaapiScale returns the VAAPI filters that fix the sample aspect ratio and
+// make the dimensions even, ending with NV12 or, for 10-bit sources, P010
+// frames in system memory.
+func vaapiScale(webSafe bool, format VideoFormat) []string {
+	surface := determineSurfaceFormat(format.BitDepth)
+	var parts []string
+	if webSafe {
+		// WebRip: scale to square pixels on the GPU first
+		parts = append(parts, "scale_vaapi=w='if(gt(iw,iw*sar),iw,iw*sar)':h='if(gt(iw,iw*sar),iw/sar,ih)'")
+	}
+	return append(parts,
+		"scale_vaapi=w=ceil(iw/2)*2:h=ceil(ih/2)*2",
+		"hwdownload,format="+surface,
+		"setsar=1",
+		"format="+surface,
+	)
+}
+
+// checkEncoder encodes one generated frame with an encoder. hwArgs set up
+// its device; frames are uploaded to it as NV12.
+func checkEncoder(ffmpegPath string, enc Encoder, width, height int, hwArgs ...string) error {
+	args := append([]string{"-hide_banner", "-v", "error"}, hwArgs...)
+	args = append(args, "-f", "lavfi", "-i", fmt.Sprintf("testsrc2=s=%dx%d:d=1", width, height))
+	if enc.Hardware() {
+		args = append(args, "-vf", "format=nv12,hwupload=extra_hw_frames=64")
+	} else {
+		args = append(args, "-vf", "format=yuv420p")
+	}
+	args = append(args, "-frames:v", "1")
+	args = append(args, enc.CodecArgs(30, 7, VideoFormat{BitDepth: 8})...)
+	args = append(args, "-f", "null", "-")
+
+	cmd := exec.Command(ffmpegPath, args...)
+	// Set LD_LIBRARY_PATH to help static ffmpeg find dynamic VA-API libraries
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH=/lib/x86_64-linux-gnu:/usr/lib/x86_64-linux-gnu:"+os.Getenv("LD_LIBRARY_PATH"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s test encode failed: %w: %s", enc.Name(), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
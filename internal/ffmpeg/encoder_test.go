@@ -0,0 +1,91 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+func TestLookupEncoder(t *testing.T) {
+	for _, name := range []string{"", EncoderVAAPI, EncoderQSV, EncoderSVT} {
+		enc, err := LookupEncoder(name)
+		if err != nil {
+			t.Errorf("LookupEncoder(%q) = %v", name, err)
+			continue
+		}
+		want := name
+		if want == "" {
+			want = DefaultEncoder
+		}
+		if enc.Name() != want || enc.Hardware() != (want != EncoderSVT) {
+			t.Errorf("LookupEncoder(%q) = %s, hardware %t", name, enc.Name(), enc.Hardware())
+		}
+	}
+	if _, err := LookupEncoder("libaom-av1"); err == nil || !strings.Contains(err.Error(), strings.Join(EncoderNames(), ", ")) {
+		t.Errorf("LookupEncoder(libaom-av1) = %v, want an error listing the encoders", err)
+	}
+}
+
+func TestEncoderArgs(t *testing.T) {
+	eightBit := VideoFormat{BitDepth: 8}
+	hdr10 := VideoFormat{BitDepth: 10, ContentLight: &metadata.ContentLightLevel{MaxCLL: 1000, MaxFALL: 400}}
+	tests := []struct {
+		encoder string
+		device  string
+		format  VideoFormat
+		quality int
+		input   []string // options before -i
+		filters []string
+		codec   []string
+	}{
+		{
+			encoder: EncoderVAAPI,
+			format:  eightBit,
+			quality: 25,
+			input:   []string{"-init_hw_device", "vaapi=va", "-hwaccel", "vaapi", "-hwaccel_output_format", "vaapi", "-filter_hw_device", "va"},
+			filters: []string{"scale_vaapi=w=ceil(iw/2)*2:h=ceil(ih/2)*2", "hwdownload,format=nv12", "setsar=1", "format=nv12", "hwupload"},
+			codec:   []string{"-c:v:0", "av1_vaapi", "-global_quality:v:0", "25", "-compression_level", "4"},
+		},
+		{
+			encoder: EncoderQSV,
+			device:  "/dev/dri/renderD129",
+			format:  hdr10,
+			quality: 25,
+			input: []string{"-init_hw_device", "vaapi=va:/dev/dri/renderD129", "-init_hw_device", "qsv=qsv@va",
+				"-hwaccel", "vaapi", "-hwaccel_output_format", "vaapi", "-hwaccel_device", "va", "-filter_hw_device", "qsv"},
+			filters: []string{"scale_vaapi=w=ceil(iw/2)*2:h=ceil(ih/2)*2", "hwdownload,format=p010", "setsar=1", "format=p010", "hwupload=extra_hw_frames=64"},
+			codec:   []string{"-c:v:0", "av1_qsv", "-global_quality:v:0", "25", "-preset", "4"},
+		},
+		{
+			encoder: EncoderSVT,
+			device:  "/dev/dri/renderD128", // ignored
+			format:  hdr10,
+			quality: 80, // capped at SVT-AV1's maximum CRF
+			filters: []string{"scale=w=ceil(iw/2)*2:h=ceil(ih/2)*2", "setsar=1", "format=yuv420p10le"},
+			codec:   []string{"-c:v:0", "libsvtav1", "-crf:v:0", "63", "-preset:v:0", "8", "-svtav1-params:v:0", "content-light=1000,400"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoder, func(t *testing.T) {
+			enc, err := LookupEncoder(tt.encoder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := enc.InputArgs(tt.device); !reflect.DeepEqual(got, tt.input) {
+				t.Errorf("InputArgs:\n got %q\nwant %q", got, tt.input)
+			}
+			if got := enc.Filters(false, tt.format); !reflect.DeepEqual(got, tt.filters) {
+				t.Errorf("Filters:\n got %q\nwant %q", got, tt.filters)
+			}
+			if got := enc.CodecArgs(tt.quality, 4, tt.format); !reflect.DeepEqual(got, tt.codec) {
+				t.Errorf("CodecArgs:\n got %q\nwant %q", got, tt.codec)
+			}
+			// WebRip fixes square the pixels first
+			if web := enc.Filters(true, tt.format); len(web) != len(tt.filters)+1 || !strings.Contains(web[0], "iw*sar") {
+				t.Errorf("Filters(webSafe) = %q", web)
+			}
+		})
+	}
+}
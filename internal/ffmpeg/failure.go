@@ -0,0 +1,121 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// FailureCategory groups transcode failures by what is likely wrong, so the
+// daemon can decide whether and when to retry.
+type FailureCategory string
+
+const (
+	FailureGPUInit  FailureCategory = "gpu_init"  // the GPU or its driver could not be set up
+	FailureDecode   FailureCategory = "decode"    // the source is corrupt or unsupported
+	FailureDiskFull FailureCategory = "disk_full" // no space left for the output
+	FailureIO       FailureCategory = "io"        // reading, writing or moving files failed
+	FailureVerify   FailureCategory = "verify"    // the output lost the source's bit depth, colors or HDR metadata
+	FailureUnknown  FailureCategory = "unknown"
+)
+
+// TranscodeError is returned by RunTranscode when ffmpeg exits with an error.
+type TranscodeError struct {
+	ExitCode int
+	Category FailureCategory
+	Summary  string // the relevant error lines from ffmpeg's output
+}
+
+func (e *TranscodeError) Error() string {
+	return fmt.Sprintf("ffmpeg failed with exit code %d: %s", e.ExitCode, e.Summary)
+}
+
+// failurePatterns maps substrings of ffmpeg's output to a category.
+// They are checked in order, so more specific causes come first.
+var failurePatterns = []struct {
+	category FailureCategory
+	patterns []string
+}{
+	{FailureDiskFull, []string{
+		"No space left on device",
+		"Disk quota exceeded",
+	}},
+	{FailureGPUInit, []string{
+		"Failed to initialise VAAPI",
+		"vaInitialize failed",
+		"No VA display found",
+		"Device creation failed",
+		"Failed to set value 'va",
+		"Failed to set value 'qsv",
+		"Error creating a MFX session",
+		"Error initializing an internal MFX session",
+		"Failed to create a VAAPI device",
+		"Failed to create surface",
+		"Error while opening encoder",
+		"Error initializing output stream",
+		"Cannot load libva",
+		"/dev/dri",
+	}},
+	{FailureDecode, []string{
+		"Invalid data found when processing input",
+		"Error while decoding",
+		"error while decoding",
+		"decode_slice_header error",
+		"Invalid NAL unit",
+		"moov atom not found",
+		"EBML header parsing failed",
+		"corrupt",
+		"missing picture in access unit",
+	}},
+	{FailureIO, []string{
+		"Input/output error",
+		"Permission denied",
+		"No such file or directory",
+		"Read-only file system",
+		"Stale file handle",
+		"Broken pipe",
+		"Error writing trailer",
+		"av_interleaved_write_frame()",
+	}},
+}
+
+// ClassifyFailure derives a failure category from ffmpeg's error output.
+func ClassifyFailure(output string) FailureCategory {
+	for _, group := range failurePatterns {
+		for _, p := range group.patterns {
+			if strings.Contains(output, p) {
+				return group.category
+			}
+		}
+	}
+	return FailureUnknown
+}
+
+// FailureCategoryOf derives a failure category from an error returned while
+// processing a job: a TranscodeError from ffmpeg, a VerifyError, or a
+// filesystem error.
+func FailureCategoryOf(err error) FailureCategory {
+	if err == nil {
+		return ""
+	}
+	var te *TranscodeError
+	if errors.As(err, &te) {
+		return te.Category
+	}
+	var ve *VerifyError
+	if errors.As(err, &ve) {
+		return FailureVerify
+	}
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return FailureDiskFull
+	}
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	if errors.As(err, &pathErr) || errors.As(err, &linkErr) {
+		return FailureIO
+	}
+	return ClassifyFailure(err.Error())
+}
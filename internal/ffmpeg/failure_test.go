@@ -0,0 +1,49 @@
+package ffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		output string
+		want   FailureCategory
+	}{
+		{"av_interleaved_write_frame(): No space left on device", FailureDiskFull},
+		{"[AVHWDeviceContext @ 0x1] Failed to initialise VAAPI connection: -1 (unknown libva error).", FailureGPUInit},
+		{"[hevc @ 0x1] Invalid NAL unit size (0 > 1234).", FailureDecode},
+		{"/media/x.mkv: Input/output error", FailureIO},
+		{"Conversion failed!", FailureUnknown},
+		{"", FailureUnknown},
+	}
+	for _, tt := range tests {
+		if got := ClassifyFailure(tt.output); got != tt.want {
+			t.Errorf("ClassifyFailure(%q) = %s, want %s", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestFailureCategoryOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want FailureCategory
+	}{
+		{"nil", nil, ""},
+		{"transcode", fmt.Errorf("job: %w", &TranscodeError{Category: FailureDecode}), FailureDecode},
+		{"enospc", &os.PathError{Op: "write", Path: "/media/x", Err: syscall.ENOSPC}, FailureDiskFull},
+		{"path", &os.PathError{Op: "open", Path: "/media/x", Err: syscall.EACCES}, FailureIO},
+		{"link", &os.LinkError{Op: "rename", Old: "a", New: "b", Err: syscall.EXDEV}, FailureIO},
+		{"text", errors.New("vaInitialize failed"), FailureGPUInit},
+		{"verify", fmt.Errorf("output verification failed: %w", &VerifyError{Problems: []string{"10-bit source came out as 8-bit"}}), FailureVerify},
+	}
+	for _, tt := range tests {
+		if got := FailureCategoryOf(tt.err); got != tt.want {
+			t.Errorf("%s: FailureCategoryOf = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a snapshot of a running encode, parsed from ffmpeg's -progress output.
+type Progress struct {
+	Frame   int64         `json:"frame"`
+	FPS     float64       `json:"fps"`
+	Speed   float64       `json:"speed"`       // encode speed relative to realtime, e.g. 2.5
+	OutTime time.Duration `json:"out_time_ns"` // position reached in the output
+	Percent float64       `json:"percent"`     // 0-100, or 0 if the input duration is unknown
+	ETA     time.Duration `json:"eta_ns"`      // remaining time at the current speed, or 0 if unknown
+	Done    bool          `json:"done"`
+}
+
+// progressWriter parses ffmpeg's key=value progress blocks as they are written
+// to stdout and reports each completed block.
+type progressWriter struct {
+	duration   time.Duration
+	onProgress func(Progress)
+	buf        bytes.Buffer
+	current    Progress
+}
+
+func newProgressWriter(duration time.Duration, onProgress func(Progress)) *progressWriter {
+	return &progressWriter{duration: duration, onProgress: onProgress}
+}
+
+// Write implements io.Writer.
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Incomplete line - keep it for the next write
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		w.parseLine(strings.TrimSpace(line))
+	}
+	return len(p), nil
+}
+
+// parseLine handles one key=value line. A "progress" key ends a block.
+func (w *progressWriter) parseLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+
+	switch key {
+	case "frame":
+		w.current.Frame, _ = strconv.ParseInt(value, 10, 64)
+	case "fps":
+		w.current.FPS, _ = strconv.ParseFloat(value, 64)
+	case "speed":
+		w.current.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+	case "out_time_us", "out_time_ms":
+		// Both are microseconds (out_time_ms is misnamed in ffmpeg)
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			w.current.OutTime = time.Duration(us) * time.Microsecond
+		}
+	case "progress":
+		w.current.Done = value == "end"
+		if w.duration > 0 {
+			w.current.Percent = float64(w.current.OutTime) / float64(w.duration) * 100
+			if w.current.Percent > 100 {
+				w.current.Percent = 100
+			}
+			if w.current.Speed > 0 {
+				remaining := w.duration - w.current.OutTime
+				w.current.ETA = time.Duration(float64(remaining) / w.current.Speed)
+			}
+		}
+		if w.current.Done {
+			w.current.Percent = 100
+			w.current.ETA = 0
+		}
+		w.onProgress(w.current)
+	}
+}
@@ -0,0 +1,154 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// TrackPolicy chooses the audio or subtitle tracks an encode keeps. The zero
+// value keeps every track.
+type TrackPolicy struct {
+	Keep           []string // keep only these languages, if the file has a track in one of them
+	Drop           []string // languages to remove otherwise
+	DropUntagged   bool     // remove tracks without a language tag, or tagged "und"
+	DropCommentary bool     // remove commentary tracks, found by title or disposition
+}
+
+// TrackDecision records whether one audio or subtitle track is kept, and why.
+type TrackDecision struct {
+	Index    int    // stream index in the source
+	Type     string // "audio" or "subtitle"
+	Language string // "" if untagged
+	Title    string
+	Keep     bool
+	Reason   string // e.g. "default track" or "language rus is dropped"
+}
+
+// String returns e.g. `audio #2 eng "Commentary": dropped, commentary`.
+func (d TrackDecision) String() string {
+	s := fmt.Sprintf("%s #%d", d.Type, d.Index)
+	if d.Language != "" {
+		s += " " + d.Language
+	}
+	if d.Title != "" {
+		s += fmt.Sprintf(" %q", d.Title)
+	}
+	verdict := "kept"
+	if !d.Keep {
+		verdict = "dropped"
+	}
+	return fmt.Sprintf("%s: %s, %s", s, verdict, d.Reason)
+}
+
+// SelectTracks applies the audio and subtitle policies to every track of a
+// file, in stream order. Default and forced tracks and original-language
+// audio are always kept, and a file with audio never loses all of it.
+func SelectTracks(probeResult *metadata.ProbeResult, audio, subtitles TrackPolicy) []TrackDecision {
+	decisions := selectTracks(probeResult, "audio", audio, true)
+	return append(decisions, selectTracks(probeResult, "subtitle", subtitles, false)...)
+}
+
+// selectTracks decides on the tracks of one type. keepOne keeps at least one
+// track.
+func selectTracks(probeResult *metadata.ProbeResult, codecType string, policy TrackPolicy, keepOne bool) []TrackDecision {
+	var streams []metadata.StreamInfo
+	for _, stream := range probeResult.Streams {
+		if stream.CodecType == codecType {
+			streams = append(streams, stream)
+		}
+	}
+
+	// The keep list only applies if the file has a track in one of its languages
+	keepList := false
+	for _, stream := range streams {
+		keepList = keepList || containsLanguage(policy.Keep, trackLanguage(stream))
+	}
+
+	decisions := make([]TrackDecision, 0, len(streams))
+	kept := 0
+	for _, stream := range streams {
+		d := TrackDecision{
+			Index:    stream.Index,
+			Type:     codecType,
+			Language: trackLanguage(stream),
+			Title:    stream.Tags["title"],
+		}
+		d.Keep, d.Reason = decideTrack(stream, d.Language, policy, keepList)
+		if d.Keep {
+			kept++
+		}
+		decisions = append(decisions, d)
+	}
+
+	if keepOne && kept == 0 && len(decisions) > 0 {
+		decisions[0].Keep = true
+		decisions[0].Reason = "kept so the output has " + codecType
+	}
+	return decisions
+}
+
+// decideTrack applies a policy to one track. Default and forced tracks, and
+// original-language audio, are kept whatever the policy says: players pick
+// them, and forced subtitles carry the dialogue not in the audio's language.
+func decideTrack(stream metadata.StreamInfo, lang string, policy TrackPolicy, keepList bool) (bool, string) {
+	switch {
+	case stream.Disposition["default"] == 1:
+		return true, "default track"
+	case stream.Disposition["forced"] == 1:
+		return true, "forced track"
+	case stream.CodecType == "audio" && stream.Disposition["original"] == 1:
+		return true, "original language"
+	case policy.DropCommentary && isCommentary(stream):
+		return false, "commentary"
+	case lang == "":
+		if policy.DropUntagged {
+			return false, "untagged"
+		}
+		return true, "untagged"
+	case keepList && containsLanguage(policy.Keep, lang):
+		return true, "language " + lang + " is kept"
+	case keepList:
+		return false, "language " + lang + " is not in the keep list"
+	case containsLanguage(policy.Drop, lang):
+		return false, "language " + lang + " is dropped"
+	}
+	return true, "language " + lang + " is not dropped"
+}
+
+// trackLanguage returns a track's language tag, or "" if it has none or it
+// is "und".
+func trackLanguage(stream metadata.StreamInfo) string {
+	lang := strings.ToLower(strings.TrimSpace(stream.Tags["language"]))
+	if lang == "und" {
+		return ""
+	}
+	return lang
+}
+
+// isCommentary reports whether a track is flagged or titled as commentary.
+func isCommentary(stream metadata.StreamInfo) bool {
+	return stream.Disposition["comment"] == 1 || strings.Contains(strings.ToLower(stream.Tags["title"]), "commentary")
+}
+
+// containsLanguage reports whether lang is in languages, ignoring case.
+func containsLanguage(languages []string, lang string) bool {
+	for _, l := range languages {
+		if lang != "" && strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackMaps returns the -map options for the kept tracks.
+func trackMaps(decisions []TrackDecision) []string {
+	var maps []string
+	for _, d := range decisions {
+		if d.Keep {
+			maps = append(maps, "-map", fmt.Sprintf("0:%d", d.Index))
+		}
+	}
+	return maps
+}
@@ -0,0 +1,171 @@
+package ffmpeg
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// track returns a stream of codecType with a language, title and
+// dispositions.
+func track(codecType, lang, title string, dispositions ...string) metadata.StreamInfo {
+	s := metadata.StreamInfo{CodecType: codecType, Tags: map[string]string{}, Disposition: map[string]int{}}
+	if lang != "" {
+		s.Tags["language"] = lang
+	}
+	if title != "" {
+		s.Tags["title"] = title
+	}
+	for _, d := range dispositions {
+		s.Disposition[d] = 1
+	}
+	return s
+}
+
+func TestSelectTracks(t *testing.T) {
+	russianOut := TrackPolicy{Drop: []string{"rus", "ru"}}
+	tests := []struct {
+		name      string
+		streams   []metadata.StreamInfo
+		audio     TrackPolicy
+		subtitles TrackPolicy
+		want      []string // decisions, in stream order
+	}{
+		{
+			name: "zero policy keeps everything",
+			streams: []metadata.StreamInfo{
+				track("video", "", ""),
+				track("audio", "eng", "", "default"),
+				track("audio", "rus", ""),
+				track("subtitle", "", ""),
+			},
+			want: []string{
+				"audio #1 eng: kept, default track",
+				"audio #2 rus: kept, language rus is not dropped",
+				"subtitle #3: kept, untagged",
+			},
+		},
+		{
+			name: "drop list",
+			streams: []metadata.StreamInfo{
+				track("audio", "eng", "", "default"),
+				track("audio", "RUS", ""),
+				track("audio", "und", ""),
+				track("subtitle", "ru", ""),
+				track("subtitle", "eng", ""),
+			},
+			audio:     russianOut,
+			subtitles: russianOut,
+			want: []string{
+				"audio #0 eng: kept, default track",
+				"audio #1 rus: dropped, language rus is dropped",
+				"audio #2: kept, untagged",
+				"subtitle #3 ru: dropped, language ru is dropped",
+				"subtitle #4 eng: kept, language eng is not dropped",
+			},
+		},
+		{
+			name: "keep list applies only if a track matches",
+			streams: []metadata.StreamInfo{
+				track("audio", "jpn", ""),
+				track("audio", "eng", ""),
+				track("subtitle", "fra", ""),
+				track("subtitle", "deu", ""),
+			},
+			audio:     TrackPolicy{Keep: []string{"ENG"}},
+			subtitles: TrackPolicy{Keep: []string{"eng"}, Drop: []string{"deu"}},
+			want: []string{
+				"audio #0 jpn: dropped, language jpn is not in the keep list",
+				"audio #1 eng: kept, language eng is kept",
+				"subtitle #2 fra: kept, language fra is not dropped",
+				"subtitle #3 deu: dropped, language deu is dropped",
+			},
+		},
+		{
+			name: "default, forced and original tracks are protected",
+			streams: []metadata.StreamInfo{
+				track("audio", "rus", "", "original"),
+				track("audio", "rus", "Commentary", "default"),
+				track("audio", "rus", ""),
+				track("subtitle", "rus", "Forced", "forced"),
+				track("subtitle", "rus", "", "default"),
+				track("subtitle", "rus", "", "original"),
+				track("subtitle", "rus", "Commentary", "comment", "forced"),
+			},
+			audio:     TrackPolicy{Drop: []string{"rus"}, DropCommentary: true},
+			subtitles: TrackPolicy{Keep: []string{"eng"}, Drop: []string{"rus"}, DropCommentary: true},
+			want: []string{
+				"audio #0 rus: kept, original language",
+				`audio #1 rus "Commentary": kept, default track`,
+				"audio #2 rus: dropped, language rus is dropped",
+				`subtitle #3 rus "Forced": kept, forced track`,
+				"subtitle #4 rus: kept, default track",
+				"subtitle #5 rus: dropped, language rus is dropped",
+				`subtitle #6 rus "Commentary": kept, forced track`,
+			},
+		},
+		{
+			name: "commentary and untagged",
+			streams: []metadata.StreamInfo{
+				track("audio", "eng", "", "default"),
+				track("audio", "eng", "Director's commentary"),
+				track("audio", "", "", "comment"),
+				track("subtitle", "", ""),
+				track("subtitle", "eng", "Commentary"),
+			},
+			audio:     TrackPolicy{DropCommentary: true, DropUntagged: true},
+			subtitles: TrackPolicy{DropUntagged: true},
+			want: []string{
+				"audio #0 eng: kept, default track",
+				`audio #1 eng "Director's commentary": dropped, commentary`,
+				"audio #2: dropped, commentary",
+				"subtitle #3: dropped, untagged",
+				`subtitle #4 eng "Commentary": kept, language eng is not dropped`,
+			},
+		},
+		{
+			name: "audio is never all dropped, subtitles may be",
+			streams: []metadata.StreamInfo{
+				track("audio", "rus", ""),
+				track("audio", "rus", ""),
+				track("subtitle", "rus", ""),
+			},
+			audio:     russianOut,
+			subtitles: russianOut,
+			want: []string{
+				"audio #0 rus: kept, kept so the output has audio",
+				"audio #1 rus: dropped, language rus is dropped",
+				"subtitle #2 rus: dropped, language rus is dropped",
+			},
+		},
+		{
+			name:    "no tracks",
+			streams: []metadata.StreamInfo{track("video", "", "")},
+			audio:   russianOut,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.streams {
+				tt.streams[i].Index = i
+			}
+			var got []string
+			for _, d := range SelectTracks(&metadata.ProbeResult{Streams: tt.streams}, tt.audio, tt.subtitles) {
+				got = append(got, d.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SelectTracks:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrackMaps(t *testing.T) {
+	decisions := []TrackDecision{{Index: 1, Keep: true}, {Index: 2}, {Index: 4, Keep: true}}
+	want := []string{"-map", "0:1", "-map", "0:4"}
+	if got := trackMaps(decisions); !reflect.DeepEqual(got, want) {
+		t.Errorf("trackMaps = %q, want %q", got, want)
+	}
+}
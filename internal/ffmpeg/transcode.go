@@ -2,58 +2,55 @@ package ffmpeg
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/yourname/av1qsvd/internal/metadata"
 )
 
-// TranscodeArgs builds ffmpeg command arguments for AV1 QSV transcoding.
+// EncodeSettings tunes one encode. The zero value keeps every audio and
+// subtitle track and uses the built-in quality table.
+type EncodeSettings struct {
+	Encoder          string      // encoder backend, "" = DefaultEncoder
+	StripDynamicHDR  bool        // drop Dolby Vision and HDR10+ metadata, keeping the HDR10 base layer
+	Quality          int         // global_quality, 0 = DetermineQuality by height
+	CompressionLevel int         // 0 = 2
+	ExtraArgs        []string    // extra output options, added before the output file
+	Audio            TrackPolicy // audio tracks to keep
+	Subtitles        TrackPolicy // subtitle tracks to keep
+}
+
+// TranscodeArgs builds ffmpeg command arguments for AV1 transcoding with the
+// encoder named in settings.
 // Returns a slice of command-line arguments ready to be passed to exec.Command.
-func TranscodeArgs(ffmpegPath, inputPath, outputPath string, probeResult *metadata.ProbeResult, isWebRipLike bool) ([]string, error) {
+// isWebRipLike adds the timestamp fixes for web sources.
+// device selects the render node to use; pass "" to let the encoder auto-detect it.
+func TranscodeArgs(ffmpegPath, inputPath, outputPath string, probeResult *metadata.ProbeResult, isWebRipLike bool, device string, settings EncodeSettings) ([]string, error) {
 	if probeResult.VideoStream == nil {
 		return nil, fmt.Errorf("no video stream found in probe result")
 	}
+	encoder, err := LookupEncoder(settings.Encoder)
+	if err != nil {
+		return nil, err
+	}
 
 	videoStream := probeResult.VideoStream
 	videoIndex := videoStream.Index
 
-	// Pure VAAPI approach for Intel Arc GPUs:
-	// - Use VAAPI for both decoding and AV1 encoding
-	// - Avoids QSV MFX session errors entirely
-	// - Intel Arc GPUs support AV1 encoding via VAAPI directly
-	log.Printf("Using pure VAAPI mode (decode + encode)")
-
-	// Find render node for VAAPI
-	renderNode := findRenderNode()
-	if renderNode == "" {
-		renderNode = "/dev/dri/renderD128" // fallback
-	}
-
 	// Build command arguments
-	// Use VAAPI for everything - no QSV needed
-	// Try auto-detection first, then fall back to explicit device
 	args := []string{
 		"-hide_banner",
 		"-analyzeduration", "50M",
 		"-probesize", "50M",
 	}
-	
-	// Try VAAPI initialization - use auto-detection first (vaapi=va)
-	// This lets VAAPI find the device automatically, which is more reliable
-	args = append(args, "-init_hw_device", "vaapi=va")
-	args = append(args,
-		"-hwaccel", "vaapi",
-		"-hwaccel_output_format", "vaapi",
-		"-filter_hw_device", "va",  // Use VAAPI for filters
-	)
-	
-	// Don't specify hwaccel_device - let VAAPI auto-detect
-	// Explicit device paths can cause "No VA display found" errors
+	args = append(args, encoder.InputArgs(device)...)
 
 	// WebRip-specific input flags
 	if isWebRipLike {
@@ -67,60 +64,38 @@ func TranscodeArgs(ffmpegPath, inputPath, outputPath string, probeResult *metada
 	// Input file
 	args = append(args, "-i", inputPath)
 
-	// Stream mapping: start with all streams, then prune
-	args = append(args,
-		"-map", "0",
-		"-map", "-0:v", // remove all video
-		"-map", "-0:t", // remove attachments
-		"-map", fmt.Sprintf("0:v:%d", videoIndex), // add only main video
-		"-map", "0:a?", // all audio
-		"-map", "-0:a:m:language:rus", // remove Russian audio
-		"-map", "-0:a:m:language:ru", // remove Russian audio (alternate code)
-		"-map", "0:s?", // all subtitles
-		"-map", "-0:s:m:language:rus", // remove Russian subtitles
-		"-map", "-0:s:m:language:ru", // remove Russian subtitles (alternate code)
-		"-map_chapters", "0",
-	)
-
-	// Determine quality based on height
-	quality := determineQuality(videoStream.Height)
+	// Stream mapping: the main video, then the audio and subtitle tracks the
+	// policies keep. Attachments and data streams (e.g. from .ts) are left
+	// out; Matroska can't hold the latter.
+	args = append(args, "-map", fmt.Sprintf("0:%d", videoIndex))
+	args = append(args, trackMaps(SelectTracks(probeResult, settings.Audio, settings.Subtitles))...)
+	args = append(args, "-map_chapters", "0")
 
-	// Video filter chain
-	// VAAPI decode outputs in vaapi format (hardware surfaces)
-	// Try to use VAAPI-native filters where possible to avoid format conversion issues
-	// For setsar, we need to download/upload, but we'll keep it simple
-	var vfParts []string
-	if isWebRipLike {
-		// WebRip: scale to handle SAR using VAAPI scaling, then ensure even dimensions
-		// Use scale_vaapi for hardware-accelerated scaling, then download/upload for setsar
-		vfParts = append(vfParts,
-			"scale_vaapi=w='if(gt(iw,iw*sar),iw,iw*sar)':h='if(gt(iw,iw*sar),iw/sar,ih)'",
-			"scale_vaapi=w=ceil(iw/2)*2:h=ceil(ih/2)*2",
-			"hwdownload,format=nv12",
-			"setsar=1",
-			"format=nv12",
-			"hwupload",
-		)
-	} else {
-		// Non-WebRip: ensure even dimensions using VAAPI, then set SAR
-		vfParts = append(vfParts,
-			"scale_vaapi=w=ceil(iw/2)*2:h=ceil(ih/2)*2",
-			"hwdownload,format=nv12",
-			"setsar=1",
-			"format=nv12",
-			"hwupload",
-		)
+	// Determine quality based on height, unless the profile set it
+	quality := settings.Quality
+	if quality == 0 {
+		quality = determineQuality(videoStream.Height)
+	}
+	compressionLevel := settings.CompressionLevel
+	if compressionLevel == 0 {
+		compressionLevel = 2
 	}
 
-	args = append(args, "-vf:v:0", fmt.Sprintf("%s", joinFilterParts(vfParts)))
-
-	// Video codec and encoding parameters
-	// Use av1_vaapi encoder (Intel Arc GPUs support AV1 via VAAPI)
-	args = append(args,
-		"-c:v:0", "av1_vaapi",
-		"-global_quality:v:0", fmt.Sprintf("%d", quality),
-		"-compression_level", "2",  // VAAPI equivalent of preset
-	)
+	// Video filter chain and encoder, keeping the source's bit depth, color
+	// description and HDR metadata
+	format := videoFormatOf(videoStream)
+	filters := encoder.Filters(isWebRipLike, format)
+	if settings.StripDynamicHDR {
+		filters = append(stripDynamicHDRFilters(), filters...)
+	}
+	args = append(args, "-vf:v:0", joinFilterParts(filters))
+	args = append(args, encoder.CodecArgs(quality, compressionLevel, format)...)
+	args = append(args, colorArgs(videoStream)...)
+	if settings.StripDynamicHDR {
+		// Drops any RPU and the Dolby Vision configuration record an
+		// encoder might still write from the decoder's side data
+		args = append(args, "-bsf:v:0", "dovi_rpu=strip=1")
+	}
 
 	// WebRip-specific output flags
 	if isWebRipLike {
@@ -143,6 +118,7 @@ func TranscodeArgs(ffmpegPath, inputPath, outputPath string, probeResult *metada
 		"-f", "matroska",
 		"-movflags", "+faststart",
 	)
+	args = append(args, settings.ExtraArgs...)
 
 	// Output file
 	args = append(args, outputPath)
@@ -190,17 +166,78 @@ func joinFilterParts(parts []string) string {
 	return result
 }
 
+// cancelGracePeriod is how long ffmpeg gets to exit after SIGTERM before it is killed.
+const cancelGracePeriod = 10 * time.Second
+
 // RunTranscode executes the ffmpeg transcode command and returns the exit code and any error.
-func RunTranscode(ffmpegPath string, args []string) (int, error) {
-	cmd := exec.Command(ffmpegPath, args...)
+// When ctx is cancelled, ffmpeg is sent SIGTERM so it can stop cleanly, and killed if it
+// hasn't exited within cancelGracePeriod. The returned error then wraps ctx.Err().
+func RunTranscode(ctx context.Context, ffmpegPath string, args []string) (int, error) {
+	return RunTranscodeWithOptions(ctx, ffmpegPath, args, RunOptions{})
+}
+
+// RunOptions are optional extras for RunTranscodeWithOptions.
+type RunOptions struct {
+	// OnProgress receives ffmpeg's machine-readable progress, roughly every 500ms.
+	OnProgress func(Progress)
+	// Duration is the input's length, used for the progress percentage and ETA.
+	// May be 0 if unknown.
+	Duration time.Duration
+	// OnStart is called with the ffmpeg process once it is running, e.g. to
+	// pause it with SIGSTOP later.
+	OnStart func(*os.Process)
+	// Nice sets ffmpeg's scheduling priority, 0 leaves it unchanged.
+	Nice int
+}
+
+// RunTranscodeWithOptions is RunTranscode with progress reporting and process control.
+func RunTranscodeWithOptions(ctx context.Context, ffmpegPath string, args []string, opts RunOptions) (int, error) {
+	if opts.OnProgress != nil {
+		args = append([]string{"-progress", "pipe:1", "-stats_period", "0.5", "-nostats"}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+	cmd.Cancel = func() error {
+		err := cmd.Process.Signal(syscall.SIGTERM)
+		// A paused ffmpeg only sees the SIGTERM once it runs again
+		cmd.Process.Signal(syscall.SIGCONT)
+		return err
+	}
+	cmd.WaitDelay = cancelGracePeriod
+	// Run ffmpeg in its own process group so a Ctrl+C on the daemon's terminal
+	// reaches the daemon only; the daemon decides when ffmpeg stops.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	// Set LD_LIBRARY_PATH to help static ffmpeg find dynamic VA-API libraries
 	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH=/lib/x86_64-linux-gnu:/usr/lib/x86_64-linux-gnu:"+os.Getenv("LD_LIBRARY_PATH"))
 
 	// Capture both stdout and stderr for logging
 	// Use stderr for better error visibility (ffmpeg outputs errors to stderr)
 	var stderr bytes.Buffer
+	var stdout bytes.Buffer
 	cmd.Stderr = &stderr
-	output, err := cmd.Output()
+	cmd.Stdout = &stdout
+	if opts.OnProgress != nil {
+		cmd.Stdout = newProgressWriter(opts.Duration, opts.OnProgress)
+	}
+
+	err := cmd.Start()
+	if err == nil {
+		if opts.Nice != 0 {
+			if err := syscall.Setpriority(syscall.PRIO_PROCESS, cmd.Process.Pid, opts.Nice); err != nil {
+				log.Printf("Warning: failed to set ffmpeg nice level %d: %v", opts.Nice, err)
+			}
+		}
+		if opts.OnStart != nil {
+			opts.OnStart(cmd.Process)
+		}
+		err = cmd.Wait()
+	}
+	output := stdout.Bytes()
+
+	if err != nil && ctx.Err() != nil {
+		log.Printf("ffmpeg stopped: %v", ctx.Err())
+		return -1, fmt.Errorf("ffmpeg cancelled: %w", ctx.Err())
+	}
 
 	if err != nil {
 		// Try to extract exit code
@@ -296,7 +333,11 @@ func RunTranscode(ffmpegPath string, args []string) (int, error) {
 				relevantError = relevantError[:800] + "..."
 			}
 			
-			return exitError.ExitCode(), fmt.Errorf("ffmpeg failed with exit code %d: %s", exitError.ExitCode(), relevantError)
+			return exitError.ExitCode(), &TranscodeError{
+				ExitCode: exitError.ExitCode(),
+				Category: ClassifyFailure(errOutput),
+				Summary:  relevantError,
+			}
 		}
 		errOutput := stderr.String()
 		if errOutput == "" {
@@ -314,44 +355,11 @@ func RunTranscode(ffmpegPath string, args []string) (int, error) {
 	return 0, nil
 }
 
-// findRenderNode finds the best DRI render node for VAAPI/QSV operations.
-func findRenderNode() string {
-	candidates := []string{
-		"/dev/dri/renderD128",
-		"/dev/dri/renderD129",
-		"/dev/dri/renderD130",
-	}
-	
-	for _, candidate := range candidates {
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate
-		}
-	}
-	
-	// If no specific render node found, try glob
-	if matches, err := filepath.Glob("/dev/dri/renderD*"); err == nil && len(matches) > 0 {
-		return matches[0]
-	}
-	
-	return ""
-}
-
-// selectVAAPIQSVDevices picks the best VAAPI/QSV device initialization for Intel Arc GPUs.
-// Returns VAAPI device init string, QSV device init string (derived from VAAPI), and filter device name.
-// For Intel Arc GPUs, initializing QSV via VAAPI is more reliable than direct QSV initialization.
-func selectVAAPIQSVDevices() (string, string, string) {
-	renderNode := findRenderNode()
-	
-	// For Intel Arc GPUs, use VAAPI->QSV initialization pattern:
-	// 1. Initialize VAAPI device first: vaapi=va:/dev/dri/renderD128
-	// 2. Derive QSV from VAAPI: qsv=qsv@va
-	// This is more reliable than direct QSV initialization
-	if renderNode != "" {
-		vaapiInit := fmt.Sprintf("vaapi=va:%s", renderNode)
-		qsvInit := "qsv=qsv@va"  // Derive QSV from VAAPI device named "va"
-		return vaapiInit, qsvInit, "qsv"
+// FindRenderNodes returns every DRI render node on the system.
+func FindRenderNodes() []string {
+	matches, err := filepath.Glob("/dev/dri/renderD*")
+	if err != nil {
+		return nil
 	}
-	
-	// Fallback: let ffmpeg auto-detect
-	return "vaapi=va", "qsv=qsv@va", "qsv"
+	return matches
 }
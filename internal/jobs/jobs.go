@@ -43,6 +43,19 @@ type Job struct {
 	VideoCodec    string     `json:"video_codec,omitempty"`
 	AudioStreams  int        `json:"audio_streams,omitempty"`
 	SubStreams    int        `json:"subtitle_streams,omitempty"`
+	Device        string     `json:"device,omitempty"`
+	Profile       string     `json:"profile,omitempty"`     // library profile the job is judged and encoded with
+	DynamicHDR    string     `json:"dynamic_hdr,omitempty"` // e.g. "Dolby Vision profile 8.1, HDR10+"; empty for other sources
+	HDRPolicy     string     `json:"hdr_policy,omitempty"`  // the profile's dynamic_hdr policy applied to it
+	Tracks        []string   `json:"tracks,omitempty"`      // audio and subtitle tracks kept and dropped, and why
+	Priority      int        `json:"priority,omitempty"`
+
+	// Retry state, see the daemon's retry policy
+	SourceModTime   time.Time  `json:"source_mtime"`              // mtime of the source when it was queued
+	Attempts        int        `json:"attempts,omitempty"`        // failed attempts so far
+	NextAttemptAt   *time.Time `json:"next_attempt_at,omitempty"` // a pending job waits until then
+	FailureCategory string     `json:"failure_category,omitempty"`
+	Parked          bool       `json:"parked,omitempty"` // failed too often, not retried until the file changes
 }
 
 // NewJob creates a new job with a generated ID and sets CreatedAt to now.
@@ -58,6 +71,8 @@ func NewJob(sourcePath string) *Job {
 
 // SaveJob saves a job to a JSON file in the jobs directory.
 // The filename will be <job_id>.json
+// The file is written to a temporary name and renamed into place, so readers
+// such as av1top never see a partially written job while workers update it.
 func SaveJob(job *Job, jobsDir string) error {
 	// Ensure jobs directory exists
 	if err := os.MkdirAll(jobsDir, 0755); err != nil {
@@ -71,10 +86,23 @@ func SaveJob(job *Job, jobsDir string) error {
 		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
-	if err := os.WriteFile(jobPath, data, 0644); err != nil {
+	tmpPath := filepath.Join(jobsDir, "."+job.ID+".json.tmp")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write job file: %w", err)
 	}
+	if err := os.Rename(tmpPath, jobPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+
+	return nil
+}
 
+// DeleteJob removes a job's JSON file from the jobs directory.
+func DeleteJob(id string, jobsDir string) error {
+	if err := os.Remove(filepath.Join(jobsDir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete job file: %w", err)
+	}
 	return nil
 }
 
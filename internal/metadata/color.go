@@ -0,0 +1,238 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Side data types, as ffprobe names them.
+const (
+	SideDataMasteringDisplay = "Mastering display metadata"
+	SideDataContentLight     = "Content light level metadata"
+	SideDataDolbyVision      = "DOVI configuration record"
+	SideDataHDR10Plus        = "HDR Dynamic Metadata SMPTE2094-40 (HDR10+)"
+)
+
+// SideData is one entry of ffprobe's side_data_list. Only the fields of the
+// types av1d reads are decoded.
+type SideData struct {
+	Type string `json:"side_data_type"`
+
+	// Mastering display metadata, as rationals such as "34000/50000"
+	RedX         string `json:"red_x,omitempty"`
+	RedY         string `json:"red_y,omitempty"`
+	GreenX       string `json:"green_x,omitempty"`
+	GreenY       string `json:"green_y,omitempty"`
+	BlueX        string `json:"blue_x,omitempty"`
+	BlueY        string `json:"blue_y,omitempty"`
+	WhitePointX  string `json:"white_point_x,omitempty"`
+	WhitePointY  string `json:"white_point_y,omitempty"`
+	MinLuminance string `json:"min_luminance,omitempty"`
+	MaxLuminance string `json:"max_luminance,omitempty"`
+
+	// Content light level metadata, in cd/m²
+	MaxContent FlexibleInt `json:"max_content,omitempty"`
+	MaxAverage FlexibleInt `json:"max_average,omitempty"`
+
+	// Dolby Vision configuration record
+	DVProfile         FlexibleInt `json:"dv_profile,omitempty"`
+	DVLevel           FlexibleInt `json:"dv_level,omitempty"`
+	RPUPresent        FlexibleInt `json:"rpu_present_flag,omitempty"`
+	ELPresent         FlexibleInt `json:"el_present_flag,omitempty"`
+	BLPresent         FlexibleInt `json:"bl_present_flag,omitempty"`
+	BLCompatibilityID FlexibleInt `json:"dv_bl_signal_compatibility_id,omitempty"`
+}
+
+// MasteringDisplay is the HDR10 mastering display colour volume (SMPTE ST
+// 2086): CIE 1931 xy chromaticities and luminance in cd/m².
+type MasteringDisplay struct {
+	Red, Green, Blue, WhitePoint [2]float64
+	MinLuminance, MaxLuminance   float64
+}
+
+// ContentLightLevel is the HDR10 content light level (CTA-861.3), in cd/m².
+type ContentLightLevel struct {
+	MaxCLL  int // brightest pixel
+	MaxFALL int // brightest frame average
+}
+
+// DolbyVision is a stream's Dolby Vision configuration record.
+type DolbyVision struct {
+	Profile int  // e.g. 5, 7 or 8
+	Level   int  // e.g. 6
+	RPU     bool // carries the dynamic metadata (RPU)
+	EL      bool // carries an enhancement layer (profile 7)
+	// BLCompatibilityID says what the base layer plays as without Dolby
+	// Vision: 1 is HDR10, 2 SDR, 4 HLG, 6 HDR10 (Blu-ray); 0 (profile 5) is
+	// not playable on its own.
+	BLCompatibilityID int
+}
+
+// String returns e.g. "Dolby Vision profile 8.1".
+func (dv *DolbyVision) String() string {
+	if dv.BLCompatibilityID == 0 || dv.Profile == 7 {
+		return fmt.Sprintf("Dolby Vision profile %d", dv.Profile)
+	}
+	return fmt.Sprintf("Dolby Vision profile %d.%d", dv.Profile, dv.BLCompatibilityID)
+}
+
+// HasHDR10Base reports whether the base layer plays as HDR10 on its own,
+// so the stream can be encoded without its Dolby Vision layer.
+func (dv *DolbyVision) HasHDR10Base() bool {
+	return dv.BLCompatibilityID == 1 || dv.BLCompatibilityID == 6
+}
+
+// Transfer characteristics of HDR video.
+const (
+	TransferPQ  = "smpte2084"    // HDR10, HDR10+ and Dolby Vision
+	TransferHLG = "arib-std-b67" // broadcast HDR
+)
+
+// IsHDR reports whether the stream uses the PQ or HLG transfer.
+func (s *StreamInfo) IsHDR() bool {
+	return s.ColorTransfer == TransferPQ || s.ColorTransfer == TransferHLG
+}
+
+// BitsPerSample returns the stream's bit depth, falling back to its pixel
+// format since ffprobe often leaves bits_per_raw_sample out for HEVC.
+func (s *StreamInfo) BitsPerSample() int {
+	if s.BitDepth > 0 {
+		return int(s.BitDepth)
+	}
+	switch {
+	case strings.Contains(s.PixFmt, "p10"), s.PixFmt == "p010le":
+		return 10
+	case strings.Contains(s.PixFmt, "p12"):
+		return 12
+	case s.PixFmt != "":
+		return 8
+	}
+	return 0
+}
+
+// MasteringDisplay returns the stream's mastering display metadata, or nil
+// if it has none.
+func (s *StreamInfo) MasteringDisplay() *MasteringDisplay {
+	for _, sd := range s.SideDataList {
+		if sd.Type != SideDataMasteringDisplay || sd.MaxLuminance == "" {
+			continue
+		}
+		return &MasteringDisplay{
+			Red:          [2]float64{rational(sd.RedX), rational(sd.RedY)},
+			Green:        [2]float64{rational(sd.GreenX), rational(sd.GreenY)},
+			Blue:         [2]float64{rational(sd.BlueX), rational(sd.BlueY)},
+			WhitePoint:   [2]float64{rational(sd.WhitePointX), rational(sd.WhitePointY)},
+			MinLuminance: rational(sd.MinLuminance),
+			MaxLuminance: rational(sd.MaxLuminance),
+		}
+	}
+	return nil
+}
+
+// ContentLightLevel returns the stream's content light level, or nil if it
+// has none.
+func (s *StreamInfo) ContentLightLevel() *ContentLightLevel {
+	for _, sd := range s.SideDataList {
+		if sd.Type == SideDataContentLight {
+			return &ContentLightLevel{MaxCLL: int(sd.MaxContent), MaxFALL: int(sd.MaxAverage)}
+		}
+	}
+	return nil
+}
+
+// DolbyVision returns the stream's Dolby Vision configuration, or nil if it
+// is not Dolby Vision.
+func (s *StreamInfo) DolbyVision() *DolbyVision {
+	for _, sd := range s.SideDataList {
+		if sd.Type == SideDataDolbyVision {
+			return &DolbyVision{
+				Profile:           int(sd.DVProfile),
+				Level:             int(sd.DVLevel),
+				RPU:               sd.RPUPresent != 0,
+				EL:                sd.ELPresent != 0,
+				BLCompatibilityID: int(sd.BLCompatibilityID),
+			}
+		}
+	}
+	return nil
+}
+
+// HasHDR10Plus reports whether the stream's first frame carries HDR10+
+// dynamic metadata.
+func (s *StreamInfo) HasHDR10Plus() bool {
+	for _, sd := range s.SideDataList {
+		if sd.Type == SideDataHDR10Plus {
+			return true
+		}
+	}
+	return false
+}
+
+// addSideData adds the side data entries of types the stream doesn't have
+// yet.
+func (s *StreamInfo) addSideData(list []SideData) {
+	have := make(map[string]bool)
+	for _, sd := range s.SideDataList {
+		have[sd.Type] = true
+	}
+	for _, sd := range list {
+		if !have[sd.Type] {
+			s.SideDataList = append(s.SideDataList, sd)
+			have[sd.Type] = true
+		}
+	}
+}
+
+// rational parses an ffprobe rational such as "34000/50000" or a plain
+// number, returning 0 if it is malformed.
+func rational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
+
+// probeFrameSideData returns the side data of the first frame of a stream.
+func probeFrameSideData(ffprobePath, filePath string, streamIndex int) ([]SideData, error) {
+	cmd := exec.Command(
+		ffprobePath,
+		"-hide_banner",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-select_streams", strconv.Itoa(streamIndex),
+		"-read_intervals", "%+#1",
+		"-show_entries", "frame=side_data_list",
+		filePath,
+	)
+	cmd.Env = append(os.Environ(), "LD_LIBRARY_PATH=/lib/x86_64-linux-gnu:/usr/lib/x86_64-linux-gnu:"+os.Getenv("LD_LIBRARY_PATH"))
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	var result struct {
+		Frames []struct {
+			SideDataList []SideData `json:"side_data_list"`
+		} `json:"frames"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe JSON: %w", err)
+	}
+	if len(result.Frames) == 0 {
+		return nil, nil
+	}
+	return result.Frames[0].SideDataList, nil
+}
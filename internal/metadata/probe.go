@@ -32,17 +32,43 @@ type FormatInfo struct {
 
 // StreamInfo contains stream-level metadata from ffprobe.
 type StreamInfo struct {
-	Index        int            `json:"index"`
-	CodecName    string         `json:"codec_name"`
-	CodecType    string         `json:"codec_type"`
-	Width        int            `json:"width"`
-	Height       int            `json:"height"`
-	AvgFrameRate string         `json:"avg_frame_rate"`
-	RFrameRate   string         `json:"r_frame_rate"`
-	BitDepth     FlexibleInt    `json:"bits_per_raw_sample,omitempty"`
-	BitRate      string         `json:"bit_rate,omitempty"`
-	Disposition  map[string]int `json:"disposition"`
-	Tags         map[string]string `json:"tags,omitempty"`
+	Index          int               `json:"index"`
+	CodecName      string            `json:"codec_name"`
+	CodecType      string            `json:"codec_type"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	AvgFrameRate   string            `json:"avg_frame_rate"`
+	RFrameRate     string            `json:"r_frame_rate"`
+	BitDepth       FlexibleInt       `json:"bits_per_raw_sample,omitempty"`
+	BitRate        string            `json:"bit_rate,omitempty"`
+	PixFmt         string            `json:"pix_fmt,omitempty"`         // e.g. "yuv420p10le"
+	ColorRange     string            `json:"color_range,omitempty"`     // "tv" (limited) or "pc" (full)
+	ColorPrimaries string            `json:"color_primaries,omitempty"` // e.g. "bt2020"
+	ColorTransfer  string            `json:"color_transfer,omitempty"`  // e.g. "smpte2084" (HDR10/PQ) or "arib-std-b67" (HLG)
+	ColorSpace     string            `json:"color_space,omitempty"`     // matrix coefficients, e.g. "bt2020nc"
+	FieldOrder     string            `json:"field_order,omitempty"`     // "progressive", or e.g. "tt" when interlaced
+	SideDataList   []SideData        `json:"side_data_list,omitempty"`  // stream side data, plus the first frame's for HDR video
+	Disposition    map[string]int    `json:"disposition"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// FrameRate returns the stream's average frame rate, parsed from ffprobe's
+// "24000/1001" form, or 0 if it is missing or malformed.
+func (s *StreamInfo) FrameRate() float64 {
+	rate := s.AvgFrameRate
+	den := 1.0
+	if n, d, ok := strings.Cut(rate, "/"); ok {
+		var err error
+		if den, err = strconv.ParseFloat(d, 64); err != nil || den <= 0 {
+			return 0
+		}
+		rate = n
+	}
+	fps, err := strconv.ParseFloat(rate, 64)
+	if err != nil || fps < 0 {
+		return 0
+	}
+	return fps / den
 }
 
 // FlexibleInt is a helper type that can unmarshal ints represented as numbers or strings.
@@ -195,6 +221,14 @@ func ProbeFile(ffmpegPath, filePath string) (*ProbeResult, error) {
 		}
 	}
 
+	// HEVC in Matroska often carries its HDR10 metadata only in the
+	// bitstream, and HDR10+ is always per frame, so add the first frame's
+	if v := result.VideoStream; v != nil && v.IsHDR() {
+		if sideData, err := probeFrameSideData(ffprobePath, filePath, v.Index); err == nil {
+			v.addSideData(sideData)
+		}
+	}
+
 	// Classify source using scored classifier
 	result.SourceDecision = ClassifyWebSource(probeFilePath, &result.Format, result.Streams)
 	// Maintain backward compatibility
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// ForJob builds the notification for a finished job.
+func ForJob(event string, job jobs.Job) Notification {
+	name := filepath.Base(job.SourcePath)
+	n := Notification{Event: event, Job: &job}
+
+	switch event {
+	case EventJobSuccess:
+		n.Title = "Encoded " + name
+		n.Message = fmt.Sprintf("%s: %s -> %s", job.SourcePath, formatBytes(job.OriginalSize), formatBytes(job.NewSize))
+		if job.OriginalSize > 0 {
+			n.Message += fmt.Sprintf(" (%.1f%% saved)", float64(job.OriginalSize-job.NewSize)/float64(job.OriginalSize)*100)
+		}
+		if job.StartedAt != nil && job.FinishedAt != nil {
+			n.Message += " in " + job.FinishedAt.Sub(*job.StartedAt).Round(time.Second).String()
+		}
+	case EventSizeGate:
+		n.Title = "Size gate rejected " + name
+		n.Message = fmt.Sprintf("%s: %s", job.SourcePath, job.Reason)
+	default:
+		n.Title = "Failed " + name
+		n.Message = fmt.Sprintf("%s: %s", job.SourcePath, job.Reason)
+	}
+	return n
+}
+
+// SelfTestFailed builds the notification for a failed ffmpeg self-test.
+func SelfTestFailed(err error) Notification {
+	host, _ := os.Hostname()
+	return Notification{
+		Event:   EventSelfTestFailed,
+		Title:   "av1d hardware self-test failed",
+		Message: fmt.Sprintf("ffmpeg self-test failed on %s: %v", host, err),
+	}
+}
+
+// buildRequest formats a notification for the target's service.
+func buildRequest(ctx context.Context, cfg config.NotifierConfig, n Notification) (*http.Request, error) {
+	var body []byte
+	var contentType string
+	var err error
+
+	switch cfg.Format {
+	case "ntfy":
+		// ntfy takes the message as the body and everything else as headers
+		body = []byte(n.Message)
+		contentType = "text/plain; charset=utf-8"
+	case "gotify":
+		body, err = json.Marshal(map[string]any{
+			"title":    n.Title,
+			"message":  n.Message,
+			"priority": priority(n.Event, 8, 5),
+			"extras": map[string]any{
+				"av1d::event": n.Event,
+			},
+		})
+		contentType = "application/json"
+	case "discord":
+		body, err = json.Marshal(map[string]any{
+			"username": "av1d",
+			"embeds": []map[string]any{{
+				"title":       truncate(n.Title, 256),
+				"description": truncate(n.Message, 4096),
+				"color":       color(n.Event),
+				"timestamp":   n.Time.Format(time.RFC3339),
+			}},
+		})
+		contentType = "application/json"
+	default:
+		body, err = json.Marshal(n)
+		contentType = "application/json"
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s notification: %w", n.Event, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", errors.Unwrap(err))
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	switch cfg.Format {
+	case "ntfy":
+		req.Header.Set("Title", n.Title)
+		req.Header.Set("Priority", fmt.Sprint(priority(n.Event, 4, 3)))
+		req.Header.Set("Tags", tag(n.Event))
+		if cfg.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+cfg.Token)
+		}
+	case "gotify":
+		if cfg.Token != "" {
+			req.Header.Set("X-Gotify-Key", cfg.Token)
+		}
+	}
+	return req, nil
+}
+
+// priority returns high for problems and normal for everything else.
+func priority(event string, high, normal int) int {
+	switch event {
+	case EventJobFailed, EventSelfTestFailed:
+		return high
+	}
+	return normal
+}
+
+// tag returns an ntfy emoji tag for an event.
+func tag(event string) string {
+	switch event {
+	case EventJobSuccess:
+		return "white_check_mark"
+	case EventJobFailed, EventSelfTestFailed:
+		return "x"
+	case EventSizeGate:
+		return "warning"
+	}
+	return "clapper"
+}
+
+// color returns a Discord embed color for an event.
+func color(event string) int {
+	switch event {
+	case EventJobSuccess:
+		return 0x2ecc71
+	case EventJobFailed, EventSelfTestFailed:
+		return 0xe74c3c
+	case EventSizeGate:
+		return 0xf1c40f
+	}
+	return 0x3498db
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-3])) + "..."
+}
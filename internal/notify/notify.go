@@ -0,0 +1,297 @@
+// Package notify sends webhook and push notifications about job outcomes.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/yourname/av1qsvd/internal/config"
+	"github.com/yourname/av1qsvd/internal/jobs"
+)
+
+// Event names, as used in NotifierConfig.Events.
+const (
+	EventJobSuccess     = "job_success"     // a job was encoded and replaced its source
+	EventJobFailed      = "job_failed"      // a job failed
+	EventSizeGate       = "size_gate"       // an encode was rejected by the size gate
+	EventSelfTestFailed = "selftest_failed" // the ffmpeg hardware self-test failed at startup
+)
+
+// sendTimeout bounds a single webhook request.
+const sendTimeout = 15 * time.Second
+
+// Notification is a single thing worth telling someone about.
+type Notification struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Job     *jobs.Job `json:"job,omitempty"`
+}
+
+// Manager fans notifications out to the configured targets.
+type Manager struct {
+	targets []*target
+}
+
+// target is one configured webhook with its own delivery goroutine.
+type target struct {
+	cfg      config.NotifierConfig
+	events   map[string]bool // nil = all events
+	tmpl     *template.Template
+	queue    chan Notification
+	client   *http.Client
+	digest   time.Duration
+	batch    []Notification
+	batchEnd time.Time
+}
+
+// New validates the notifier configs and creates a Manager.
+// A Manager without targets is valid and drops everything.
+func New(cfgs []config.NotifierConfig) (*Manager, error) {
+	m := &Manager{}
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("notifier %d", i+1)
+		}
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s: url is required", cfg.Name)
+		}
+		switch cfg.Format {
+		case "":
+			cfg.Format = "json"
+		case "json", "ntfy", "gotify", "discord":
+		default:
+			return nil, fmt.Errorf("%s: unknown format %q", cfg.Name, cfg.Format)
+		}
+
+		t := &target{
+			cfg:    cfg,
+			queue:  make(chan Notification, 100),
+			client: &http.Client{Timeout: sendTimeout},
+			digest: time.Duration(cfg.DigestSec) * time.Second,
+		}
+		if len(cfg.Events) > 0 {
+			t.events = make(map[string]bool)
+			for _, ev := range cfg.Events {
+				switch ev {
+				case EventJobSuccess, EventJobFailed, EventSizeGate, EventSelfTestFailed:
+					t.events[ev] = true
+				default:
+					return nil, fmt.Errorf("%s: unknown event %q", cfg.Name, ev)
+				}
+			}
+		}
+		if cfg.MessageTemplate != "" {
+			tmpl, err := template.New(cfg.Name).Parse(cfg.MessageTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid message_template: %w", cfg.Name, err)
+			}
+			t.tmpl = tmpl
+		}
+		m.targets = append(m.targets, t)
+	}
+	return m, nil
+}
+
+// Notify queues a notification for every target that wants its event.
+// It never blocks; if a target's queue is full the notification is dropped.
+// Notifications are delivered once Run is running.
+func (m *Manager) Notify(n Notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	for _, t := range m.targets {
+		if !t.wants(n.Event) {
+			continue
+		}
+		select {
+		case t.queue <- n:
+		default:
+			log.Printf("Notify %s: queue full, dropping %s notification", t.cfg.Name, n.Event)
+		}
+	}
+}
+
+// Deliver sends a notification to every target that wants it right away,
+// bypassing queues and digests. It is meant for startup problems, before or
+// instead of Run.
+func (m *Manager) Deliver(ctx context.Context, n Notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	for _, t := range m.targets {
+		if t.wants(n.Event) {
+			t.send(ctx, n)
+		}
+	}
+}
+
+// Run delivers queued notifications until ctx is cancelled. Pending digests
+// are sent before it returns.
+func (m *Manager) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for _, t := range m.targets {
+		go func() {
+			t.run(ctx)
+			done <- struct{}{}
+		}()
+	}
+	for range m.targets {
+		<-done
+	}
+}
+
+// wants reports whether the target is subscribed to an event.
+func (t *target) wants(event string) bool {
+	return t.events == nil || t.events[event]
+}
+
+// run is the target's delivery loop.
+func (t *target) run(ctx context.Context) {
+	var flush <-chan time.Time
+	var timer *time.Timer
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.drain()
+			t.flushDigest()
+			return
+		case n := <-t.queue:
+			if t.digest <= 0 || n.Event == EventSelfTestFailed {
+				t.send(context.Background(), n)
+				continue
+			}
+			t.batch = append(t.batch, n)
+			if timer == nil {
+				timer = time.NewTimer(t.digest)
+				flush = timer.C
+			}
+		case <-flush:
+			timer, flush = nil, nil
+			t.flushDigest()
+		}
+	}
+}
+
+// drain moves whatever is still queued into the digest, or sends it.
+func (t *target) drain() {
+	for {
+		select {
+		case n := <-t.queue:
+			if t.digest <= 0 || n.Event == EventSelfTestFailed {
+				t.send(context.Background(), n)
+			} else {
+				t.batch = append(t.batch, n)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// flushDigest sends the collected batch as one summary notification.
+func (t *target) flushDigest() {
+	if len(t.batch) == 0 {
+		return
+	}
+	batch := t.batch
+	t.batch = nil
+	if len(batch) == 1 {
+		t.send(context.Background(), batch[0])
+		return
+	}
+	t.send(context.Background(), Digest(batch))
+}
+
+// send formats and posts one notification, logging failures.
+func (t *target) send(ctx context.Context, n Notification) {
+	if t.tmpl != nil {
+		var buf bytes.Buffer
+		if err := t.tmpl.Execute(&buf, n); err != nil {
+			log.Printf("Notify %s: message_template failed: %v", t.cfg.Name, err)
+		} else {
+			n.Message = buf.String()
+		}
+	}
+
+	req, err := buildRequest(ctx, t.cfg, n)
+	if err != nil {
+		log.Printf("Notify %s: %v", t.cfg.Name, err)
+		return
+	}
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// The *url.Error quotes the URL, which may carry the notifier's token
+		log.Printf("Notify %s: failed to send %s notification: %v", t.cfg.Name, n.Event, errors.Unwrap(err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Notify %s: %s notification rejected: %s", t.cfg.Name, n.Event, resp.Status)
+	}
+}
+
+// Digest summarizes several notifications into one.
+func Digest(batch []Notification) Notification {
+	counts := make(map[string]int)
+	var saved int64
+	for _, n := range batch {
+		counts[n.Event]++
+		if n.Event == EventJobSuccess && n.Job != nil {
+			saved += n.Job.OriginalSize - n.Job.NewSize
+		}
+	}
+
+	var parts []string
+	if c := counts[EventJobSuccess]; c > 0 {
+		parts = append(parts, fmt.Sprintf("%d encoded (%s saved)", c, formatBytes(saved)))
+	}
+	if c := counts[EventJobFailed]; c > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", c))
+	}
+	if c := counts[EventSizeGate]; c > 0 {
+		parts = append(parts, fmt.Sprintf("%d rejected by size gate", c))
+	}
+
+	// List individual outcomes, capped so chat services accept the message
+	const maxLines = 20
+	var b strings.Builder
+	b.WriteString(strings.Join(parts, ", "))
+	for i, n := range batch {
+		if i == maxLines {
+			fmt.Fprintf(&b, "\n... and %d more", len(batch)-maxLines)
+			break
+		}
+		b.WriteString("\n- ")
+		b.WriteString(n.Title)
+	}
+
+	return Notification{
+		Event:   "digest",
+		Time:    time.Now(),
+		Title:   fmt.Sprintf("av1d: %d job updates", len(batch)),
+		Message: b.String(),
+	}
+}
+
+// formatBytes renders a byte count for humans.
+func formatBytes(n int64) string {
+	const gib = 1024 * 1024 * 1024
+	if n >= gib || n <= -gib {
+		return fmt.Sprintf("%.1f GB", float64(n)/gib)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
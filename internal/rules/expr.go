@@ -0,0 +1,530 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kind is the type of a value in an expression.
+type Kind int
+
+const (
+	Number Kind = iota
+	String
+	Bool
+	List
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Bool:
+		return "true/false"
+	default:
+		return "list"
+	}
+}
+
+// Value is a fact or the result of evaluating part of an expression.
+type Value struct {
+	Kind Kind
+	Num  float64
+	Str  string
+	Bool bool
+	List []Value
+}
+
+// Facts are the variables an expression is evaluated against, by name.
+type Facts map[string]Value
+
+// Expr is a compiled rule expression.
+//
+// The syntax is that of a boolean expression: comparisons with == != < <= >
+// >=, regular expression matches with =~ and !~, membership with in and not
+// in against a [list], combined with && (and), || (or), ! (not) and
+// parentheses. Words that are not variables are strings, so
+// codec in [h264, mpeg2video] needs no quotes. String comparisons with ==,
+// != and in ignore case. Durations such as 90m or 1h30m are numbers of
+// minutes, for duration_min.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression and checks its types against the known
+// variables.
+func Compile(source string) (*Expr, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at column %d", t.text, t.pos+1)
+	}
+	if root.kind() != Bool {
+		return nil, fmt.Errorf("expression is a %s, not a condition", root.kind())
+	}
+	return &Expr{source: source, root: root}, nil
+}
+
+// String returns the expression as written.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Match evaluates the expression. Missing facts take the zero value of their
+// kind.
+func (e *Expr) Match(facts Facts) bool {
+	return e.root.eval(facts).Bool
+}
+
+// Tokens
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokNumber
+	tokDuration
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+// lex splits an expression into tokens.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, s[i:j], i})
+			i = j
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(s) && unicode.IsDigit(rune(s[i+1]))):
+			j := i + 1
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			kind := tokNumber
+			// A unit makes it a duration, e.g. 90m or 1h30m
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				kind = tokDuration
+				j++
+			}
+			tokens = append(tokens, token{kind, s[i:j], i})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string at column %d", i+1)
+			}
+			tokens = append(tokens, token{tokString, s[i+1 : i+1+j], i})
+			i += j + 2
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of expression", pos: len(s)}), nil
+}
+
+// Parser
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+func (p *parser) next() token { t := p.tokens[p.pos]; p.pos++; return t }
+
+// accept consumes the next token if it is one of the given operators or
+// keywords.
+func (p *parser) accept(texts ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokWord {
+		return "", false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = logical("||", left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if left, err = logical("&&", left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) not() (node, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		if operand.kind() != Bool {
+			return nil, fmt.Errorf("cannot negate a %s", operand.kind())
+		}
+		return notNode{operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	negate := false
+	if t := p.peek(); t.kind == tokWord && t.text == "not" {
+		p.pos++
+		negate = true
+		if p.peek().text != "in" {
+			return nil, fmt.Errorf("expected in after not at column %d", p.peek().pos+1)
+		}
+	}
+	if _, ok := p.accept("in"); ok {
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		if right.kind() != List {
+			return nil, fmt.Errorf("in needs a [list], not a %s", right.kind())
+		}
+		if isConstant(left) {
+			return nil, fmt.Errorf("%s in [...] tests a constant, not a fact", describeNode(left))
+		}
+		var n node = inNode{left, right}
+		if err := checkList(left, right); err != nil {
+			return nil, err
+		}
+		if negate {
+			n = notNode{n}
+		}
+		return n, nil
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return compare(op, left, right)
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at column %d", t.text, t.pos+1)
+		}
+		return literal{Value{Kind: Number, Num: n}}, nil
+	case tokDuration:
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad duration %q at column %d, expected e.g. 90m or 1h30m", t.text, t.pos+1)
+		}
+		return literal{Value{Kind: Number, Num: d.Minutes()}}, nil
+	case tokString:
+		return literal{Value{Kind: String, Str: t.text}}, nil
+	case tokWord:
+		switch t.text {
+		case "true", "false":
+			return literal{Value{Kind: Bool, Bool: t.text == "true"}}, nil
+		}
+		if kind, ok := Variables[t.text]; ok {
+			return variable{t.text, kind.Kind}, nil
+		}
+		// Bare words are strings, e.g. h264 or DiscLike
+		return literal{Value{Kind: String, Str: t.text}}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			n, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing ) for ( at column %d", t.pos+1)
+			}
+			return n, nil
+		case "[":
+			var items []Value
+			for {
+				if _, ok := p.accept("]"); ok {
+					return literal{Value{Kind: List, List: items}}, nil
+				}
+				if len(items) > 0 {
+					if _, ok := p.accept(","); !ok {
+						return nil, fmt.Errorf("expected , or ] at column %d", p.peek().pos+1)
+					}
+				}
+				item, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+				lit, ok := item.(literal)
+				if !ok || lit.v.Kind == List {
+					return nil, fmt.Errorf("lists may only hold numbers and words (column %d)", t.pos+1)
+				}
+				items = append(items, lit.v)
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at column %d", describe(t), t.pos+1)
+}
+
+func describe(t token) string {
+	if t.kind == tokEOF {
+		return t.text
+	}
+	return strconv.Quote(t.text)
+}
+
+// Type checks
+
+func logical(op string, left, right node) (node, error) {
+	if left.kind() != Bool || right.kind() != Bool {
+		return nil, fmt.Errorf("%s needs conditions on both sides, got %s and %s", op, left.kind(), right.kind())
+	}
+	return logicalNode{op, left, right}, nil
+}
+
+func compare(op string, left, right node) (node, error) {
+	if op == "=~" || op == "!~" {
+		lit, ok := right.(literal)
+		if left.kind() != String || !ok || lit.v.Kind != String {
+			return nil, fmt.Errorf("%s needs a string on the left and a quoted regular expression on the right", op)
+		}
+		if isConstant(left) {
+			return nil, fmt.Errorf("%s %s tests a constant, not a fact", describeNode(left), op)
+		}
+		re, err := regexp.Compile(lit.v.Str)
+		if err != nil {
+			return nil, err
+		}
+		return matchNode{left, re, op == "!~"}, nil
+	}
+
+	if left.kind() != right.kind() {
+		return nil, fmt.Errorf("cannot compare %s with %s (%s)", describeNode(left), describeNode(right), op)
+	}
+	if isConstant(left) && isConstant(right) {
+		return nil, fmt.Errorf("%s %s %s compares two constants, not a fact", describeNode(left), op, describeNode(right))
+	}
+	if (op != "==" && op != "!=") && left.kind() != Number {
+		return nil, fmt.Errorf("%s only compares numbers, not %s", op, describeNode(left))
+	}
+	return compareNode{op, left, right}, nil
+}
+
+func checkList(left, right node) error {
+	for _, item := range right.(literal).v.List {
+		if item.Kind != left.kind() {
+			return fmt.Errorf("cannot look for %s in a list holding a %s", describeNode(left), item.Kind)
+		}
+	}
+	return nil
+}
+
+// isConstant reports whether an operand is a literal, which in a comparison
+// usually means a misspelled variable.
+func isConstant(n node) bool {
+	_, ok := n.(literal)
+	return ok
+}
+
+// describeNode names an operand for type errors. A word that is meant as a
+// variable but misspelled shows up as a string here.
+func describeNode(n node) string {
+	switch n := n.(type) {
+	case variable:
+		return fmt.Sprintf("%s (a %s)", n.name, n.k)
+	case literal:
+		if n.v.Kind == String {
+			return fmt.Sprintf("%q (a string; not a known variable)", n.v.Str)
+		}
+	}
+	return "a " + n.kind().String()
+}
+
+// Evaluation
+
+type node interface {
+	kind() Kind
+	eval(Facts) Value
+}
+
+type literal struct{ v Value }
+
+func (n literal) kind() Kind       { return n.v.Kind }
+func (n literal) eval(Facts) Value { return n.v }
+
+type variable struct {
+	name string
+	k    Kind
+}
+
+func (n variable) kind() Kind { return n.k }
+func (n variable) eval(f Facts) Value {
+	if v, ok := f[n.name]; ok {
+		return v
+	}
+	return Value{Kind: n.k}
+}
+
+type notNode struct{ operand node }
+
+func (n notNode) kind() Kind         { return Bool }
+func (n notNode) eval(f Facts) Value { return boolValue(!n.operand.eval(f).Bool) }
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n logicalNode) kind() Kind { return Bool }
+func (n logicalNode) eval(f Facts) Value {
+	if n.op == "&&" {
+		return boolValue(n.left.eval(f).Bool && n.right.eval(f).Bool)
+	}
+	return boolValue(n.left.eval(f).Bool || n.right.eval(f).Bool)
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) kind() Kind { return Bool }
+func (n compareNode) eval(f Facts) Value {
+	l, r := n.left.eval(f), n.right.eval(f)
+	switch n.op {
+	case "==":
+		return boolValue(equal(l, r))
+	case "!=":
+		return boolValue(!equal(l, r))
+	case "<":
+		return boolValue(l.Num < r.Num)
+	case "<=":
+		return boolValue(l.Num <= r.Num)
+	case ">":
+		return boolValue(l.Num > r.Num)
+	default:
+		return boolValue(l.Num >= r.Num)
+	}
+}
+
+type inNode struct{ left, right node }
+
+func (n inNode) kind() Kind { return Bool }
+func (n inNode) eval(f Facts) Value {
+	l := n.left.eval(f)
+	for _, item := range n.right.eval(f).List {
+		if equal(l, item) {
+			return boolValue(true)
+		}
+	}
+	return boolValue(false)
+}
+
+type matchNode struct {
+	left   node
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n matchNode) kind() Kind { return Bool }
+func (n matchNode) eval(f Facts) Value {
+	return boolValue(n.re.MatchString(n.left.eval(f).Str) != n.negate)
+}
+
+func equal(a, b Value) bool {
+	switch a.Kind {
+	case Number:
+		return a.Num == b.Num
+	case String:
+		return strings.EqualFold(a.Str, b.Str)
+	default:
+		return a.Bool == b.Bool
+	}
+}
+
+func boolValue(b bool) Value {
+	return Value{Kind: Bool, Bool: b}
+}
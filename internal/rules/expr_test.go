@@ -0,0 +1,150 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+// film is a 4K HDR10 HEVC remux of 100 minutes.
+var film = Facts{
+	"codec":        str("hevc"),
+	"height":       num(2160),
+	"fps":          num(23.976),
+	"bitrate_kbps": num(45000),
+	"duration_min": num(100),
+	"hdr":          boolValue(true),
+	"interlaced":   boolValue(false),
+	"web_rip":      boolValue(false),
+	"source_class": str("DiscLike"),
+	"path":         str("/media/movies/Film (2020)/Film.mkv"),
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Precedence: ! over comparisons over && over ||
+		{"hdr || interlaced && web_rip", true},
+		{"(hdr || interlaced) && web_rip", false},
+		{"web_rip && interlaced || hdr", true},
+		{"web_rip && (interlaced || hdr)", false},
+		{"!hdr || height >= 2160", true},
+		{"!hdr && height >= 2160", false},
+		{"!(hdr && web_rip)", true},
+		{"not hdr or web_rip", false},
+		{"not not hdr", true},
+		{"hdr and not web_rip and height > 1080", true},
+
+		// Numbers
+		{"height >= 2160", true},
+		{"height > 2160", false},
+		{"fps < 24", true},
+		{"fps > 23.97", true},
+		{"bitrate_kbps != 45000", false},
+		{"height > -1", true},
+
+		// Strings: bare words, quotes, case
+		{"codec == hevc", true},
+		{"codec == HEVC", true},
+		{`codec == "hevc"`, true},
+		{"codec == 'h264'", false},
+		{"codec != h264", true},
+		{"source_class == DiscLike", true},
+		{`path == "/media/movies/Film (2020)/Film.mkv"`, true},
+
+		// Durations are minutes
+		{"duration_min > 90m", true},
+		{"duration_min > 1h30m", true},
+		{"duration_min >= 1h40m", true},
+		{"duration_min > 2h", false},
+		{"duration_min < 6000s", false},
+
+		// Lists
+		{"codec in [h264, hevc]", true},
+		{"codec in [H264, HEVC]", true},
+		{"codec in [h264, mpeg2video]", false},
+		{"codec not in [h264, mpeg2video]", true},
+		{"codec not in [hevc]", false},
+		{"height in [1080, 2160]", true},
+		{"height in []", false},
+		{"!(codec in [hevc])", false},
+
+		// Regular expressions
+		{`path =~ '\(20[0-9]{2}\)'`, true},
+		{`path =~ "(?i)sample"`, false},
+		{`path !~ "(?i)sample"`, true},
+
+		// Missing facts take the zero value of their kind
+		{"width == 0", true},
+		{`pix_fmt == ""`, true},
+		{"dolby_vision", false},
+		{"!dolby_vision", true},
+	}
+	for _, tt := range tests {
+		expr, err := Compile(tt.expr)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Match(film); got != tt.want {
+			t.Errorf("%q = %t, want %t", tt.expr, got, tt.want)
+		}
+		if expr.String() != tt.expr {
+			t.Errorf("String() = %q, want %q", expr.String(), tt.expr)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		// Syntax, with the column at fault
+		{"", "unexpected end of expression at column 1"},
+		{"height >", "unexpected end of expression at column 9"},
+		{"height > 1080 &&", "unexpected end of expression at column 17"},
+		{"height > 1080 )", `unexpected ")" at column 15`},
+		{"(height > 1080", "missing ) for ( at column 1"},
+		{"codec == 'hevc", "unterminated string at column 10"},
+		{"height @ 1080", `unexpected '@' at column 8`},
+		{"height > 10.8.0", `bad number "10.8.0" at column 10`},
+		{"duration_min > 90x", `bad duration "90x" at column 16`},
+		{"codec in [h264 hevc]", "expected , or ] at column 16"},
+		{"codec in [h264, [hevc]]", "lists may only hold numbers and words"},
+		{"codec not h264", "expected in after not at column 11"},
+		{"height > 1080 == true", `unexpected "==" at column 15`}, // comparisons don't chain
+
+		// Types
+		{"height", "expression is a number, not a condition"},
+		{"codec", "expression is a string, not a condition"},
+		{"height > hevc", `cannot compare height (a number) with "hevc"`},
+		{"codec < hevc", "< only compares numbers"},
+		{"hdr && height", "&& needs conditions on both sides, got true/false and number"},
+		{"!codec", "cannot negate a string"},
+		{"codec in hevc", "in needs a [list], not a string"},
+		{"height in [1080, uhd]", "cannot look for height (a number) in a list holding a string"},
+		{"height =~ '1080'", "=~ needs a string on the left"},
+		{"codec =~ hevc_re", ""}, // a bare word is a string, and a valid expression
+		{"codec =~ '('", "error parsing regexp"},
+
+		// Unknown facts are words, caught when they can't be what is meant
+		{"heigth > 1080", `cannot compare "heigth" (a string; not a known variable) with a number`},
+		{"codce == hevc", "compares two constants"},
+		{"codce in [h264, hevc]", "tests a constant"},
+		{"pth =~ 'sample'", "tests a constant"},
+		{"1 < 2", "compares two constants"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("Compile(%q): %v", tt.expr, err)
+		case tt.err != "" && err == nil:
+			t.Errorf("Compile(%q) succeeded, want error %q", tt.expr, tt.err)
+		case err != nil && !strings.Contains(err.Error(), tt.err):
+			t.Errorf("Compile(%q) error = %q, want it to contain %q", tt.expr, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yourname/av1qsvd/internal/metadata"
+)
+
+// Variable describes a fact rules can test.
+type Variable struct {
+	Kind Kind
+	Help string
+}
+
+// Variables are the facts known about every probed file, by name.
+var Variables = map[string]Variable{
+	"codec":              {String, "video codec, e.g. h264, hevc, mpeg2video, vc1"},
+	"width":              {Number, "video width in pixels"},
+	"height":             {Number, "video height in pixels"},
+	"fps":                {Number, "average frame rate"},
+	"bit_depth":          {Number, "bits per sample, e.g. 8 or 10; 0 if unknown"},
+	"pix_fmt":            {String, "pixel format, e.g. yuv420p10le"},
+	"hdr":                {Bool, "PQ (HDR10) or HLG transfer"},
+	"dolby_vision":       {Bool, "has a Dolby Vision configuration record"},
+	"dv_profile":         {Number, "Dolby Vision profile, e.g. 5, 7 or 8; 0 if not Dolby Vision"},
+	"hdr10plus":          {Bool, "has HDR10+ dynamic metadata"},
+	"interlaced":         {Bool, "interlaced video"},
+	"bitrate_kbps":       {Number, "overall bitrate"},
+	"video_bitrate_kbps": {Number, "video stream bitrate; 0 if the container doesn't say"},
+	"duration_min":       {Number, "length in minutes"},
+	"size_gb":            {Number, "file size in GiB"},
+	"audio_streams":      {Number, "number of audio tracks"},
+	"subtitle_streams":   {Number, "number of subtitle tracks"},
+	"container":          {String, "container format as ffprobe names it, e.g. matroska,webm"},
+	"source_class":       {String, "DiscLike, WebLike or Unknown"},
+	"web_rip":            {Bool, "classified as a web source"},
+	"path":               {String, "full path of the file"},
+	"ext":                {String, "file extension, e.g. .mkv"},
+	"profile":            {String, "profile of the file's library"},
+}
+
+// FactsFor gathers the facts about a probed file.
+func FactsFor(probeResult *metadata.ProbeResult, path string, size int64, profile string) Facts {
+	f := Facts{
+		"path":         str(path),
+		"ext":          str(strings.ToLower(filepath.Ext(path))),
+		"profile":      str(profile),
+		"size_gb":      num(float64(size) / (1024 * 1024 * 1024)),
+		"container":    str(probeResult.Format.FormatName),
+		"bitrate_kbps": num(parseFloat(probeResult.Format.BitRate) / 1000),
+		"duration_min": num(parseFloat(probeResult.Format.Duration) / 60),
+		"source_class": str(metadata.SourceUnknown.String()),
+		"web_rip":      boolValue(probeResult.IsWebRipLike),
+	}
+	if d := probeResult.SourceDecision; d != nil {
+		f["source_class"] = str(d.Class.String())
+	}
+
+	audio, subs := 0, 0
+	for _, stream := range probeResult.Streams {
+		switch stream.CodecType {
+		case "audio":
+			audio++
+		case "subtitle":
+			subs++
+		}
+	}
+	f["audio_streams"] = num(float64(audio))
+	f["subtitle_streams"] = num(float64(subs))
+
+	if v := probeResult.VideoStream; v != nil {
+		f["codec"] = str(v.CodecName)
+		f["width"] = num(float64(v.Width))
+		f["height"] = num(float64(v.Height))
+		f["fps"] = num(v.FrameRate())
+		f["bit_depth"] = num(float64(v.BitsPerSample()))
+		f["pix_fmt"] = str(v.PixFmt)
+		f["hdr"] = boolValue(v.IsHDR())
+		dv := v.DolbyVision()
+		f["dolby_vision"] = boolValue(dv != nil)
+		f["dv_profile"] = num(0)
+		if dv != nil {
+			f["dv_profile"] = num(float64(dv.Profile))
+		}
+		f["hdr10plus"] = boolValue(v.HasHDR10Plus())
+		f["interlaced"] = boolValue(v.FieldOrder != "" && v.FieldOrder != "progressive" && v.FieldOrder != "unknown")
+		f["video_bitrate_kbps"] = num(parseFloat(v.BitRate) / 1000)
+	}
+	return f
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func num(f float64) Value { return Value{Kind: Number, Num: f} }
+func str(s string) Value  { return Value{Kind: String, Str: s} }
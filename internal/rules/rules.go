@@ -0,0 +1,78 @@
+// Package rules decides which files to transcode from configurable
+// expressions over their probed metadata.
+package rules
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yourname/av1qsvd/internal/config"
+)
+
+// Decision is the outcome of the first rule that matched a file.
+type Decision struct {
+	Rule    string // rule name
+	Action  string // config.RuleAccept, config.RuleSkip or config.RuleProfile
+	Profile string // for config.RuleProfile
+	Reason  string // for the why file
+}
+
+// Set is a compiled, ordered list of rules.
+type Set struct {
+	rules []rule
+}
+
+type rule struct {
+	config.RuleConfig
+	expr *Expr
+}
+
+// New compiles the configured rules. All problems are reported at once.
+func New(configs []config.RuleConfig) (*Set, error) {
+	s := &Set{}
+	var errs []error
+	for i, rc := range configs {
+		expr, err := Compile(rc.When)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d].when: %w", i, err))
+			continue
+		}
+		if rc.Name == "" {
+			rc.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		s.rules = append(s.rules, rule{rc, expr})
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Len returns the number of rules.
+func (s *Set) Len() int {
+	return len(s.rules)
+}
+
+// Decide returns the decision of the first rule matching the facts, or false
+// if none matches.
+func (s *Set) Decide(facts Facts) (Decision, bool) {
+	for _, r := range s.rules {
+		if !r.expr.Match(facts) {
+			continue
+		}
+		reason := r.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("%s: %s", r.Name, r.expr)
+		}
+		switch r.Action {
+		case config.RuleSkip:
+			reason = "skipped by rule " + reason
+		case config.RuleProfile:
+			reason = fmt.Sprintf("profile %s chosen by rule %s", r.Profile, reason)
+		default:
+			reason = "accepted by rule " + reason
+		}
+		return Decision{Rule: r.Name, Action: r.Action, Profile: r.Profile, Reason: reason}, true
+	}
+	return Decision{}, false
+}
@@ -3,31 +3,111 @@ package scan
 import (
 	"fmt"
 	"os"
+	"sync"
+	"syscall"
 	"time"
 )
 
-// CheckFileStable checks if a file's size is stable (not currently being copied).
-// It checks the size at t0, waits for waitSeconds, then checks again.
-// If the size changed, returns false (file is still copying).
-// If size is stable, returns true.
-func CheckFileStable(filePath string, waitSeconds int) (bool, error) {
-	// Get initial size
-	info0, err := os.Stat(filePath)
-	if err != nil {
-		return false, fmt.Errorf("failed to stat file: %w", err)
+// StabilityTracker decides when a file has finished being written (copied,
+// downloaded, remuxed) without blocking the caller.
+//
+// Every scan or watcher event reports what a file looks like now. The tracker
+// remembers its size, mtime and inode, and when any of them last changed. A
+// file is stable once it has looked the same for the quiet period.
+type StabilityTracker struct {
+	mu    sync.Mutex
+	quiet time.Duration
+	files map[string]fileState
+}
+
+// fileState is the last observed version of a file.
+type fileState struct {
+	size    int64
+	modTime time.Time
+	inode   uint64
+	since   time.Time // when this version was first seen
+}
+
+// NewStabilityTracker creates a tracker with the given quiet period.
+func NewStabilityTracker(quiet time.Duration) *StabilityTracker {
+	return &StabilityTracker{
+		quiet: quiet,
+		files: make(map[string]fileState),
 	}
-	size0 := info0.Size()
+}
 
-	// Wait
-	time.Sleep(time.Duration(waitSeconds) * time.Second)
+// QuietPeriod returns how long a file must stay unchanged to be stable.
+func (t *StabilityTracker) QuietPeriod() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.quiet
+}
+
+// SetQuietPeriod changes the quiet period. Files already being tracked are
+// judged against the new period from now on.
+func (t *StabilityTracker) SetQuietPeriod(quiet time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.quiet = quiet
+}
+
+// Observe records the current state of a file and reports whether it has
+// been unchanged for the quiet period. If not, wait is how much longer it
+// needs to stay unchanged.
+//
+// A file seen for the first time counts as unchanged since its mtime, so an
+// existing library is stable at once while a file being written is not.
+func (t *StabilityTracker) Observe(path string, info os.FileInfo) (stable bool, wait time.Duration) {
+	now := time.Now()
+	cur := fileState{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		inode:   inode(info),
+	}
 
-	// Get size again
-	info1, err := os.Stat(filePath)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prev, ok := t.files[path]
+	switch {
+	case ok && prev.size == cur.size && prev.modTime.Equal(cur.modTime) && prev.inode == cur.inode:
+		cur.since = prev.since
+	case !ok && cur.modTime.Before(now):
+		cur.since = cur.modTime
+	default:
+		cur.since = now
+	}
+	t.files[path] = cur
+
+	if quiet := now.Sub(cur.since); quiet < t.quiet {
+		return false, t.quiet - quiet
+	}
+	return true, 0
+}
+
+// Check stats a file and observes it. See Observe.
+func (t *StabilityTracker) Check(path string) (stable bool, wait time.Duration, err error) {
+	info, err := os.Stat(path)
 	if err != nil {
-		return false, fmt.Errorf("failed to stat file after wait: %w", err)
+		t.Forget(path)
+		return false, 0, fmt.Errorf("failed to stat file: %w", err)
 	}
-	size1 := info1.Size()
+	stable, wait = t.Observe(path, info)
+	return stable, wait, nil
+}
 
-	// File is stable if sizes match
-	return size0 == size1, nil
+// Forget drops what the tracker knows about a path, e.g. after it was deleted.
+func (t *StabilityTracker) Forget(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.files, path)
+}
+
+// inode returns the inode number of a file, or 0 if the platform doesn't
+// expose one. A replaced file (new inode, same size) counts as changed.
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+	return 0
 }
@@ -0,0 +1,86 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to path and sets its mtime.
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStabilityTrackerCheck(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	tracker := NewStabilityTracker(time.Hour)
+
+	check := func(path string, wantStable bool) {
+		t.Helper()
+		stable, wait, err := tracker.Check(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stable != wantStable {
+			t.Fatalf("Check(%s) stable = %t, want %t", filepath.Base(path), stable, wantStable)
+		}
+		if stable && wait != 0 || !stable && (wait <= 0 || wait > tracker.QuietPeriod()) {
+			t.Errorf("Check(%s) wait = %v", filepath.Base(path), wait)
+		}
+	}
+
+	// A file already in the library is stable the first time it is seen
+	library := filepath.Join(dir, "library.mkv")
+	writeFile(t, library, "finished", old)
+	check(library, true)
+	check(library, true)
+
+	// A file being written is not, nor is one whose mtime is in the future
+	copying := filepath.Join(dir, "copying.mkv")
+	writeFile(t, copying, "part", time.Now())
+	check(copying, false)
+	future := filepath.Join(dir, "future.mkv")
+	writeFile(t, future, "clock skew", time.Now().Add(time.Hour))
+	check(future, false)
+
+	// Growing, even with the mtime kept, starts the quiet period over
+	writeFile(t, library, "finished, then appended to", old)
+	check(library, false)
+
+	// So does a file replaced by one of the same size and mtime
+	replaced := filepath.Join(dir, "replaced.mkv")
+	writeFile(t, replaced, "version 1", old)
+	check(replaced, true)
+	tmp := filepath.Join(dir, "replaced.tmp")
+	writeFile(t, tmp, "version 2", old)
+	if err := os.Rename(tmp, replaced); err != nil {
+		t.Fatal(err)
+	}
+	check(replaced, false)
+
+	// An unchanged file becomes stable once the quiet period has passed
+	tracker.SetQuietPeriod(20 * time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	check(copying, true)
+	check(library, true)
+
+	// A deleted file is an error and forgotten, so a new file of that
+	// name is judged afresh
+	tracker.SetQuietPeriod(time.Hour)
+	if err := os.Remove(copying); err != nil {
+		t.Fatal(err)
+	}
+	if stable, _, err := tracker.Check(copying); err == nil || stable {
+		t.Fatalf("Check of a deleted file = %t, %v", stable, err)
+	}
+	writeFile(t, copying, "part", old)
+	check(copying, true)
+}
@@ -0,0 +1,184 @@
+package sysmon
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procDir is where the kernel exposes processes.
+const procDir = "/proc"
+
+// EngineTime is how busy one GPU engine has kept a DRM client, as
+// cumulative counters. Drivers such as i915 and amdgpu report busy
+// nanoseconds and leave Total at 0; xe reports GPU cycles, with Total the
+// cycles elapsed on the engine.
+type EngineTime struct {
+	Busy  uint64
+	Total uint64
+}
+
+// DRMClient is one open GPU context, from the drm-* keys of
+// /proc/<pid>/fdinfo (see the kernel's drm-usage-stats).
+type DRMClient struct {
+	PID     int
+	ID      string                // drm-pdev and drm-client-id, unique per context
+	Engines map[string]EngineTime // by engine, e.g. "render", "video", "vcs"
+}
+
+// DRMSnapshot is every DRM client visible at one point in time.
+type DRMSnapshot struct {
+	Clients []DRMClient
+	At      time.Time
+	// Complete is false when some processes could not be inspected (they
+	// belong to another user and we lack CAP_SYS_PTRACE) or a client reports
+	// no engine stats (kernel or driver too old), so usage by processes not
+	// in Clients can't be ruled out.
+	Complete bool
+}
+
+// DRMClients reads the GPU engine usage of every process with a render or
+// card node open.
+func DRMClients() DRMSnapshot {
+	snap := DRMSnapshot{At: time.Now(), Complete: true}
+	procs, err := os.ReadDir(procDir)
+	if err != nil {
+		snap.Complete = false
+		return snap
+	}
+	seen := make(map[string]bool)
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join(procDir, proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			// Processes that exit while we look are fine; ones we may not
+			// inspect could be using the GPU
+			if errors.Is(err, fs.ErrPermission) {
+				snap.Complete = false
+			}
+			continue
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "/dev/dri/") {
+				continue
+			}
+			client, ok := readDRMFdinfo(filepath.Join(procDir, proc.Name(), "fdinfo", fd.Name()))
+			if !ok || seen[client.ID] {
+				continue
+			}
+			seen[client.ID] = true
+			if len(client.Engines) == 0 {
+				snap.Complete = false
+				continue
+			}
+			client.PID = pid
+			snap.Clients = append(snap.Clients, client)
+		}
+	}
+	return snap
+}
+
+// readDRMFdinfo parses the drm-* keys of one fdinfo file. ok is false if the
+// file is not a DRM client.
+func readDRMFdinfo(path string) (DRMClient, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DRMClient{}, false
+	}
+	defer f.Close()
+
+	client := DRMClient{Engines: make(map[string]EngineTime)}
+	var pdev, id string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		// Counters are "<n> ns" or a bare cycle count
+		n, _ := strconv.ParseUint(strings.TrimSuffix(value, " ns"), 10, 64)
+		switch {
+		case key == "drm-pdev":
+			pdev = value
+		case key == "drm-client-id":
+			id = value
+		case strings.HasPrefix(key, "drm-engine-") && !strings.HasPrefix(key, "drm-engine-capacity-"):
+			engine := strings.TrimPrefix(key, "drm-engine-")
+			et := client.Engines[engine]
+			et.Busy = n
+			client.Engines[engine] = et
+		case strings.HasPrefix(key, "drm-cycles-"):
+			engine := strings.TrimPrefix(key, "drm-cycles-")
+			et := client.Engines[engine]
+			et.Busy = n
+			client.Engines[engine] = et
+		case strings.HasPrefix(key, "drm-total-cycles-"):
+			engine := strings.TrimPrefix(key, "drm-total-cycles-")
+			et := client.Engines[engine]
+			et.Total = n
+			client.Engines[engine] = et
+		}
+	}
+	if id == "" {
+		return DRMClient{}, false
+	}
+	client.ID = pdev + "/" + id
+	return client, true
+}
+
+// ExternalGPUPercent returns how busy the busiest GPU engine was between two
+// snapshots, counting only clients of processes not in own. ok is false if
+// either snapshot is incomplete, so the caller can't rule out usage it
+// doesn't see.
+func ExternalGPUPercent(prev, cur DRMSnapshot, own map[int]bool) (percent float64, ok bool) {
+	if !prev.Complete || !cur.Complete || !cur.At.After(prev.At) {
+		return 0, false
+	}
+	before := make(map[string]DRMClient, len(prev.Clients))
+	for _, c := range prev.Clients {
+		before[c.ID] = c
+	}
+	elapsed := float64(cur.At.Sub(prev.At).Nanoseconds())
+
+	// Clients share engines, so their shares add up per engine
+	busy := make(map[string]float64)
+	for _, c := range cur.Clients {
+		if own[c.PID] {
+			continue
+		}
+		// A client that appeared since prev is judged from the next sample
+		old, found := before[c.ID]
+		if !found {
+			continue
+		}
+		for engine, et := range c.Engines {
+			prevET := old.Engines[engine]
+			if et.Busy < prevET.Busy {
+				continue
+			}
+			delta := float64(et.Busy - prevET.Busy)
+			if et.Total > 0 {
+				if et.Total > prevET.Total {
+					busy[engine] += delta / float64(et.Total-prevET.Total) * 100
+				}
+				continue
+			}
+			busy[engine] += delta / elapsed * 100
+		}
+	}
+	for _, p := range busy {
+		percent = max(percent, p)
+	}
+	return min(percent, 100), true
+}
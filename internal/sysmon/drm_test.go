@@ -0,0 +1,132 @@
+package sysmon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadDRMFdinfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		fdinfo  string
+		ok      bool
+		id      string
+		engines map[string]EngineTime
+	}{
+		{
+			name: "i915",
+			fdinfo: "pos:\t0\nflags:\t02100002\ndrm-driver:\ti915\ndrm-pdev:\t0000:03:00.0\ndrm-client-id:\t42\n" +
+				"drm-engine-render:\t1000 ns\ndrm-engine-video:\t5000 ns\ndrm-engine-capacity-video:\t2\n",
+			ok: true, id: "0000:03:00.0/42",
+			engines: map[string]EngineTime{"render": {Busy: 1000}, "video": {Busy: 5000}},
+		},
+		{
+			name: "xe",
+			fdinfo: "drm-driver:\txe\ndrm-pdev:\t0000:03:00.0\ndrm-client-id:\t7\n" +
+				"drm-cycles-vcs:\t300\ndrm-total-cycles-vcs:\t1200\n",
+			ok: true, id: "0000:03:00.0/7",
+			engines: map[string]EngineTime{"vcs": {Busy: 300, Total: 1200}},
+		},
+		{name: "not drm", fdinfo: "pos:\t0\nflags:\t02\n", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fdinfo")
+			if err := os.WriteFile(path, []byte(tt.fdinfo), 0644); err != nil {
+				t.Fatal(err)
+			}
+			client, ok := readDRMFdinfo(path)
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if client.ID != tt.id {
+				t.Errorf("ID = %q, want %q", client.ID, tt.id)
+			}
+			if len(client.Engines) != len(tt.engines) {
+				t.Errorf("Engines = %v, want %v", client.Engines, tt.engines)
+			}
+			for engine, want := range tt.engines {
+				if got := client.Engines[engine]; got != want {
+					t.Errorf("engine %s = %+v, want %+v", engine, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExternalGPUPercent(t *testing.T) {
+	t0 := time.Date(2026, time.October, 12, 22, 0, 0, 0, time.UTC)
+	t1 := t0.Add(10 * time.Second)
+	ns := func(pid int, id string, video uint64) DRMClient {
+		return DRMClient{PID: pid, ID: id, Engines: map[string]EngineTime{"video": {Busy: video}}}
+	}
+	snap := func(at time.Time, complete bool, clients ...DRMClient) DRMSnapshot {
+		return DRMSnapshot{Clients: clients, At: at, Complete: complete}
+	}
+	sec := uint64(time.Second)
+
+	tests := []struct {
+		name      string
+		prev, cur DRMSnapshot
+		own       map[int]bool
+		want      float64
+		ok        bool
+	}{
+		{
+			name: "own encode left out",
+			prev: snap(t0, true, ns(100, "a", 0), ns(200, "b", 0)),
+			cur:  snap(t1, true, ns(100, "a", 9*sec), ns(200, "b", 3*sec)),
+			own:  map[int]bool{100: true},
+			want: 30, ok: true,
+		},
+		{
+			name: "clients add up per engine",
+			prev: snap(t0, true, ns(200, "b", 0), ns(300, "c", 0)),
+			cur:  snap(t1, true, ns(200, "b", 2*sec), ns(300, "c", 4*sec)),
+			want: 60, ok: true,
+		},
+		{
+			name: "capped",
+			prev: snap(t0, true, ns(200, "b", 0), ns(300, "c", 0)),
+			cur:  snap(t1, true, ns(200, "b", 8*sec), ns(300, "c", 8*sec)),
+			want: 100, ok: true,
+		},
+		{
+			name: "new client waits a sample",
+			prev: snap(t0, true),
+			cur:  snap(t1, true, ns(200, "b", 50*sec)),
+			want: 0, ok: true,
+		},
+		{
+			name: "cycles",
+			prev: snap(t0, true, DRMClient{PID: 200, ID: "b", Engines: map[string]EngineTime{"vcs": {Busy: 100, Total: 1000}}}),
+			cur:  snap(t1, true, DRMClient{PID: 200, ID: "b", Engines: map[string]EngineTime{"vcs": {Busy: 600, Total: 2000}}}),
+			want: 50, ok: true,
+		},
+		{
+			name: "incomplete",
+			prev: snap(t0, true, ns(200, "b", 0)),
+			cur:  snap(t1, false, ns(200, "b", 5*sec)),
+			ok:   false,
+		},
+		{
+			name: "no previous sample",
+			prev: DRMSnapshot{},
+			cur:  snap(t1, true, ns(200, "b", 5*sec)),
+			ok:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ExternalGPUPercent(tt.prev, tt.cur, tt.own)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("ExternalGPUPercent = %g, %t, want %g, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
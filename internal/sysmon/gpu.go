@@ -1,4 +1,6 @@
-package tui
+// Package sysmon reads host health signals: GPU utilization and hardware
+// temperatures from sysfs.
+package sysmon
 
 import (
 	"context"
@@ -11,9 +13,9 @@ import (
 	"time"
 )
 
-// getGPUUsage attempts to get Intel GPU utilization percentage.
+// GPUUsage attempts to get Intel GPU utilization percentage.
 // Returns 0.0 if unable to determine GPU usage.
-func getGPUUsage() float64 {
+func GPUUsage() float64 {
 	// Try hardcoded path first (most reliable)
 	hardcodedPath := "/sys/devices/pci0000:00/0000:00:01.1/0000:01:00.0/0000:02:01.0/0000:03:00.0/drm/card1/gt/gt0"
 	actFreqPath := filepath.Join(hardcodedPath, "rps_act_freq_mhz")
@@ -0,0 +1,84 @@
+package sysmon
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hwmonDir is where the kernel exposes hardware monitoring chips.
+const hwmonDir = "/sys/class/hwmon"
+
+// Temperature is one hwmon temperature sensor reading.
+type Temperature struct {
+	Chip    string  `json:"chip"`  // hwmon chip name, e.g. "coretemp", "i915", "nvme"
+	Label   string  `json:"label"` // sensor label, e.g. "Package id 0", or the file name if unlabelled
+	Celsius float64 `json:"celsius"`
+}
+
+// Temperatures reads every hwmon temperature sensor. Sensors that can't be
+// read are left out, so an empty result means none are available.
+func Temperatures() []Temperature {
+	chips, err := filepath.Glob(filepath.Join(hwmonDir, "hwmon*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(chips)
+
+	var temps []Temperature
+	for _, chip := range chips {
+		name := readTrimmed(filepath.Join(chip, "name"))
+		if name == "" {
+			name = filepath.Base(chip)
+		}
+		inputs, _ := filepath.Glob(filepath.Join(chip, "temp*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			// Values are in millidegrees Celsius
+			milli, err := strconv.ParseFloat(readTrimmed(input), 64)
+			if err != nil {
+				continue
+			}
+			sensor := strings.TrimSuffix(filepath.Base(input), "_input")
+			label := readTrimmed(filepath.Join(chip, sensor+"_label"))
+			if label == "" {
+				label = sensor
+			}
+			temps = append(temps, Temperature{Chip: name, Label: label, Celsius: milli / 1000})
+		}
+	}
+	return temps
+}
+
+// Hottest returns the hottest reading among the given chips, or among all of
+// them if chips is empty. ok is false if there is no matching reading.
+func Hottest(temps []Temperature, chips []string) (hottest Temperature, ok bool) {
+	for _, t := range temps {
+		if len(chips) > 0 && !containsFold(chips, t.Chip) {
+			continue
+		}
+		if !ok || t.Celsius > hottest.Celsius {
+			hottest, ok = t, true
+		}
+	}
+	return hottest, ok
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
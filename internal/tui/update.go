@@ -8,6 +8,7 @@ import (
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
 	"github.com/yourname/av1qsvd/internal/jobs"
+	"github.com/yourname/av1qsvd/internal/sysmon"
 )
 
 // Update handles messages and updates the model.
@@ -50,7 +51,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		// Update GPU usage
-		m.gpuPercent = getGPUUsage()
+		m.gpuPercent = sysmon.GPUUsage()
 
 		return m, nil
 